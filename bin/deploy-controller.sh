@@ -7,6 +7,9 @@ PORT=${PORT:-"22"}
 # upload load files
 rsync -azIv -e "ssh -p${PORT}" controller/etc/flipdisk.service "pi@${HOST}:/tmp/"
 rsync -azIv -e "ssh -p${PORT}" controller/build/main "pi@${HOST}:/home/pi/Desktop/"
+rsync -azv -e "ssh -p${PORT}" controller/fonts "pi@${HOST}:/home/pi/Desktop/"
+# only upload the example config the first time, so we don't clobber the board's config
+rsync -azv --ignore-existing -e "ssh -p${PORT}" controller/etc/flipdisk.yaml "pi@${HOST}:/home/pi/Desktop/"
 
 ssh -p"${PORT}" "pi@${HOST}" << EOF
   sudo mv /tmp/flipdisk.service /lib/systemd/system/.
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/armory/flipdisks/pkg/fontmap"
+	log "github.com/sirupsen/logrus"
+)
+
+const fontsheetUsage = `usage:
+  flipdisk fontsheet export [-fonts dir] [-scale 8] [-columns 16] <font> <sheet.png>
+  flipdisk fontsheet import [-fonts dir] <sheet.png>
+
+export draws every glyph of a font into a png, with the metrics in sheet.json next to it.
+Edit the png in an image editor, black is a dot, and change a glyph's width in the json to make it wider.
+import turns the png and json back into <fonts dir>/<name>.bdf, and <name>.kern if it has kerning.
+`
+
+// fontsheet is the "fontsheet" subcommand, so fonts can be drawn in an image editor instead of typed in as Rows
+func fontsheet(args []string) error {
+	if len(args) == 0 {
+		return errors.New(fontsheetUsage)
+	}
+
+	flags := flag.NewFlagSet("fontsheet "+args[0], flag.ContinueOnError)
+	fontsDir := flags.String("fonts", "fonts", "the fonts dir, fonts in it can be exported and imported fonts are saved in it")
+	scale := flags.Int("scale", 8, "how many pixels wide and tall a dot is in the sheet")
+	columns := flags.Int("columns", 16, "how many glyphs go across the sheet")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "export":
+		if flags.NArg() != 2 {
+			return errors.New(fontsheetUsage)
+		}
+		return exportFontSheet(*fontsDir, flags.Arg(0), flags.Arg(1), *columns, *scale)
+
+	case "import":
+		if flags.NArg() != 1 {
+			return errors.New(fontsheetUsage)
+		}
+		return importFontSheet(flags.Arg(0), *fontsDir)
+
+	default:
+		return errors.New(fontsheetUsage)
+	}
+}
+
+func exportFontSheet(fontsDir, fontName, sheetPath string, columns, scale int) error {
+	if _, err := os.Stat(fontsDir); err == nil {
+		if err := fontmap.LoadDir(fontsDir); err != nil {
+			return err
+		}
+	}
+
+	font, exists := fontmap.Get(fontName)
+	if !exists {
+		return fmt.Errorf("there's no font called %s, there's %s", fontName, strings.Join(fontmap.Names(), ", "))
+	}
+
+	sheet, metrics := fontmap.ExportSheet(font, columns, scale)
+
+	if err := writeFile(sheetPath, func(f *os.File) error { return png.Encode(f, sheet) }); err != nil {
+		return err
+	}
+	if err := writeFile(sheetMetricsPath(sheetPath), func(f *os.File) error { return fontmap.WriteSheetMetrics(f, metrics) }); err != nil {
+		return err
+	}
+
+	log.Infof("exported %d glyphs of %s to %s and %s", len(metrics.Glyphs), font.Name, sheetPath, sheetMetricsPath(sheetPath))
+	return nil
+}
+
+func importFontSheet(sheetPath, fontsDir string) error {
+	f, err := os.Open(sheetPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sheet, err := png.Decode(f)
+	if err != nil {
+		return errors.New("couldn't read the sheet: " + err.Error())
+	}
+
+	metricsFile, err := os.Open(sheetMetricsPath(sheetPath))
+	if err != nil {
+		return err
+	}
+	defer metricsFile.Close()
+	metrics, err := fontmap.ReadSheetMetrics(metricsFile)
+	if err != nil {
+		return err
+	}
+
+	font, err := fontmap.ImportSheet(sheet, metrics)
+	if err != nil {
+		return err
+	}
+	if font.Name == "" {
+		font.Name = strings.TrimSuffix(filepath.Base(sheetPath), filepath.Ext(sheetPath))
+	}
+
+	if err := os.MkdirAll(fontsDir, 0755); err != nil {
+		return err
+	}
+
+	bdfPath := filepath.Join(fontsDir, font.Name+".bdf")
+	if err := writeFile(bdfPath, func(f *os.File) error { return fontmap.WriteBDF(f, &font) }); err != nil {
+		return err
+	}
+	log.Infof("imported %d glyphs to %s", len(font.Charmap), bdfPath)
+
+	if len(font.Kerning) > 0 {
+		kerningPath := filepath.Join(fontsDir, font.Name+".kern")
+		if err := writeFile(kerningPath, func(f *os.File) error { return fontmap.WriteKerning(f, font.Kerning) }); err != nil {
+			return err
+		}
+		log.Infof("saved the kerning to %s", kerningPath)
+	}
+
+	return nil
+}
+
+// sheetMetricsPath is where the json for a sheet goes, ti84.png has ti84.json
+func sheetMetricsPath(sheetPath string) string {
+	return strings.TrimSuffix(sheetPath, filepath.Ext(sheetPath)) + ".json"
+}
+
+func writeFile(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return errors.New("couldn't write " + path + ": " + err.Error())
+	}
+	return f.Close()
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"github.com/armory/flipdisks/pkg/cache"
 	"github.com/armory/flipdisks/pkg/image"
+	log "github.com/sirupsen/logrus"
 )
 
 func main() {
@@ -34,9 +36,16 @@ func main() {
 	url:="https://cloud.githubusercontent.com/assets/2227312/13043527/ac78a62c-d3d9-11e5-866d-90499b6ffd22.gif"
 
 
+	// after the first time, the gif comes out of the cache instead of being downloaded and converted again
+	mediaCache, err := cache.New("cache", 100*1024*1024)
+	if err != nil {
+		log.Fatal(err)
+	}
+	image.SetCache(mediaCache)
+
 	//blah, _ := image.ConvertGifFromURLToVirtualBoard( url,50, 50,  false, 90)
 	for {
-		image.ConvertGifFromURLToVirtualBoard(url, 50, 50, false, 80)
+		image.ConvertGifFromURLToVirtualBoard(url, 50, 50, false, 80, image.DitherThreshold, image.Fit{Mode: image.FitStretch})
 		//for _, b := range blah.Flipboards {
 		//	s := ""
 		//	for _, a := range *b {
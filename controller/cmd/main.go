@@ -3,31 +3,81 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
+	"os"
 	"sync"
 
+	"github.com/armory/flipdisks/db"
+	"github.com/armory/flipdisks/pkg/cache"
+	"github.com/armory/flipdisks/pkg/config"
 	"github.com/armory/flipdisks/pkg/flipboard"
 	"github.com/armory/flipdisks/pkg/github"
+	"github.com/armory/flipdisks/pkg/image"
+	"github.com/armory/flipdisks/pkg/metrics"
 	"github.com/armory/flipdisks/pkg/slackbot"
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fontsheet" {
+		if err := fontsheet(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	log.Print("Starting flipdisk controller")
 
-	port := flag.String("p", "/dev/tty.SLAB_USBtoUART", "the serial port, empty string to simulate")
-	baud := flag.Int("b", 9600, "baud rate of port")
+	configPath := flag.String("config", "", "path to the yaml config file, see etc/flipdisk.yaml")
+
+	// these win over the config file and the environment, but only when they're given
+	port := flag.String("p", "", "the serial port, empty string to simulate")
+	baud := flag.Int("b", 0, "baud rate of port")
 
 	var slackToken string
-	flag.StringVar(&slackToken, "slack-token", "", "Go get a slack token")
+	flag.StringVar(&slackToken, "slack-token", "", "Go get a slack token, or set "+config.EnvSlackToken)
 
 	var githubToken string
-	flag.StringVar(&githubToken, "github-token", "", "Go get a github token")
+	flag.StringVar(&githubToken, "github-token", "", "Go get a github token, or set "+config.EnvGithubToken)
+
+	var metricsAddr string
+	flag.StringVar(&metricsAddr, "metrics-addr", ":9110", "address to serve prometheus /metrics on, empty string to disable")
 
 	var countdownDate string
 	flag.StringVar(&countdownDate, "countdown", "", fmt.Sprintf("Specify the countdown date in YYYY-MM-DD format"))
 	flag.Parse()
 
-	g, err := github.New(github.Token(githubToken))
+	live := &liveConfig{
+		path: *configPath,
+		overrides: func(cfg *config.Config) {
+			flag.Visit(func(f *flag.Flag) {
+				switch f.Name {
+				case "p":
+					cfg.Serial.Port = *port
+				case "b":
+					cfg.Serial.Baud = *baud
+				case "slack-token":
+					cfg.Slack.Token = slackToken
+				case "github-token":
+					cfg.Github.Token = githubToken
+				case "metrics-addr":
+					cfg.HTTP.Addr = metricsAddr
+				}
+			})
+		},
+	}
+
+	cfg, err := live.load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Print("Using config:\n" + cfg.Summary())
+
+	if cfg.Slack.Token == "" {
+		log.Warn("no slack token, set " + config.EnvSlackToken + " or use a credentials file. The slackbot won't be able to connect")
+	}
+
+	g, err := github.New(github.Token(cfg.Github.Token))
 	if err != nil {
 		log.Error("Could not create githubClient, hopefully everything will work!")
 	}
@@ -36,24 +86,27 @@ func main() {
 		log.Error("Could not get emojis from Github", err)
 	}
 
-	// currently we're only supporting uniform panels, oriented the same way
-	panelInfo := flipboard.PanelInfo{
-		PanelWidth:               28,
-		PanelHeight:              7,
-		PhysicallyDisplayedWidth: 7,
-		Port: *port,
-		Baud: *baud,
+	panelInfo, panelLayout := flipboard.PanelsFromConfig(cfg)
+
+	d, err := db.NewDb(cfg.DbPath, nil)
+	if err != nil {
+		log.Fatal("couldn't create db: " + err.Error())
 	}
 
-	panelLayout := [][]flipboard.PanelAddress{
-		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
-		{10, 11, 12, 13, 14, 15, 16, 17, 18, 19},
+	if cfg.Cache.Dir != "" {
+		mediaCache, err := cache.New(cfg.Cache.Dir, cfg.Cache.MaxBytes())
+		if err != nil {
+			log.Warn("images won't be cached: " + err.Error())
+		} else {
+			image.SetCache(mediaCache)
+			live.cache = mediaCache
+		}
 	}
 
 	var flipboardOpts []flipboard.Opts
 	flipboardOpts = append(flipboardOpts, flipboard.NewCountdownDate())
 
-	board, err := flipboard.NewFlipboard(panelInfo, panelLayout, flipboardOpts...)
+	board, err := flipboard.NewFlipboardWithDb(panelInfo, panelLayout, d, flipboardOpts...)
 	if err != nil {
 		log.Fatal("couldn't create flipboard: " + err.Error())
 	}
@@ -62,7 +115,22 @@ func main() {
 		flipboard.SetCountdownClock(board, countdownDate)
 	}
 
-	slack := slackbot.NewSlack(slackToken, githubEmojiLookup)
+	if cfg.HTTP.Addr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			log.Error("metrics server stopped: ", http.ListenAndServe(cfg.HTTP.Addr, mux))
+		}()
+	}
+
+	slack := slackbot.NewSlack(cfg.Slack.Token, githubEmojiLookup)
+	slack.Reload = live.reload
+
+	live.board = board
+	live.slack = slack
+	live.apply(cfg)
+	// even without a config file, SIGHUP would kill us otherwise, and `systemctl reload` sends it
+	go live.reloadOnSIGHUP()
 
 	go slack.StartSlackListener(board)
 
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/armory/flipdisks/pkg/config"
 	"github.com/armory/flipdisks/pkg/flipboard"
 	"github.com/armory/flipdisks/pkg/fontmap"
+	"github.com/armory/flipdisks/pkg/image"
 	"github.com/armory/flipdisks/pkg/options"
 	"github.com/armory/flipdisks/pkg/virtualboard"
 	"github.com/kr/pty"
@@ -155,26 +160,51 @@ func TestCreateVirtualBoard(t *testing.T) {
 		},
 		{
 			testDescription:    "It should only count the dotChar width if the dotChar exists",
-			panelWidth:         4, // size of "?"
-			numberOfPanelsWide: 4, // number of characters that can fit on a line
+			panelWidth:         5,
+			numberOfPanelsWide: 2,
 			message:            "ū u",
 
 			expect: []fontmap.Row{
-				//█ u
-				{1, 1, 1, 0, 0, 0, 0, 0, 0},
-				{1, 1, 1, 0, 0, 1, 0, 1, 0},
-				{1, 1, 1, 0, 0, 1, 0, 1, 0},
-				{1, 1, 1, 0, 0, 1, 0, 1, 0},
-				{1, 1, 1, 0, 0, 1, 1, 1, 0},
-				{1, 1, 1, 0, 0, 0, 0, 0, 0},
-				{1, 1, 1, 0, 0, 0, 0, 0, 0},
+				// u u, the font doesn't have ū so it's drawn without the accent
+				{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+				{1, 0, 1, 0, 0, 0, 1, 0, 1, 0},
+				{1, 0, 1, 0, 0, 0, 1, 0, 1, 0},
+				{1, 0, 1, 0, 0, 0, 1, 0, 1, 0},
+				{1, 1, 1, 0, 0, 0, 1, 1, 1, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			},
+		},
+		{
+			testDescription:    "It should break lines by character, not by byte",
+			panelWidth:         4,
+			numberOfPanelsWide: 2,
+			message:            "é🔥 👍🏽",
+
+			expect: []fontmap.Row{
+				// e?
+				{0, 0, 0, 0, 1, 1, 0, 0},
+				{0, 1, 0, 0, 0, 0, 1, 0},
+				{1, 0, 1, 0, 0, 1, 0, 0},
+				{1, 1, 0, 0, 0, 0, 0, 0},
+				{0, 1, 1, 0, 0, 1, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0},
+				// ?
+				{1, 1, 0, 0},
+				{0, 0, 1, 0},
+				{0, 1, 0, 0},
+				{0, 0, 0, 0},
+				{0, 1, 0, 0},
+				{0, 0, 0, 0},
+				{0, 0, 0, 0},
 			},
 		},
 	}
 
 	for index, testCase := range tests {
 		msgAsDots := fontmap.Render(testCase.message)
-		got := flipboard.CreateVirtualBoard(testCase.panelWidth, testCase.numberOfPanelsWide, msgAsDots, testCase.message)
+		got := flipboard.CreateVirtualBoard(testCase.panelWidth, testCase.numberOfPanelsWide, msgAsDots, testCase.message, flipboard.TextLayout{LineHeight: fontmap.TI84.Metadata.MaxHeight})
 		if !reflect.DeepEqual(testCase.expect, got) {
 			t.Errorf("Test %d", index)
 			t.Errorf("Expected\n%#v:\n%s", testCase.expect, testCase.expect)
@@ -183,12 +213,201 @@ func TestCreateVirtualBoard(t *testing.T) {
 	}
 }
 
+func TestCreateVirtualBoardWithScaledFont(t *testing.T) {
+	// a board that's 2 panels tall can fit 2 lines of normal text, or 1 line of double sized text
+	small := fontmap.RenderWithFont("a\nb", &fontmap.TI84, 1)
+	got := flipboard.CreateVirtualBoard(7, 2, small, "a\nb", flipboard.TextLayout{LineHeight: fontmap.LineHeight(&fontmap.TI84, 1)})
+	if len(got) != 14 {
+		t.Errorf("Expected 2 lines to be 14 rows, got %d\n%s", len(got), got)
+	}
+
+	big := fontmap.RenderWithFont("ab", &fontmap.TI84, 2)
+	got = flipboard.CreateVirtualBoard(7, 3, big, "ab", flipboard.TextLayout{LineHeight: fontmap.LineHeight(&fontmap.TI84, 2)})
+	if len(got) != 14 || len(got[0]) != 16 {
+		t.Errorf("Expected 1 line of double sized text to be 16x14, got %dx%d\n%s", len(got[0]), len(got), got)
+	}
+}
+
+func TestCreateVirtualBoardTextAlign(t *testing.T) {
+	// every letter is a 2 wide block, and a space is 1 wide
+	letter := fontmap.Letter{{1, 1}}
+	space := fontmap.Letter{{0}}
+	render := func(msg string) []fontmap.Letter {
+		var letters []fontmap.Letter
+		for _, char := range fontmap.Graphemes(msg) {
+			switch char {
+			case "\n":
+				letters = append(letters, nil)
+			case " ":
+				letters = append(letters, space)
+			default:
+				letters = append(letters, letter)
+			}
+		}
+		return letters
+	}
+
+	tests := map[string]struct {
+		message string
+		layout  flipboard.TextLayout
+		expect  []fontmap.Row
+	}{
+		"left": {
+			message: "aa\nb",
+			layout:  flipboard.TextLayout{LineHeight: 1, TextAlign: "left"},
+			expect: []fontmap.Row{
+				{1, 1, 1, 1},
+				{1, 1},
+			},
+		},
+		"center": {
+			message: "aaa\nb",
+			layout:  flipboard.TextLayout{LineHeight: 1, TextAlign: "center"},
+			expect: []fontmap.Row{
+				{1, 1, 1, 1, 1, 1},
+				{0, 0, 1, 1},
+			},
+		},
+		"right": {
+			message: "aa\nb",
+			layout:  flipboard.TextLayout{LineHeight: 1, TextAlign: "right"},
+			expect: []fontmap.Row{
+				{1, 1, 1, 1},
+				{0, 0, 1, 1},
+			},
+		},
+		"justify stretches wrapped lines, but not the last line": {
+			message: "a b c dddddd a b",
+			layout:  flipboard.TextLayout{LineHeight: 1, TextAlign: "justify"},
+			expect: []fontmap.Row{
+				{1, 1, 0, 0, 0, 1, 1, 0, 0, 0, 1, 1},
+				{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+				{1, 1, 0, 1, 1},
+			},
+		},
+		"line spacing": {
+			message: "a\nb",
+			layout:  flipboard.TextLayout{LineHeight: 1, LineSpacing: 2},
+			expect: []fontmap.Row{
+				{1, 1},
+				{},
+				{},
+				{1, 1},
+			},
+		},
+		"word spacing": {
+			message: "a b",
+			layout:  flipboard.TextLayout{LineHeight: 1, Spacing: []int{0, 2, 0}},
+			expect: []fontmap.Row{
+				{1, 1, 0, 0, 0, 1, 1},
+			},
+		},
+		"inverted word": {
+			message: "a b a",
+			layout:  flipboard.TextLayout{LineHeight: 1, Inverted: []bool{false, false, true, false, false}},
+			expect: []fontmap.Row{
+				{1, 1, 1, 0, 0, 0, 1, 1},
+			},
+		},
+		"inverted words are one block": {
+			message: "a b a",
+			layout:  flipboard.TextLayout{LineHeight: 1, Inverted: []bool{true, true, true}},
+			expect: []fontmap.Row{
+				{0, 0, 1, 0, 0, 0, 1, 1},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := flipboard.CreateVirtualBoard(13, 1, render(test.message), test.message, test.layout)
+			if !reflect.DeepEqual(virtualboard.VirtualBoard(test.expect), got) {
+				t.Errorf("Expected\n%s\nGot\n%s", virtualboard.VirtualBoard(test.expect), got)
+			}
+		})
+	}
+}
+
+func TestFitText(t *testing.T) {
+	// our board is 10x2 panels, 70 dots wide and 56 dots tall
+	tests := map[string]struct {
+		message       string
+		width, height int
+		expectScale   int
+		expectFits    bool
+	}{
+		"a short word fills the board": {
+			message: "LUNCH", width: 70, height: 56,
+			expectScale: 3, expectFits: true,
+		},
+		"a short board keeps the word small": {
+			message: "LUNCH", width: 70, height: 7,
+			expectScale: 1, expectFits: true,
+		},
+		"a sentence wraps onto more lines": {
+			message: "Lunch is in the kitchen, come and get it before it's gone", width: 70, height: 56,
+			expectScale: 1, expectFits: true,
+		},
+		"too much text doesn't fit": {
+			message: "Lunch is in the kitchen, come and get it before it's gone", width: 28, height: 14,
+			expectScale: 1, expectFits: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			msg := options.FlipboardMessageOptions{Message: test.message}
+			font, scale, fits := flipboard.FitText(&msg, test.width, test.height)
+			if font == nil || scale != test.expectScale || fits != test.expectFits {
+				t.Errorf("Expected %dx fits=%t, but got %v %dx fits=%t", test.expectScale, test.expectFits, font, scale, fits)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	// 5 lines of text, each line is 2 rows with a row of line spacing after it
+	var text virtualboard.VirtualBoard
+	for line := 1; line <= 5; line++ {
+		text = append(text, fontmap.Row{line}, fontmap.Row{line})
+		if line < 5 {
+			text = append(text, fontmap.Row{})
+		}
+	}
+	layout := flipboard.TextLayout{LineHeight: 2, LineSpacing: 1}
+
+	pages := flipboard.Paginate(text, layout, 8)
+	expect := []virtualboard.VirtualBoard{
+		{{1}, {1}, {}, {2}, {2}, {}, {3}, {3}},
+		{{4}, {4}, {}, {5}, {5}},
+	}
+	if !reflect.DeepEqual(expect, pages) {
+		t.Errorf("Expected %v, but got %v", expect, pages)
+	}
+
+	if pages := flipboard.Paginate(text, layout, len(text)); len(pages) != 1 {
+		t.Errorf("Expected text that fits to be 1 page, got %d", len(pages))
+	}
+
+	// a board shorter than a line still gets a line per page
+	if pages := flipboard.Paginate(text, layout, 1); len(pages) != 5 {
+		t.Errorf("Expected a page per line, got %d", len(pages))
+	}
+}
+
 // These tests are only concerned with not crashing the flipboard when displaying a message
 // Todo: we should test the actual virtual board. there's a few options:
 // 	- check the cache
 // 	- check each panel's value
 //	- add a return type and check that
 func TestDisplayMessageToPanels(t *testing.T) {
+	images := httptest.NewServer(http.FileServer(http.Dir("../pkg/image/test_fixtures")))
+	defer images.Close()
+	limits := image.DefaultFetchLimits()
+	limits.AllowedHosts = []string{"127.0.0.1"} // the test server is on loopback
+	image.SetFetchLimits(limits)
+	defer image.SetFetchLimits(image.DefaultFetchLimits())
+
 	tests := map[string]struct {
 		msg options.FlipboardMessageOptions
 	}{
@@ -202,6 +421,27 @@ func TestDisplayMessageToPanels(t *testing.T) {
 				Message: "Simple\nString",
 			},
 		},
+		"text that's split into pages": {
+			msg: options.FlipboardMessageOptions{
+				Message:       "1\n2\n3\n4\n5\n6\n7\n8\n9",
+				PageTime:      1,
+				PageIndicator: true,
+			},
+		},
+		"auto fit": {
+			msg: options.FlipboardMessageOptions{
+				Message: "LUNCH",
+				Fit:     "auto",
+			},
+		},
+		"justified text with spacing": {
+			msg: options.FlipboardMessageOptions{
+				Message:     "A few words that wrap over a few lines, justified",
+				TextAlign:   "justify",
+				LineSpacing: -1,
+				WordSpacing: 1,
+			},
+		},
 		"image url": {
 			msg: func() options.FlipboardMessageOptions {
 				o := options.GetDefaultOptions()
@@ -251,6 +491,19 @@ func TestDisplayMessageToPanels(t *testing.T) {
 				Message: "Simple String",
 			},
 		},
+		"text with markup": {
+			msg: options.FlipboardMessageOptions{
+				Message:     "[inv]ON AIR[/inv] *now* [blink]!",
+				DisplayTime: 1,
+			},
+		},
+		"text with inline images": {
+			msg: options.FlipboardMessageOptions{
+				Message:     "Congrats " + images.URL + "/fast_parrot.gif Sam" + images.URL + "/armory.jpg",
+				DisplayTime: 1,
+				BWThreshold: 90,
+			},
+		},
 		"gif url": {
 			msg: func() options.FlipboardMessageOptions {
 				o := options.GetDefaultOptions()
@@ -264,8 +517,11 @@ func TestDisplayMessageToPanels(t *testing.T) {
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
 			// setup a psudo tty to use
-			_, tty, _ := pty.Open()
-			defer func() { tty.Close() }()
+			pt, tty, err := pty.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { tty.Close(); pt.Close() }() // the tty goes away if the pty is garbage collected
 
 			panelInfo := flipboard.PanelInfo{
 				Baud:                     9600,
@@ -280,8 +536,75 @@ func TestDisplayMessageToPanels(t *testing.T) {
 				{10, 11, 12, 13, 14, 15, 16, 17, 18, 19},
 			}
 
-			board, _ := flipboard.NewFlipboard(panelInfo, panelLayout)
+			board, err := flipboard.NewFlipboard(panelInfo, panelLayout)
+			if err != nil {
+				t.Fatal(err)
+			}
 			flipboard.DisplayMessageToPanels(board, &test.msg)
 		})
 	}
 }
+
+func TestReloadWithoutConfigFile(t *testing.T) {
+	current := config.Default()
+	current.QuietHours = config.QuietHours{Start: "22:00", End: "07:00"}
+	live := &liveConfig{current: current, overrides: func(*config.Config) {}}
+
+	if err := live.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(live.current, current) {
+		t.Errorf("Expected the live settings to be left alone, got %+v", live.current)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		edit func(c *config.Config)
+
+		ExpectedProblem string
+	}{
+		"unknown dither": {
+			edit:            func(c *config.Config) { c.Defaults.Dither = "sierra" },
+			ExpectedProblem: `defaults.dither "sierra" is unknown`,
+		},
+		"unknown fit": {
+			edit:            func(c *config.Config) { c.Defaults.Fit = "squish" },
+			ExpectedProblem: `defaults.fit "squish" is unknown`,
+		},
+		"unknown playback": {
+			edit:            func(c *config.Config) { c.Defaults.Playback = "backwards" },
+			ExpectedProblem: `defaults.playback "backwards" is unknown`,
+		},
+		"replacement glyph that's two characters": {
+			edit:            func(c *config.Config) { c.ReplacementGlyph = "??" },
+			ExpectedProblem: `replacementGlyph "??" must be a single character`,
+		},
+		"config's own problems": {
+			edit:            func(c *config.Config) { c.MinFrameInterval = -1 },
+			ExpectedProblem: "minFrameInterval can't be negative",
+		},
+	}
+
+	if err := validate(config.Default()); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := config.Default()
+			test.edit(&c)
+
+			err := validate(c)
+			if err == nil || !strings.Contains(err.Error(), test.ExpectedProblem) {
+				t.Errorf("Expected a problem with %q, got %v", test.ExpectedProblem, err)
+			}
+		})
+	}
+}
+
+func TestFetchLimitsMatchTheImageDefaults(t *testing.T) {
+	if got := fetchLimits(config.Default().Fetch); !reflect.DeepEqual(got, image.DefaultFetchLimits()) {
+		t.Errorf("Expected the default config to fetch with %+v, got %+v", image.DefaultFetchLimits(), got)
+	}
+}
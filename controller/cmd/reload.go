@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/armory/flipdisks/pkg/cache"
+	"github.com/armory/flipdisks/pkg/config"
+	"github.com/armory/flipdisks/pkg/flipboard"
+	"github.com/armory/flipdisks/pkg/fontmap"
+	"github.com/armory/flipdisks/pkg/image"
+	"github.com/armory/flipdisks/pkg/options"
+	"github.com/armory/flipdisks/pkg/slackbot"
+	log "github.com/sirupsen/logrus"
+)
+
+// liveConfig keeps track of the config that's running, so it can be reloaded without a restart
+type liveConfig struct {
+	path string
+
+	// overrides applies the command line flags on top of the file, they always win
+	overrides func(*config.Config)
+
+	mutex   sync.Mutex
+	current config.Config
+	board   *flipboard.Flipboard
+	slack   *slackbot.Slack
+	cache   *cache.Cache
+}
+
+// load reads and validates the config, nothing is applied
+func (l *liveConfig) load() (config.Config, error) {
+	cfg, err := config.Load(l.path)
+	if err != nil {
+		return cfg, err
+	}
+
+	l.overrides(&cfg)
+
+	if err := validate(cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// validate is config.Validate, with the names config doesn't know about, they're up to the fontmap and image packages
+func validate(cfg config.Config) error {
+	problems := cfg.Problems()
+
+	if len(fontmap.Graphemes(cfg.ReplacementGlyph)) != 1 {
+		problems = append(problems, fmt.Sprintf("replacementGlyph %q must be a single character", cfg.ReplacementGlyph))
+	}
+
+	defaults := cfg.Defaults
+	if !image.IsDitherAlgorithm(defaults.Dither) {
+		problems = append(problems, fmt.Sprintf("defaults.dither %q is unknown, try %s", defaults.Dither, strings.Join(image.DitherAlgorithms, ", ")))
+	}
+	if _, err := image.NewFit(defaults.Fit, defaults.Focus, defaults.Crop); err != nil {
+		problems = append(problems, "defaults."+err.Error())
+	}
+	if !image.IsPlayback(defaults.Playback) {
+		problems = append(problems, fmt.Sprintf("defaults.playback %q is unknown, try %s", defaults.Playback, strings.Join(image.Playbacks, ", ")))
+	}
+
+	return config.Invalid(problems)
+}
+
+// fetchLimits are the config's fetch settings for the image package
+func fetchLimits(f config.FetchConfig) image.FetchLimits {
+	return image.FetchLimits{
+		ConnectTimeout: time.Duration(f.ConnectTimeout) * time.Millisecond,
+		Timeout:        time.Duration(f.Timeout) * time.Millisecond,
+		MaxBytes:       int64(f.MaxMegabytes) * 1024 * 1024,
+		MaxPixels:      f.MaxPixels,
+		MaxFrames:      f.MaxFrames,
+		AllowedHosts:   f.AllowedHosts,
+	}
+}
+
+// apply sets everything that can change while we're running
+func (l *liveConfig) apply(cfg config.Config) {
+	// the fonts from the last load are replaced, fonts that were removed from the dir go away
+	if cfg.FontsDir != "" {
+		if err := fontmap.LoadDir(cfg.FontsDir); err != nil {
+			log.Warn("keeping the fonts that were loaded before: " + err.Error())
+		}
+	} else {
+		fontmap.UnloadDir()
+	}
+
+	fontmap.SetReplacementGlyph(cfg.ReplacementGlyph)
+	options.SetDefaultOptions(options.FlipboardMessageOptions(cfg.Defaults))
+	l.board.SetQuietHours(cfg.QuietHours)
+	l.board.SetIdleProviders(cfg.Idle.Providers)
+	l.cache.SetMaxBytes(cfg.Cache.MaxBytes())
+	image.SetFetchLimits(fetchLimits(cfg.Fetch))
+	l.board.SetMinFrameInterval(time.Duration(cfg.MinFrameInterval) * time.Millisecond)
+	l.slack.SetAllowedUsers(cfg.Slack.AllowedUsers)
+	l.current = cfg
+}
+
+// reload re-reads the config file, if it's invalid the old config stays active.
+// Without a config file there's nothing to re-read, the settings are left alone.
+func (l *liveConfig) reload() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.path == "" {
+		log.Warn("No config file, nothing to reload, start with -config to use one")
+		return nil
+	}
+
+	log.Print("Reloading config from " + l.path)
+	cfg, err := l.load()
+	if err != nil {
+		log.Error("Keeping the old config: " + err.Error())
+		return err
+	}
+
+	if cfg.DbPath != l.current.DbPath || cfg.HTTP.Addr != l.current.HTTP.Addr || cfg.Cache.Dir != l.current.Cache.Dir ||
+		cfg.Slack.Token != l.current.Slack.Token || cfg.Github.Token != l.current.Github.Token {
+		log.Warn("dbPath, http, cache.dir, and the tokens only change after a restart")
+	}
+
+	if cfg.Serial != l.current.Serial || !reflect.DeepEqual(cfg.Layout, l.current.Layout) {
+		log.Print("Panel layout changed, rebuilding the panels")
+		info, layout := flipboard.PanelsFromConfig(cfg)
+		if err := l.board.Reconfigure(info, layout); err != nil {
+			log.Error("Keeping the old config: " + err.Error())
+			return errors.New("couldn't rebuild the panels: " + err.Error())
+		}
+	}
+
+	l.apply(cfg)
+	log.Print("Using config:\n" + cfg.Summary())
+	return nil
+}
+
+// reloadOnSIGHUP reloads the config every time we get a SIGHUP, e.g. `systemctl reload flipdisk`
+func (l *liveConfig) reloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		l.reload()
+	}
+}
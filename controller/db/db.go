@@ -2,13 +2,15 @@ package db
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/nanobox-io/golang-scribble"
 	log "github.com/sirupsen/logrus"
 )
 
 type Db struct {
-	scribble *scribble.Driver
+	scribble     *scribble.Driver
+	historyMutex sync.Mutex
 }
 
 type Opts func(*Db) error
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/armory/flipdisks/pkg/options"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	historyCollection   = "history"
+	favoritesCollection = "favorites"
+)
+
+// maxHistory is how many messages are kept, every message is a file on the Pi's SD card
+var maxHistory = 500
+
+// favoriteName is what a favorite can be called, the name is its file name so it can't have dots or slashes
+var favoriteName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+const SettingsHistoryLastId settingsKey = "historyLastId"
+
+// HistoryEntry is a message that was sent to the board, with the options it was played with
+type HistoryEntry struct {
+	Id      int                             `json:"id"`
+	Time    time.Time                       `json:"time"`
+	Options options.FlipboardMessageOptions `json:"options"`
+}
+
+// Favorite is a message someone saved so it can be played again by name
+type Favorite struct {
+	Name    string                          `json:"name"`
+	Options options.FlipboardMessageOptions `json:"options"`
+}
+
+// HistoryWrite records the message options and returns the id of the new history entry.
+// Only the newest maxHistory entries are kept, the oldest one is deleted to make room.
+func HistoryWrite(db *Db, opts options.FlipboardMessageOptions) (int, error) {
+	db.historyMutex.Lock()
+	defer db.historyMutex.Unlock()
+
+	lastId, _ := strconv.Atoi(SettingsRead(db, SettingsHistoryLastId))
+	entry := HistoryEntry{
+		Id:      lastId + 1,
+		Time:    time.Now(),
+		Options: opts,
+	}
+
+	// the board renders from the message, a prerendered board is too big to keep around
+	entry.Options.VirtualBoard = nil
+
+	if err := db.scribble.Write(historyCollection, strconv.Itoa(entry.Id), entry); err != nil {
+		return 0, errors.New("could not save history, " + err.Error())
+	}
+
+	SettingsWrite(db, SettingsHistoryLastId, strconv.Itoa(entry.Id))
+
+	if oldest := entry.Id - maxHistory; oldest > 0 {
+		// it might already be gone, there's nothing to do about it if it isn't
+		db.scribble.Delete(historyCollection, strconv.Itoa(oldest))
+	}
+	return entry.Id, nil
+}
+
+// HistoryRead will find the history entry for the id
+func HistoryRead(db *Db, id int) (HistoryEntry, error) {
+	var entry HistoryEntry
+	if err := db.scribble.Read(historyCollection, strconv.Itoa(id), &entry); err != nil {
+		return entry, errors.New("no history for id " + strconv.Itoa(id))
+	}
+	return entry, nil
+}
+
+// HistoryLast will return the most recent history entry
+func HistoryLast(db *Db) (HistoryEntry, error) {
+	lastId, err := strconv.Atoi(SettingsRead(db, SettingsHistoryLastId))
+	if err != nil {
+		return HistoryEntry{}, errors.New("nothing has been played yet")
+	}
+	return HistoryRead(db, lastId)
+}
+
+// HistoryRecent returns up to count of the newest history entries, newest first
+func HistoryRecent(db *Db, count int) []HistoryEntry {
+	var entries []HistoryEntry
+
+	lastId, _ := strconv.Atoi(SettingsRead(db, SettingsHistoryLastId))
+	for id := lastId; id > 0 && len(entries) < count; id-- {
+		entry, err := HistoryRead(db, id)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// FavoriteWrite saves the message options under name, overwriting any favorite with the same name
+func FavoriteWrite(db *Db, name string, opts options.FlipboardMessageOptions) error {
+	if err := checkFavoriteName(name); err != nil {
+		return err
+	}
+
+	opts.VirtualBoard = nil
+	if err := db.scribble.Write(favoritesCollection, name, Favorite{Name: name, Options: opts}); err != nil {
+		return errors.New("could not save favorite, " + err.Error())
+	}
+	return nil
+}
+
+// FavoriteRead will find the favorite saved under name
+func FavoriteRead(db *Db, name string) (Favorite, error) {
+	var fav Favorite
+	if err := checkFavoriteName(name); err != nil {
+		return fav, err
+	}
+	if err := db.scribble.Read(favoritesCollection, name, &fav); err != nil {
+		return fav, errors.New("no favorite named " + name)
+	}
+	return fav, nil
+}
+
+// FavoriteDelete removes the favorite saved under name
+func FavoriteDelete(db *Db, name string) error {
+	if err := checkFavoriteName(name); err != nil {
+		return err
+	}
+	if err := db.scribble.Delete(favoritesCollection, name); err != nil {
+		return errors.New("no favorite named " + name)
+	}
+	return nil
+}
+
+func checkFavoriteName(name string) error {
+	if name == "" {
+		return errors.New("favorites need a name")
+	}
+	if !favoriteName.MatchString(name) {
+		return errors.New("favorite names can only have letters, numbers, - and _, and be up to 64 long")
+	}
+	return nil
+}
+
+// FavoritesList returns the names of all the favorites, sorted
+func FavoritesList(db *Db) []string {
+	var names []string
+
+	records, err := db.scribble.ReadAll(favoritesCollection)
+	if err != nil {
+		return names
+	}
+
+	for _, record := range records {
+		var fav Favorite
+		if err := json.Unmarshal([]byte(record), &fav); err != nil {
+			log.Errorf("could not read favorite %s", err)
+			continue
+		}
+		names = append(names, fav.Name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/armory/flipdisks/pkg/options"
+	"github.com/go-test/deep"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDb(t *testing.T) (*Db, func()) {
+	dir, err := ioutil.TempDir("", "flipdisk-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDb(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d, func() { os.RemoveAll(dir) }
+}
+
+func TestHistory(t *testing.T) {
+	d, cleanup := newTestDb(t)
+	defer cleanup()
+
+	_, err := HistoryLast(d)
+	assert.Error(t, err, "there shouldn't be history yet")
+
+	first := options.GetDefaultOptions()
+	first.Message = "hello"
+	first.Inverted = true
+
+	second := options.GetDefaultOptions()
+	second.Message = "world"
+	second.BWThreshold = 33
+
+	firstId, err := HistoryWrite(d, first)
+	assert.NoError(t, err)
+	secondId, err := HistoryWrite(d, second)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, firstId)
+	assert.Equal(t, 2, secondId)
+
+	last, err := HistoryLast(d)
+	assert.NoError(t, err)
+	if diff := deep.Equal(last.Options, second); diff != nil {
+		t.Error(diff)
+	}
+
+	entry, err := HistoryRead(d, firstId)
+	assert.NoError(t, err)
+	if diff := deep.Equal(entry.Options, first); diff != nil {
+		t.Error(diff)
+	}
+
+	recent := HistoryRecent(d, 10)
+	assert.Len(t, recent, 2)
+	assert.Equal(t, secondId, recent[0].Id)
+
+	_, err = HistoryRead(d, 99)
+	assert.Error(t, err)
+}
+
+func TestHistoryIsCapped(t *testing.T) {
+	d, cleanup := newTestDb(t)
+	defer cleanup()
+
+	defer func(max int) { maxHistory = max }(maxHistory)
+	maxHistory = 5
+
+	msg := options.GetDefaultOptions()
+	for i := 0; i < maxHistory+2; i++ {
+		msg.Message = strconv.Itoa(i)
+		_, err := HistoryWrite(d, msg)
+		assert.NoError(t, err)
+	}
+
+	for _, id := range []int{1, 2} {
+		_, err := HistoryRead(d, id)
+		assert.Error(t, err, "the oldest entries should be deleted")
+	}
+	for _, id := range []int{3, maxHistory + 2} {
+		_, err := HistoryRead(d, id)
+		assert.NoError(t, err)
+	}
+
+	records, err := d.scribble.ReadAll(historyCollection)
+	assert.NoError(t, err)
+	assert.Len(t, records, maxHistory)
+}
+
+func TestFavorites(t *testing.T) {
+	d, cleanup := newTestDb(t)
+	defer cleanup()
+
+	parrot := options.GetDefaultOptions()
+	parrot.Message = "https://emojis.slackmojis.com/emojis/images/1471119456/981/fast_parrot.gif"
+
+	assert.NoError(t, FavoriteWrite(d, "parrot", parrot))
+	assert.NoError(t, FavoriteWrite(d, "lunch", options.FlipboardMessageOptions{Message: "LUNCH"}))
+	assert.Error(t, FavoriteWrite(d, "", parrot))
+
+	fav, err := FavoriteRead(d, "parrot")
+	assert.NoError(t, err)
+	if diff := deep.Equal(fav.Options, parrot); diff != nil {
+		t.Error(diff)
+	}
+
+	assert.Equal(t, []string{"lunch", "parrot"}, FavoritesList(d))
+
+	assert.NoError(t, FavoriteDelete(d, "lunch"))
+	assert.Equal(t, []string{"parrot"}, FavoritesList(d))
+
+	_, err = FavoriteRead(d, "lunch")
+	assert.Error(t, err)
+}
+
+func TestFavoriteNamesStayInTheirCollection(t *testing.T) {
+	d, cleanup := newTestDb(t)
+	defer cleanup()
+
+	_, err := HistoryWrite(d, options.FlipboardMessageOptions{Message: "keep me"})
+	assert.NoError(t, err)
+
+	for _, name := range []string{"..", ".", "../x", "a/b", "/etc/passwd", `a\b`, "lunch.json", strings.Repeat("a", 65)} {
+		assert.Error(t, FavoriteWrite(d, name, options.FlipboardMessageOptions{Message: "LUNCH"}), name)
+		_, err := FavoriteRead(d, name)
+		assert.Error(t, err, name)
+		assert.Error(t, FavoriteDelete(d, name), name)
+	}
+
+	// deleting ".." used to delete the whole database
+	_, err = HistoryLast(d)
+	assert.NoError(t, err)
+
+	assert.NoError(t, FavoriteWrite(d, "Lunch_time-2", options.FlipboardMessageOptions{Message: "LUNCH"}))
+}
@@ -24,6 +24,7 @@ require (
 	golang.org/x/net v0.0.0-20180719001425-81d44fd177a9
 	golang.org/x/oauth2 v0.0.0-20180620175406-ef147856a6dd
 	golang.org/x/sys v0.0.0-20180909124046-d0be0721c37e
+	golang.org/x/text v0.3.0
 	google.golang.org/appengine v1.1.0
 	gopkg.in/yaml.v2 v2.2.1
 )
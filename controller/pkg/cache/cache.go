@@ -0,0 +1,195 @@
+// Package cache keeps downloaded images and the frames rendered from them on disk, so they don't have to be
+// downloaded and rendered again, even after a restart. Every entry is a file named after the sha256 of its key,
+// and when the cache gets too big the entries that haven't been used for the longest are deleted.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armory/flipdisks/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+var cacheRequests = metrics.NewCounter("flipdisk_cache_requests_total",
+	"Cache lookups, by kind of entry and if it was there.", "kind", "result")
+
+// Cache is a directory of entries. A nil *Cache is a cache that's turned off, nothing is ever in it.
+type Cache struct {
+	dir string
+
+	mutex    sync.Mutex
+	maxBytes int64
+	size     int64
+	entries  map[string]*entry // by file name
+}
+
+type entry struct {
+	name string
+	size int64
+	used time.Time // the file's modification time, so the order survives a restart
+}
+
+// New opens the cache in dir, creating it if it has to. Entries from before are kept.
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.New("couldn't create cache dir: " + err.Error())
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.New("couldn't read cache dir: " + err.Error())
+	}
+
+	c := Cache{dir: dir, maxBytes: maxBytes, entries: map[string]*entry{}}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(f.Name(), ".tmp-") { // left behind by a crash in the middle of a Put
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		c.entries[f.Name()] = &entry{name: f.Name(), size: f.Size(), used: f.ModTime()}
+		c.size += f.Size()
+	}
+
+	c.mutex.Lock()
+	c.evict()
+	c.mutex.Unlock()
+
+	log.Infof("cache %s has %d entries, %d bytes", dir, len(c.entries), c.size)
+	return &c, nil
+}
+
+// fileName is where an entry goes, the kind is kept in the name so the cache dir can be looked through
+func fileName(kind, key string) string {
+	sum := sha256.Sum256([]byte(kind + "\x00" + key))
+	return kind + "-" + hex.EncodeToString(sum[:])
+}
+
+// Get returns the entry for the key, kind is what sort of entry it is, e.g. download
+func (c *Cache) Get(kind, key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	name := fileName(kind, key)
+	e, exists := c.entries[name]
+	if !exists {
+		cacheRequests.Inc(kind, "miss")
+		return nil, false
+	}
+
+	path := filepath.Join(c.dir, name)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Warn("couldn't read cache entry: " + err.Error())
+		c.remove(e)
+		cacheRequests.Inc(kind, "miss")
+		return nil, false
+	}
+
+	e.used = time.Now()
+	if err := os.Chtimes(path, e.used, e.used); err != nil {
+		log.Warn("couldn't mark cache entry as used: " + err.Error())
+	}
+
+	cacheRequests.Inc(kind, "hit")
+	return data, true
+}
+
+// Put saves the entry for the key, and makes room for it by deleting the least recently used entries.
+// Entries that are bigger than the whole cache aren't saved.
+func (c *Cache) Put(kind, key string, data []byte) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if int64(len(data)) > c.maxBytes {
+		return nil
+	}
+
+	name := fileName(kind, key)
+	path := filepath.Join(c.dir, name)
+
+	// write it somewhere else first, so a crash can't leave half an entry behind
+	tmp, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return errors.New("couldn't save cache entry: " + err.Error())
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.New("couldn't save cache entry: " + err.Error())
+	}
+
+	if old, exists := c.entries[name]; exists {
+		c.size -= old.size
+	}
+	c.entries[name] = &entry{name: name, size: int64(len(data)), used: time.Now()}
+	c.size += int64(len(data))
+
+	c.evict()
+	return nil
+}
+
+// SetMaxBytes changes how big the cache can get, entries are deleted right away if it's too big now
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.maxBytes = maxBytes
+	c.evict()
+}
+
+// evict deletes the least recently used entries until the cache fits, the mutex has to be held
+func (c *Cache) evict() {
+	if c.size <= c.maxBytes {
+		return
+	}
+
+	var byAge []*entry
+	for _, e := range c.entries {
+		byAge = append(byAge, e)
+	}
+	sort.Slice(byAge, func(i, j int) bool { return byAge[i].used.Before(byAge[j].used) })
+
+	for _, e := range byAge {
+		if c.size <= c.maxBytes {
+			break
+		}
+		c.remove(e)
+	}
+}
+
+func (c *Cache) remove(e *entry) {
+	if err := os.Remove(filepath.Join(c.dir, e.name)); err != nil && !os.IsNotExist(err) {
+		log.Warn("couldn't delete cache entry: " + err.Error())
+	}
+	delete(c.entries, e.name)
+	c.size -= e.size
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func tempCache(t *testing.T, maxBytes int64) (*Cache, string) {
+	dir, err := ioutil.TempDir("", "flipdisk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(dir, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, dir
+}
+
+func TestCache(t *testing.T) {
+	c, dir := tempCache(t, 10)
+	defer os.RemoveAll(dir)
+
+	if _, ok := c.Get("download", "a"); ok {
+		t.Error("Expected an empty cache")
+	}
+
+	c.Put("download", "a", []byte("aaaa"))
+	c.Put("download", "b", []byte("bbbb"))
+	if got, ok := c.Get("download", "a"); !ok || string(got) != "aaaa" {
+		t.Errorf("Expected aaaa, got %q", got)
+	}
+	if _, ok := c.Get("frames", "a"); ok {
+		t.Error("Expected kinds to have their own keys")
+	}
+
+	// a was used more recently than b, so b has to go to make room
+	time.Sleep(10 * time.Millisecond)
+	c.Put("download", "c", []byte("cccc"))
+	if _, ok := c.Get("download", "b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get("download", key); !ok {
+			t.Errorf("Expected %s to still be cached", key)
+		}
+	}
+
+	c.Put("download", "huge", []byte("more than ten bytes"))
+	if _, ok := c.Get("download", "huge"); ok {
+		t.Error("Expected an entry bigger than the cache not to be saved")
+	}
+
+	// it's all still there after a restart
+	reopened, err := New(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := reopened.Get("download", "c"); !ok || string(got) != "cccc" {
+		t.Errorf("Expected cccc after reopening, got %q", got)
+	}
+
+	reopened.SetMaxBytes(4)
+	if _, ok := reopened.Get("download", "a"); ok {
+		t.Error("Expected a to be evicted when the cache got smaller")
+	}
+	if _, ok := reopened.Get("download", "c"); !ok {
+		t.Error("Expected c to be kept, it was used last")
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+	if err := c.Put("download", "a", []byte("aaaa")); err != nil {
+		t.Error(err)
+	}
+	if _, ok := c.Get("download", "a"); ok {
+		t.Error("Expected a nil cache to always be empty")
+	}
+	c.SetMaxBytes(1)
+}
@@ -0,0 +1,462 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/armory/flipdisks/pkg/options"
+	"gopkg.in/yaml.v2"
+)
+
+// Environment variables that hold secrets, these win over the credentials file
+const (
+	EnvSlackToken  = "FLIPDISK_SLACK_TOKEN"
+	EnvGithubToken = "FLIPDISK_GITHUB_TOKEN"
+)
+
+// Config is everything the controller needs to start, it's usually read from a yaml file
+type Config struct {
+	Serial SerialConfig `yaml:"serial"`
+	Layout LayoutConfig `yaml:"layout"`
+	Slack  SlackConfig  `yaml:"slack"`
+	Github GithubConfig `yaml:"github"`
+	HTTP   HTTPConfig   `yaml:"http"`
+
+	DbPath string `yaml:"dbPath"`
+
+	// Cache keeps downloaded images and their rendered frames on disk, so they start instantly the next time
+	Cache CacheConfig `yaml:"cache"`
+
+	// Fetch limits the images and gifs that can be downloaded, anyone in slack can send the board a url
+	Fetch FetchConfig `yaml:"fetch"`
+
+	// FontsDir has .bdf fonts to load on top of the built in TI84 font, it's fine if it doesn't exist
+	FontsDir string `yaml:"fontsDir"`
+
+	// ReplacementGlyph is drawn for characters a font doesn't have, after trying the letter without its accent
+	ReplacementGlyph string `yaml:"replacementGlyph"`
+
+	// QuietHours is when the board shouldn't flip, it's noisy
+	QuietHours QuietHours `yaml:"quietHours"`
+
+	// MinFrameInterval, in ms, is how fast the board can flip every dot. Animations that are faster merge frames
+	// to keep their speed, the board measures how long sending a frame takes too and uses whichever is longer.
+	MinFrameInterval int `yaml:"minFrameInterval"`
+
+	// Idle are the things the board shows when there's nothing in the queue
+	Idle IdleConfig `yaml:"idle"`
+
+	// CredentialsFile is a yaml file with slackToken and githubToken, relative paths are relative to the config file
+	CredentialsFile string `yaml:"credentialsFile"`
+
+	// Defaults are the message options every message starts with
+	Defaults MessageDefaults `yaml:"defaults"`
+}
+
+type SerialConfig struct {
+	Port string `yaml:"port"` // empty string to simulate
+	Baud int    `yaml:"baud"`
+}
+
+// LayoutConfig describes the panels, currently we're only supporting uniform panels, oriented the same way
+type LayoutConfig struct {
+	PanelWidth               int     `yaml:"panelWidth"`
+	PanelHeight              int     `yaml:"panelHeight"`
+	PhysicallyDisplayedWidth int     `yaml:"physicallyDisplayedWidth"`
+	Panels                   [][]int `yaml:"panels"` // panel addresses, row by row
+}
+
+type SlackConfig struct {
+	Token string `yaml:"-"` // secret, only from the environment, credentials file or flags
+
+	// AllowedUsers are the slack user ids that can send to the board, empty allows everyone
+	AllowedUsers []string `yaml:"allowedUsers"`
+}
+
+type GithubConfig struct {
+	Token string `yaml:"-"` // secret, only from the environment, credentials file or flags
+}
+
+// QuietHours is a daily time range in 24h HH:MM, a range like 22:00 - 07:00 goes over midnight.
+// Leaving both empty turns quiet hours off.
+type QuietHours struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+// Enabled is true when both Start and End are set
+func (q QuietHours) Enabled() bool {
+	return q.Start != "" && q.End != ""
+}
+
+// Contains reports if t is during quiet hours
+func (q QuietHours) Contains(t time.Time) bool {
+	if !q.Enabled() {
+		return false
+	}
+
+	start, err := time.Parse("15:04", q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return false
+	}
+
+	minuteOfDay := t.Hour()*60 + t.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+
+	if startMinute <= endMinute {
+		return minuteOfDay >= startMinute && minuteOfDay < endMinute
+	}
+	return minuteOfDay >= startMinute || minuteOfDay < endMinute // goes over midnight
+}
+
+type IdleConfig struct {
+	// Providers is which idle displays can run, currently there's only "countdown"
+	Providers []string `yaml:"providers"`
+}
+
+type CacheConfig struct {
+	Dir          string `yaml:"dir"` // empty string to turn the cache off
+	MaxMegabytes int    `yaml:"maxMegabytes"`
+}
+
+// MaxBytes is MaxMegabytes in bytes
+func (c CacheConfig) MaxBytes() int64 {
+	return int64(c.MaxMegabytes) * 1024 * 1024
+}
+
+type FetchConfig struct {
+	ConnectTimeout int `yaml:"connectTimeout"` // in ms
+	Timeout        int `yaml:"timeout"`        // in ms, for the whole download
+	MaxMegabytes   int `yaml:"maxMegabytes"`
+	MaxPixels      int `yaml:"maxPixels"` // width x height, added up over every frame
+	MaxFrames      int `yaml:"maxFrames"`
+
+	// AllowedHosts can be downloaded from even though they're on a private network, host names, IPs or CIDRs
+	AllowedHosts []string `yaml:"allowedHosts"`
+}
+
+type HTTPConfig struct {
+	Addr string `yaml:"addr"` // serves /metrics, empty string to disable
+}
+
+// MessageDefaults are read on top of options.BuiltinDefaultOptions, so a config only needs what it changes
+type MessageDefaults options.FlipboardMessageOptions
+
+func (d *MessageDefaults) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	opts, err := options.UnmarshalDefaultOptions(unmarshal)
+	if err != nil {
+		return err
+	}
+	*d = MessageDefaults(opts)
+	return nil
+}
+
+type credentials struct {
+	SlackToken  string `yaml:"slackToken"`
+	GithubToken string `yaml:"githubToken"`
+}
+
+// Default is the config of our board at the office, used for anything the config file doesn't set
+func Default() Config {
+	return Config{
+		Serial: SerialConfig{
+			Port: "/dev/tty.SLAB_USBtoUART",
+			Baud: 9600,
+		},
+		Layout: LayoutConfig{
+			PanelWidth:               28,
+			PanelHeight:              7,
+			PhysicallyDisplayedWidth: 7,
+			Panels: [][]int{
+				{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+				{10, 11, 12, 13, 14, 15, 16, 17, 18, 19},
+			},
+		},
+		HTTP: HTTPConfig{
+			Addr: ":9110",
+		},
+		DbPath:   "db.json",
+		FontsDir: "fonts",
+		Cache: CacheConfig{
+			Dir:          "cache",
+			MaxMegabytes: 200,
+		},
+		Fetch: FetchConfig{
+			ConnectTimeout: 5000,
+			Timeout:        30000,
+			MaxMegabytes:   20,
+			MaxPixels:      25000000,
+			MaxFrames:      1000,
+		},
+
+		ReplacementGlyph: "?", // the same as fontmap's
+		MinFrameInterval: 100,
+		Idle: IdleConfig{
+			Providers: []string{"countdown"},
+		},
+		Defaults: MessageDefaults(options.BuiltinDefaultOptions()),
+	}
+}
+
+// Load reads the config file on top of the Default config, then fills in the secrets.
+// An empty path will only use the defaults and the environment.
+func Load(path string) (Config, error) {
+	c := Default()
+
+	if path != "" {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return c, errors.New("couldn't read config: " + err.Error())
+		}
+
+		if err := yaml.UnmarshalStrict(raw, &c); err != nil {
+			return c, errors.New("couldn't parse config " + path + ": " + err.Error())
+		}
+	}
+
+	if c.CredentialsFile != "" {
+		credentialsPath := c.CredentialsFile
+		if !filepath.IsAbs(credentialsPath) && path != "" {
+			credentialsPath = filepath.Join(filepath.Dir(path), credentialsPath)
+		}
+
+		raw, err := ioutil.ReadFile(credentialsPath)
+		if err != nil {
+			return c, errors.New("couldn't read credentials file: " + err.Error())
+		}
+
+		var creds credentials
+		if err := yaml.UnmarshalStrict(raw, &creds); err != nil {
+			return c, errors.New("couldn't parse credentials file " + credentialsPath + ": " + err.Error())
+		}
+		c.Slack.Token = creds.SlackToken
+		c.Github.Token = creds.GithubToken
+	}
+
+	if token := os.Getenv(EnvSlackToken); token != "" {
+		c.Slack.Token = token
+	}
+	if token := os.Getenv(EnvGithubToken); token != "" {
+		c.Github.Token = token
+	}
+
+	return c, nil
+}
+
+// Validate checks that the board can actually be driven with this config. The names only the image and fontmap
+// packages know, like dithers and fonts, are checked by whoever uses them, config doesn't depend on them.
+func (c Config) Validate() error {
+	return Invalid(c.Problems())
+}
+
+// Invalid is the error for a config with the problems, there's no error without any
+func Invalid(problems []string) error {
+	if len(problems) > 0 {
+		return errors.New("invalid config:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// Problems is everything that's wrong with the config, so it can all be fixed at once
+func (c Config) Problems() []string {
+	var problems []string
+
+	if c.Serial.Port != "" && c.Serial.Baud <= 0 {
+		problems = append(problems, "serial.baud must be set when using a serial port")
+	}
+
+	// these are the only amount of columns the panels know how to receive
+	switch c.Layout.PanelWidth {
+	case 7, 14, 28, 56, 112:
+	default:
+		problems = append(problems, fmt.Sprintf("layout.panelWidth %d isn't supported, try 7, 14, 28, 56 or 112", c.Layout.PanelWidth))
+	}
+
+	if c.Layout.PanelHeight <= 0 {
+		problems = append(problems, "layout.panelHeight must be more than 0")
+	}
+	if c.Layout.PhysicallyDisplayedWidth <= 0 {
+		problems = append(problems, "layout.physicallyDisplayedWidth must be more than 0")
+	}
+
+	if len(c.Layout.Panels) == 0 || len(c.Layout.Panels[0]) == 0 {
+		problems = append(problems, "layout.panels needs at least one panel")
+	}
+
+	seen := map[int]bool{}
+	for y, row := range c.Layout.Panels {
+		if len(row) != len(c.Layout.Panels[0]) {
+			problems = append(problems, fmt.Sprintf("layout.panels row %d has %d panels, every row needs %d", y, len(row), len(c.Layout.Panels[0])))
+		}
+
+		for _, address := range row {
+			if address < 0 || address > 254 { // 255 is the broadcast address
+				problems = append(problems, fmt.Sprintf("layout.panels address %d must be between 0 and 254", address))
+			}
+			if seen[address] {
+				problems = append(problems, fmt.Sprintf("layout.panels address %d is used more than once", address))
+			}
+			seen[address] = true
+		}
+	}
+
+	if c.Cache.Dir != "" && c.Cache.MaxMegabytes <= 0 {
+		problems = append(problems, "cache.maxMegabytes must be more than 0, or set cache.dir to \"\" to turn the cache off")
+	}
+
+	for name, limit := range map[string]int{
+		"connectTimeout": c.Fetch.ConnectTimeout,
+		"timeout":        c.Fetch.Timeout,
+		"maxMegabytes":   c.Fetch.MaxMegabytes,
+		"maxPixels":      c.Fetch.MaxPixels,
+		"maxFrames":      c.Fetch.MaxFrames,
+	} {
+		if limit <= 0 {
+			problems = append(problems, "fetch."+name+" must be more than 0")
+		}
+	}
+	for _, host := range c.Fetch.AllowedHosts {
+		if _, _, err := net.ParseCIDR(host); strings.Contains(host, "/") && err != nil {
+			problems = append(problems, fmt.Sprintf("fetch.allowedHosts %q isn't a valid CIDR, it should look like 10.0.0.0/8", host))
+		}
+	}
+
+	if c.MinFrameInterval < 0 {
+		problems = append(problems, "minFrameInterval can't be negative")
+	}
+
+	if c.DbPath == "" {
+		problems = append(problems, "dbPath can't be empty")
+	}
+
+	if (c.QuietHours.Start == "") != (c.QuietHours.End == "") {
+		problems = append(problems, "quietHours needs both a start and an end")
+	}
+	for _, t := range []string{c.QuietHours.Start, c.QuietHours.End} {
+		if _, err := time.Parse("15:04", t); t != "" && err != nil {
+			problems = append(problems, fmt.Sprintf("quietHours time %q should look like 22:00", t))
+		}
+	}
+
+	for _, provider := range c.Idle.Providers {
+		if provider != "countdown" {
+			problems = append(problems, fmt.Sprintf("idle.providers %q is unknown, try countdown", provider))
+		}
+	}
+
+	if c.Defaults.DisplayTime < 0 {
+		problems = append(problems, "defaults.displayTime can't be negative")
+	}
+	if c.Defaults.PageTime < 0 {
+		problems = append(problems, "defaults.page-time can't be negative")
+	}
+	if c.Defaults.BWThreshold != options.ThresholdAuto && (c.Defaults.BWThreshold < 0 || c.Defaults.BWThreshold > 256) {
+		problems = append(problems, "defaults.bwThreshold must be between 0 and 256, or auto")
+	}
+
+	if c.Defaults.FontSize < 0 || c.Defaults.FontSize > options.MaxFontSize {
+		problems = append(problems, fmt.Sprintf("defaults.font-size must be between 1 and %d", options.MaxFontSize))
+	}
+	for _, spacing := range []struct {
+		name  string
+		value int
+	}{{"kerning", c.Defaults.Kerning}, {"line-spacing", c.Defaults.LineSpacing}, {"word-spacing", c.Defaults.WordSpacing}} {
+		if spacing.value < options.MinSpacing || spacing.value > options.MaxSpacing {
+			problems = append(problems, fmt.Sprintf("defaults.%s must be between %d and %d", spacing.name, options.MinSpacing, options.MaxSpacing))
+		}
+	}
+
+	if c.Defaults.Speed < 0 {
+		problems = append(problems, "defaults.speed can't be negative")
+	}
+	if c.Defaults.Loops < 0 {
+		problems = append(problems, "defaults.loops can't be negative")
+	}
+	if c.Defaults.Duration != "" {
+		if d, err := time.ParseDuration(c.Defaults.Duration); err != nil || d <= 0 {
+			problems = append(problems, fmt.Sprintf("defaults.duration %q should be like 20s or 1m30s", c.Defaults.Duration))
+		}
+	}
+
+	switch c.Defaults.TextAlign {
+	case "", "left", "center", "right", "justify":
+	default:
+		problems = append(problems, fmt.Sprintf("defaults.text-align %q is unknown, try left, center, right or justify", c.Defaults.TextAlign))
+	}
+
+	return problems
+}
+
+// Summary is a human readable version of the config with the secrets redacted, safe to log
+func (c Config) Summary() string {
+	var b strings.Builder
+
+	serial := "simulated, no serial port"
+	if c.Serial.Port != "" {
+		serial = fmt.Sprintf("%s @ %d baud", c.Serial.Port, c.Serial.Baud)
+	}
+	fmt.Fprintf(&b, "serial:       %s\n", serial)
+
+	panelsWide := 0
+	if len(c.Layout.Panels) > 0 {
+		panelsWide = len(c.Layout.Panels[0])
+	}
+	fmt.Fprintf(&b, "layout:       %dx%d panels of %dx%d dots (%d displayed), addresses %v\n",
+		len(c.Layout.Panels), panelsWide, c.Layout.PanelWidth, c.Layout.PanelHeight, c.Layout.PhysicallyDisplayedWidth, c.Layout.Panels)
+
+	fmt.Fprintf(&b, "frames:       at least %dms apart\n", c.MinFrameInterval)
+
+	fmt.Fprintf(&b, "slack token:  %s\n", redact(c.Slack.Token))
+	if len(c.Slack.AllowedUsers) > 0 {
+		fmt.Fprintf(&b, "slack users:  %s\n", strings.Join(c.Slack.AllowedUsers, ", "))
+	}
+	fmt.Fprintf(&b, "github token: %s\n", redact(c.Github.Token))
+
+	httpAddr := "disabled"
+	if c.HTTP.Addr != "" {
+		httpAddr = c.HTTP.Addr
+	}
+	fmt.Fprintf(&b, "http:         %s\n", httpAddr)
+	fmt.Fprintf(&b, "db:           %s\n", c.DbPath)
+	if c.Cache.Dir != "" {
+		fmt.Fprintf(&b, "cache:        %s, up to %dMB\n", c.Cache.Dir, c.Cache.MaxMegabytes)
+	} else {
+		fmt.Fprintf(&b, "cache:        disabled\n")
+	}
+	privateHosts := "none"
+	if len(c.Fetch.AllowedHosts) > 0 {
+		privateHosts = strings.Join(c.Fetch.AllowedHosts, ", ")
+	}
+	fmt.Fprintf(&b, "fetch:        up to %dMB, %d pixels and %d frames, in %dms (%dms to connect), private hosts allowed: %s\n",
+		c.Fetch.MaxMegabytes, c.Fetch.MaxPixels, c.Fetch.MaxFrames, c.Fetch.Timeout, c.Fetch.ConnectTimeout, privateHosts)
+	fmt.Fprintf(&b, "fonts:        %s, unknown characters are drawn as %q\n", c.FontsDir, c.ReplacementGlyph)
+
+	if c.QuietHours.Enabled() {
+		fmt.Fprintf(&b, "quiet hours:  %s - %s\n", c.QuietHours.Start, c.QuietHours.End)
+	}
+	fmt.Fprintf(&b, "idle:         %s\n", strings.Join(c.Idle.Providers, ", "))
+
+	d := c.Defaults
+	fmt.Fprintf(&b, "defaults:     displayTime=%dms align=%q inverted=%t bwThreshold=%s fill=%q sendPanelByPanel=%t\n",
+		d.DisplayTime, d.Align, d.Inverted, d.BWThreshold, d.Fill, d.SendPanelByPanel)
+
+	return b.String()
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return "(not set)"
+	}
+	return "(redacted)"
+}
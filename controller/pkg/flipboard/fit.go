@@ -0,0 +1,99 @@
+package flipboard
+
+import (
+	"sort"
+
+	"github.com/armory/flipdisks/pkg/fontmap"
+	"github.com/armory/flipdisks/pkg/options"
+)
+
+// fitCandidate is a font at a scale that FitText can try
+type fitCandidate struct {
+	font  *fontmap.Font
+	scale int
+}
+
+// FitText picks the biggest font and scale where the whole message fits in width x height dots, without
+// breaking any words in half. A message that asks for a font only tries that font at different scales.
+// If nothing fits, it's the smallest font at 1x, and fits is false.
+func FitText(msg *options.FlipboardMessageOptions, width, height int) (font *fontmap.Font, scale int, fits bool) {
+	clamped := *msg
+	clamped.Clamp()
+	msg = &clamped
+
+	candidates := fitCandidates(msg.Font, height)
+	for _, candidate := range candidates {
+		if textFits(msg, candidate, width, height) {
+			return candidate.font, candidate.scale, true
+		}
+	}
+
+	smallest := candidates[len(candidates)-1]
+	return smallest.font, smallest.scale, false
+}
+
+// fitCandidates are the fonts and scales that are short enough for the board, tallest first.
+// At the same height a font that's drawn that big wins over a smaller font that's scaled up.
+func fitCandidates(fontName string, height int) []fitCandidate {
+	var fonts []*fontmap.Font
+	if fontName != "" {
+		fonts = append(fonts, getFont(fontName))
+	} else {
+		for _, name := range fontmap.Names() {
+			if font, exists := fontmap.Get(name); exists && font.Metadata.MaxHeight > 0 {
+				fonts = append(fonts, font)
+			}
+		}
+	}
+
+	var candidates []fitCandidate
+	for _, font := range fonts {
+		candidates = append(candidates, fitCandidate{font: font, scale: 1})
+		for scale := 2; scale <= options.MaxFontSize && fontmap.LineHeight(font, scale) <= height; scale++ {
+			candidates = append(candidates, fitCandidate{font: font, scale: scale})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		iHeight := fontmap.LineHeight(candidates[i].font, candidates[i].scale)
+		jHeight := fontmap.LineHeight(candidates[j].font, candidates[j].scale)
+		if iHeight != jHeight {
+			return iHeight > jHeight
+		}
+		return candidates[i].scale < candidates[j].scale
+	})
+	return candidates
+}
+
+func textFits(msg *options.FlipboardMessageOptions, candidate fitCandidate, width, height int) bool {
+	rendered := renderText(msg, candidate.font, candidate.scale)
+
+	// a word that's wider than the board would get broken in half
+	if widestWord(rendered.letters, fontmap.Graphemes(rendered.text), rendered.layout.Spacing) > width {
+		return false
+	}
+
+	virtualBoard := CreateVirtualBoard(width, 1, rendered.letters, rendered.text, rendered.layout)
+	return len(virtualBoard) <= height && virtualBoard.Width() <= width
+}
+
+// widestWord is how many columns the widest word takes up, with the spacing between its letters
+func widestWord(msgCharsAsDots []fontmap.Letter, chars []string, spacing []int) int {
+	widest, wordWidth := 0, 0
+	for i := 0; i < len(msgCharsAsDots) && i < len(chars); i++ {
+		if fontmap.IsSpace(chars[i]) || fontmap.IsNewline(chars[i]) {
+			wordWidth = 0
+			continue
+		}
+
+		if wordWidth > 0 && i > 0 && i-1 < len(spacing) {
+			wordWidth += spacing[i-1]
+		}
+		wordWidth += msgCharsAsDots[i].Width()
+
+		if wordWidth > widest {
+			widest = wordWidth
+		}
+	}
+	return widest
+}
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/armory/flipdisks/db"
+	"github.com/armory/flipdisks/pkg/config"
 	"github.com/armory/flipdisks/pkg/image"
+	"github.com/armory/flipdisks/pkg/metrics"
 	"github.com/armory/flipdisks/pkg/options"
 	"github.com/armory/flipdisks/pkg/virtualboard"
 	"github.com/kevinawoo/flipdots/panel"
@@ -20,24 +23,51 @@ type Flipboard struct {
 	PanelInfo            PanelInfo
 	PanelAddressesLayout [][]PanelAddress
 	displayQueue         []*options.FlipboardMessageOptions
+	queueMutex           sync.Mutex
 	countdownDate        string
 	newMessage           chan bool
 	msgCurrentlyPlaying  bool
 	displayCountdown     bool
 	db                   *db.Db
+
+	// displayMutex is held while a message is being displayed, so the panels can't be swapped out from under it
+	displayMutex sync.Mutex
+
+	// layoutMutex guards PanelInfo and PanelAddressesLayout for the messages rendered in the background,
+	// layoutVersion goes up every time they're swapped
+	layoutMutex   sync.RWMutex
+	layoutVersion int
+
+	settingsMutex sync.RWMutex
+	quietHours    config.QuietHours
+	idleProviders []string
+
+	// minFrameInterval is how fast the board can flip, measuredFrameInterval is how long sending a frame takes
+	minFrameInterval      time.Duration
+	measuredFrameInterval time.Duration
+
+	// prerenderSlots limits how many queued messages are rendered at once, prerendered has the ones being rendered
+	prerenderSlots chan struct{}
+	prerenderMutex sync.Mutex
+	prerendered    map[*options.FlipboardMessageOptions]*prerender
 }
 
 type Opts func(*Flipboard) error
 
 func NewFlipboard(info PanelInfo, layout [][]PanelAddress, opts ...Opts) (*Flipboard, error) {
-	panels, err := CreatePanels(info, layout)
+	d, err := db.NewDb("db.json", nil)
 	if err != nil {
-		return &Flipboard{}, errors.New("couldn't create panels: " + err.Error())
+		return &Flipboard{}, errors.New("couldn't create db: " + err.Error())
 	}
 
-	d, err := db.NewDb("db.json", nil)
+	return NewFlipboardWithDb(info, layout, d, opts...)
+}
+
+// NewFlipboardWithDb is NewFlipboard, but with settings and history kept in d instead of ./db.json
+func NewFlipboardWithDb(info PanelInfo, layout [][]PanelAddress, d *db.Db, opts ...Opts) (*Flipboard, error) {
+	panels, err := CreatePanels(info, layout)
 	if err != nil {
-		return &Flipboard{}, errors.New("couldn't create db: " + err.Error())
+		return &Flipboard{}, errors.New("couldn't create panels: " + err.Error())
 	}
 
 	board := Flipboard{
@@ -46,8 +76,16 @@ func NewFlipboard(info PanelInfo, layout [][]PanelAddress, opts ...Opts) (*Flipb
 		PanelAddressesLayout: layout,
 		newMessage:           make(chan bool),
 		db:                   d,
+		idleProviders:        config.Default().Idle.Providers,
+		minFrameInterval:     time.Duration(config.Default().MinFrameInterval) * time.Millisecond,
+		prerenderSlots:       make(chan struct{}, prerenderWorkers),
+		prerendered:          map[*options.FlipboardMessageOptions]*prerender{},
 	}
 
+	metrics.NewGaugeFunc("flipdisk_queue_depth", "Messages waiting to be displayed.", func() float64 {
+		return float64(board.queueLength())
+	})
+
 	for _, opt := range opts {
 		err := opt(&board)
 		if err != nil {
@@ -66,7 +104,8 @@ func NewCountdownDate() Opts {
 		fmt.Println("starting countdown clock")
 		go func() {
 			for {
-				if len(flipboard.displayQueue) == 0 && flipboard.msgCurrentlyPlaying == false && flipboard.displayCountdown == true {
+				if flipboard.queueLength() == 0 && flipboard.msgCurrentlyPlaying == false && flipboard.displayCountdown == true &&
+					flipboard.isIdleProviderEnabled("countdown") && !flipboard.InQuietHours(time.Now()) {
 					tick := flipboard.getNextCountdown()
 					flipboard.Enqueue(&tick)
 				}
@@ -80,11 +119,17 @@ func NewCountdownDate() Opts {
 
 func (b *Flipboard) Enqueue(msg *options.FlipboardMessageOptions) {
 	fmt.Printf("Enqueuing Message: %+v\n", msg.Message)
+	b.prerender(msg)
+	b.queueMutex.Lock()
 	b.displayQueue = append(b.displayQueue, msg)
+	b.queueMutex.Unlock()
 	b.newMessage <- true
 }
 
 func (b *Flipboard) dequeue() *options.FlipboardMessageOptions {
+	b.queueMutex.Lock()
+	defer b.queueMutex.Unlock()
+
 	var msg *options.FlipboardMessageOptions
 	if len(b.displayQueue) > 0 {
 		msg, b.displayQueue = b.displayQueue[0], b.displayQueue[1:]
@@ -93,6 +138,13 @@ func (b *Flipboard) dequeue() *options.FlipboardMessageOptions {
 	return msg
 }
 
+// queueLength is how many messages are waiting, it's read by the metrics while Play is taking them off the queue
+func (b *Flipboard) queueLength() int {
+	b.queueMutex.Lock()
+	defer b.queueMutex.Unlock()
+	return len(b.displayQueue)
+}
+
 func Play(board *Flipboard) {
 	log.Info("listening")
 	for {
@@ -102,7 +154,25 @@ func Play(board *Flipboard) {
 			fmt.Println("playing")
 			msg := board.dequeue()
 			fmt.Println("dequeed")
-			DisplayMessageToPanels(board, msg)
+
+			if board.InQuietHours(time.Now()) {
+				board.skipForQuietHours(msg)
+				board.msgCurrentlyPlaying = false
+				continue
+			}
+
+			board.displayMutex.Lock()
+			err := DisplayMessageToPanels(board, msg)
+			board.displayMutex.Unlock()
+
+			if err != nil {
+				// it's skipped, there's nothing to keep on the board
+				log.Error("couldn't display message: " + err.Error())
+				messagesTotal.Inc(messageSource(msg.Source), "failed")
+				board.msgCurrentlyPlaying = false
+				continue
+			}
+			messagesTotal.Inc(messageSource(msg.Source), "displayed")
 
 			fmt.Printf("keeping message displayed for: %dms ...\n", msg.DisplayTime)
 			time.Sleep(time.Millisecond * time.Duration(msg.DisplayTime))
@@ -112,69 +182,243 @@ func Play(board *Flipboard) {
 	}
 }
 
-func DisplayMessageToPanels(board *Flipboard, msg *options.FlipboardMessageOptions) {
+// skipForQuietHours takes a message off the board's hands during quiet hours, the sender is told it won't be shown
+func (b *Flipboard) skipForQuietHours(msg *options.FlipboardMessageOptions) {
+	fmt.Println("quiet hours, not displaying the message")
+	messagesTotal.Inc(messageSource(msg.Source), "quiet")
+	b.forgetPrerender(msg)
+
+	if msg.Reply != nil {
+		b.settingsMutex.RLock()
+		end := b.quietHours.End
+		b.settingsMutex.RUnlock()
+		msg.Reply("Shhh, it's quiet hours until " + end + ", your message won't be shown")
+	}
+}
+
+// Reconfigure swaps in new panels for the layout. It waits for the current message to finish,
+// and the queue is left alone. If the new panels can't be created, the old ones are kept.
+func (b *Flipboard) Reconfigure(info PanelInfo, layout PanelLayout) error {
+	panels, err := CreatePanels(info, layout)
+	if err != nil {
+		return errors.New("couldn't create panels: " + err.Error())
+	}
+
+	b.displayMutex.Lock()
+	defer b.displayMutex.Unlock()
+
+	oldPanels := b.panels
+	b.panels = panels
+	b.layoutMutex.Lock()
+	b.PanelInfo = info
+	b.PanelAddressesLayout = layout
+	b.layoutVersion++
+	b.layoutMutex.Unlock()
+
+	for _, row := range *oldPanels {
+		for _, p := range row {
+			p.Close()
+		}
+	}
+
+	// the queued messages were rendered for the old panels
+	b.restartPrerenders()
+	return nil
+}
+
+// boardLayout is the board's panels at one point in time, messages are rendered for it
+type boardLayout struct {
+	info      PanelInfo
+	addresses [][]PanelAddress
+	version   int
+}
+
+// currentLayout is the layout messages should be rendered for right now, Reconfigure can swap it at any time
+func (b *Flipboard) currentLayout() boardLayout {
+	b.layoutMutex.RLock()
+	defer b.layoutMutex.RUnlock()
+	return boardLayout{info: b.PanelInfo, addresses: b.PanelAddressesLayout, version: b.layoutVersion}
+}
+
+// SetQuietHours changes when the board shouldn't display anything
+func (b *Flipboard) SetQuietHours(q config.QuietHours) {
+	b.settingsMutex.Lock()
+	defer b.settingsMutex.Unlock()
+	b.quietHours = q
+}
+
+// InQuietHours reports if the board should stay still at t
+func (b *Flipboard) InQuietHours(t time.Time) bool {
+	b.settingsMutex.RLock()
+	defer b.settingsMutex.RUnlock()
+	return b.quietHours.Contains(t)
+}
+
+// SetIdleProviders changes what's allowed to be displayed when the queue is empty
+func (b *Flipboard) SetIdleProviders(providers []string) {
+	b.settingsMutex.Lock()
+	defer b.settingsMutex.Unlock()
+	b.idleProviders = providers
+}
+
+func (b *Flipboard) isIdleProviderEnabled(name string) bool {
+	b.settingsMutex.RLock()
+	defer b.settingsMutex.RUnlock()
+
+	for _, provider := range b.idleProviders {
+		if provider == name {
+			return true
+		}
+	}
+	return false
+}
+
+func DisplayMessageToPanels(board *Flipboard, msg *options.FlipboardMessageOptions) error {
 	if msg.Message == "debug all panels" || msg.Message == "debug panels" {
 		msg.DisplayTime = 0
 		board.DebugPanelAddressByGoingInOrder()
-		return
+		return nil
 	}
 	if strings.Contains(msg.Message, "debug panel") {
 		panelAddress, _ := strconv.Atoi(strings.Replace(msg.Message, "debug panel ", "", -1))
 		msg.DisplayTime = 0
 		board.DebugSinglePanel(panelAddress)
-		return
+		return nil
 	}
 
 	// we got a virtualBoard yay! Lets just display it!
 	if msg.VirtualBoard != nil {
 		displayVirtualBoardToPhysicalBoard(msg, msg.VirtualBoard, board)
-		return
+		return nil
+	}
+
+	rendered, err := board.rendered(msg)
+	if err != nil {
+		return err
 	}
+	return displayRendered(msg, rendered, board)
+}
 
-	maxWidth := uint(board.PanelInfo.PanelHeight * len(board.PanelAddressesLayout[0]))
-	maxHeight := uint(board.PanelInfo.PanelWidth * len(board.PanelAddressesLayout))
+// renderedMessage is a message that's been downloaded and turned into dots, ready to go on the board
+type renderedMessage struct {
+	pages  textPages             // text, with or without inline images
+	media  []*image.FlipboardGif // gifs and images, they're shown one after another
+	layout boardLayout           // what it was rendered for
+}
 
-	fmt.Printf("Enqueuing Message: %+v\n", msg.Message)
+// renderMessage downloads and converts everything the message needs for the layout, nothing is put on the board
+func renderMessage(msg *options.FlipboardMessageOptions, layout boardLayout) (*renderedMessage, error) {
+	maxWidth := uint(layout.info.PanelHeight * len(layout.addresses[0]))
+	maxHeight := uint(layout.info.PanelWidth * len(layout.addresses))
+
+	// what's at the url decides how it's shown, not its extension
+	var gifUrls, plainUrls []string
+	for _, url := range image.FindUrls(msg.Message) {
+		switch image.UrlKind(url) {
+		case image.KindGif:
+			gifUrls = append(gifUrls, url)
+		case image.KindImage:
+			plainUrls = append(plainUrls, url)
+		}
+	}
 
-	gifUrls := image.GetGifUrl(msg.Message)
-	plainUrls := image.GetPlainImageUrl(msg.Message)
-	if gifUrls != nil {
+	fit, err := image.NewFit(msg.Fit, msg.Focus, msg.Crop)
+	if err != nil && (gifUrls != nil || plainUrls != nil) {
+		return nil, errors.New("could not fit the image: " + err.Error())
+	}
+	if gifUrls != nil && !image.IsPlayback(msg.Playback) {
+		return nil, fmt.Errorf("playback %q is unknown, try %s", msg.Playback, strings.Join(image.Playbacks, ", "))
+	}
+	if (gifUrls != nil || plainUrls != nil) && !image.IsSpeed(msg.Speed) {
+		return nil, fmt.Errorf("speed %v should be a number above 0, like 0.5 or 2", msg.Speed)
+	}
+
+	rendered := renderedMessage{layout: layout}
+	if isInlineMessage(msg) {
+		// text with images in it, e.g. "Congrats :tada: Sam"
+		renderStart := time.Now()
+		rendered.pages = renderTextToPages(msg, layout)
+		renderSeconds.Observe(time.Since(renderStart).Seconds(), "inline")
+	} else if gifUrls != nil {
 		for _, gifUrl := range gifUrls {
 			fmt.Println("Got gif! rendering...")
 
-			msg.DisplayTime = 0 // we'll be controlling the frame display time
-			frames, err := image.ConvertGifFromURLToVirtualBoard(gifUrl, maxWidth, maxHeight, msg.Inverted, msg.BWThreshold)
+			renderStart := time.Now()
+			frames, err := image.ConvertGifFromURLToVirtualBoard(gifUrl, maxWidth, maxHeight, msg.Inverted, int(msg.BWThreshold), msg.Dither, fit)
+			renderSeconds.Observe(time.Since(renderStart).Seconds(), "gif")
 			if err != nil {
-				log.Error("could not convert gif to virtualboard", err)
-			}
-
-			for frameIndex, frame := range frames.Flipboards {
-				frameDuration := frames.Delay[frameIndex]
-
-				msg.SendPanelByPanel = false // gifs should refresh the whole screen at once
-
-				// a gif really is 1 "message", so we're not going to enqueue it, because someone else could put in a random message in it
-				displayVirtualBoardToPhysicalBoard(msg, frame, board)
-
-				time.Sleep(frameDuration)
-				//time.Sleep(1 * time.Second)
+				return nil, errors.New("could not convert gif to virtualboard: " + err.Error())
 			}
+			replyWithThreshold(msg, gifUrl, frames.BWThreshold)
+			rendered.media = append(rendered.media, frames)
 		}
 	} else if plainUrls != nil {
 		for _, plainUrl := range plainUrls {
-			v := image.ConvertImageUrlToVirtualBoard(maxWidth, maxHeight, plainUrl, msg.Inverted, msg.BWThreshold)
-			displayVirtualBoardToPhysicalBoard(msg, v, board)
+			renderStart := time.Now()
+			frames, err := image.ConvertUrlToFrames(plainUrl, maxWidth, maxHeight, msg.Inverted, int(msg.BWThreshold), msg.Dither, fit)
+			renderSeconds.Observe(time.Since(renderStart).Seconds(), "image")
+			if err != nil {
+				return nil, errors.New("could not convert image to virtualboard: " + err.Error())
+			}
+			replyWithThreshold(msg, plainUrl, frames.BWThreshold)
+			rendered.media = append(rendered.media, frames)
 		}
 	} else { // plain text
-		v := renderTextToVirtualBoard(msg, board)
-		displayVirtualBoardToPhysicalBoard(msg, v, board)
+		renderStart := time.Now()
+		rendered.pages = renderTextToPages(msg, layout)
+		renderSeconds.Observe(time.Since(renderStart).Seconds(), "text")
+	}
+
+	return &rendered, nil
+}
+
+// displayRendered puts a rendered message on the board, animations play until they're done
+func displayRendered(msg *options.FlipboardMessageOptions, rendered *renderedMessage, board *Flipboard) error {
+	if rendered.media == nil {
+		displayPages(msg, rendered.pages, board)
+		return nil
+	}
+
+	animated := false
+	for _, frames := range rendered.media {
+		if len(frames.Flipboards) == 1 {
+			displayVirtualBoardToPhysicalBoard(msg, frames.Flipboards[0], board)
+			continue
+		}
+
+		msg.SendPanelByPanel = false // gifs should refresh the whole screen at once
+
+		// a gif really is 1 "message", so we're not going to enqueue it, because someone else could put in a random message in it
+		if err := playGif(msg, frames, board); err != nil {
+			return errors.New("could not play gif: " + err.Error())
+		}
+		animated = true
+	}
+
+	if animated {
+		msg.DisplayTime = 0 // the gifs already looped for the display time
 	}
+	return nil
+}
+
+// replyWithThreshold tells the sender which threshold bwThreshold: auto picked, so they can use it again
+func replyWithThreshold(msg *options.FlipboardMessageOptions, imageUrl string, threshold int) {
+	if msg.BWThreshold != options.ThresholdAuto || msg.Reply == nil {
+		return
+	}
+	msg.Reply(fmt.Sprintf("bwThreshold: auto picked %d for %s, use `bwThreshold: %d` to keep it", threshold, imageUrl, threshold))
 }
 
 func displayVirtualBoardToPhysicalBoard(msg *options.FlipboardMessageOptions, vBoardPointer *virtualboard.VirtualBoard, board *Flipboard) {
+	drawVirtualBoard(msg, vBoardPointer, board)
+	sendPanels(msg, board)
+}
+
+// drawVirtualBoard sets the dots on the panels without sending them, it returns the fill of the board
+func drawVirtualBoard(msg *options.FlipboardMessageOptions, vBoardPointer *virtualboard.VirtualBoard, board *Flipboard) bool {
 	virtualBoard := *vBoardPointer
 
-	setPhysicalBoardFill(msg, virtualBoard, board)
+	fill := setPhysicalBoardFill(msg, virtualBoard, board)
 
 	// set alignment options
 	msg.XAlign, msg.YAlign = options.GetAlignOptions(msg.Align)
@@ -220,7 +464,11 @@ func displayVirtualBoardToPhysicalBoard(msg *options.FlipboardMessageOptions, vB
 		}
 	}
 
-	// send our virtual panels to the physical virtualBoard
+	return fill
+}
+
+// sendPanels sends our virtual panels to the physical board
+func sendPanels(msg *options.FlipboardMessageOptions, board *Flipboard) {
 	if msg.SendPanelByPanel {
 		board.SendPanelByPanel()
 	} else {
@@ -228,10 +476,10 @@ func displayVirtualBoardToPhysicalBoard(msg *options.FlipboardMessageOptions, vB
 	}
 }
 
-func setPhysicalBoardFill(msg *options.FlipboardMessageOptions, virtualBoard virtualboard.VirtualBoard, board *Flipboard) {
+func setPhysicalBoardFill(msg *options.FlipboardMessageOptions, virtualBoard virtualboard.VirtualBoard, board *Flipboard) bool {
 	fill := msg.Fill == "true"
 	// if no fill is provided, let's try to set autofill
-	if msg.Fill == "" {
+	if msg.Fill == "" && len(virtualBoard) > 0 {
 		var sum int
 
 		// Go across the top to add up all the values
@@ -264,6 +512,7 @@ func setPhysicalBoardFill(msg *options.FlipboardMessageOptions, virtualBoard vir
 	}
 	// set the fill value
 	board.SetAll(fill)
+	return fill
 }
 
 func findOffSets(options *options.FlipboardMessageOptions, vBoardPointer *virtualboard.VirtualBoard, boardWidth, boardHeight int) (int, int) {
@@ -274,10 +523,9 @@ func findOffSets(options *options.FlipboardMessageOptions, vBoardPointer *virtua
 	case "left":
 		xOffSet = 0
 	case "center":
-		xOffSet = (boardWidth - len(virtualBoard[0])) / 2
-		fmt.Println(xOffSet)
+		xOffSet = (boardWidth - virtualBoard.Width()) / 2
 	case "right":
-		xOffSet = boardWidth - len(virtualBoard[0])
+		xOffSet = boardWidth - virtualBoard.Width()
 	default:
 		xOffSet, _ = strconv.Atoi(options.XAlign)
 	}
@@ -317,6 +565,7 @@ func (b *Flipboard) getNextCountdown() options.FlipboardMessageOptions {
 		Message:     fmt.Sprintf("HORIZON EVENT\n%d:%02d:%02d:%02d", days, hours, mins, secs),
 		DisplayTime: 0, // the NewCountdownDate option controls the timing
 		Align:       "center center",
+		Source:      "countdown",
 	}
 	return msg
 }
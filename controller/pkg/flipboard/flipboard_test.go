@@ -0,0 +1,62 @@
+package flipboard
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/armory/flipdisks/pkg/config"
+	"github.com/armory/flipdisks/pkg/options"
+	"github.com/armory/flipdisks/pkg/virtualboard"
+)
+
+func TestSkipForQuietHoursTellsTheSender(t *testing.T) {
+	board := testPrerenderBoard()
+	board.SetQuietHours(config.QuietHours{Start: "22:00", End: "07:00"})
+
+	var replies []string
+	msg := options.GetDefaultOptions()
+	msg.Message = "hello"
+	msg.Reply = func(note string) { replies = append(replies, note) }
+	board.prerender(&msg)
+
+	board.skipForQuietHours(&msg)
+
+	if len(replies) != 1 || !strings.Contains(replies[0], "07:00") {
+		t.Errorf("Expected the sender to be told when quiet hours end, got %q", replies)
+	}
+	if len(board.prerendered) != 0 {
+		t.Errorf("Expected the prerender to be forgotten, %d are left", len(board.prerendered))
+	}
+}
+
+// run with -race, the metrics read the queue length while messages are added and taken off
+func TestQueueLengthWhilePlaying(t *testing.T) {
+	board := testPrerenderBoard()
+	board.newMessage = make(chan bool)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			<-board.newMessage
+			board.dequeue()
+		}
+	}()
+	go func() {
+		for i := 0; i < 50; i++ {
+			board.Enqueue(&options.FlipboardMessageOptions{VirtualBoard: &virtualboard.VirtualBoard{}})
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			if length := board.queueLength(); length != 0 {
+				t.Errorf("Expected the queue to be empty, %d are left", length)
+			}
+			return
+		default:
+			board.queueLength()
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package flipboard
+
+import (
+	"errors"
+
+	"github.com/armory/flipdisks/db"
+	"github.com/armory/flipdisks/pkg/options"
+	log "github.com/sirupsen/logrus"
+)
+
+// RecordHistory saves the message so it can be replayed later, it returns the history id
+func RecordHistory(board *Flipboard, msg options.FlipboardMessageOptions) int {
+	id, err := db.HistoryWrite(board.db, msg)
+	if err != nil {
+		log.Error("couldn't record message history: " + err.Error())
+	}
+	return id
+}
+
+// GetHistory returns the newest messages that were played, newest first
+func GetHistory(board *Flipboard, count int) []db.HistoryEntry {
+	return db.HistoryRecent(board.db, count)
+}
+
+// Replay will enqueue a message from the history, with the options it was originally played with.
+// A historyId of 0 will replay the last message.
+func Replay(board *Flipboard, historyId int) (options.FlipboardMessageOptions, error) {
+	var entry db.HistoryEntry
+	var err error
+
+	if historyId == 0 {
+		entry, err = db.HistoryLast(board.db)
+	} else {
+		entry, err = db.HistoryRead(board.db, historyId)
+	}
+	if err != nil {
+		return options.FlipboardMessageOptions{}, err
+	}
+
+	msg := entry.Options
+	msg.Source = "replay"
+	board.Enqueue(&msg)
+	return msg, nil
+}
+
+// SaveFavorite stores a message from the history under name. A historyId of 0 will save the last message.
+func SaveFavorite(board *Flipboard, name string, historyId int) error {
+	var entry db.HistoryEntry
+	var err error
+
+	if historyId == 0 {
+		entry, err = db.HistoryLast(board.db)
+	} else {
+		entry, err = db.HistoryRead(board.db, historyId)
+	}
+	if err != nil {
+		return err
+	}
+
+	return db.FavoriteWrite(board.db, name, entry.Options)
+}
+
+// PlayFavorite will enqueue the message saved under name
+func PlayFavorite(board *Flipboard, name string) (options.FlipboardMessageOptions, error) {
+	fav, err := db.FavoriteRead(board.db, name)
+	if err != nil {
+		return options.FlipboardMessageOptions{}, err
+	}
+
+	msg := fav.Options
+	msg.Source = "favorite"
+	board.Enqueue(&msg)
+	return msg, nil
+}
+
+// DeleteFavorite removes the favorite saved under name
+func DeleteFavorite(board *Flipboard, name string) error {
+	if name == "" {
+		return errors.New("favorites need a name")
+	}
+	return db.FavoriteDelete(board.db, name)
+}
+
+// ListFavorites returns the names of all the saved favorites
+func ListFavorites(board *Flipboard) []string {
+	return db.FavoritesList(board.db)
+}
@@ -0,0 +1,107 @@
+package flipboard
+
+import (
+	"strings"
+	"time"
+
+	"github.com/armory/flipdisks/pkg/fontmap"
+	"github.com/armory/flipdisks/pkg/image"
+	"github.com/armory/flipdisks/pkg/options"
+	log "github.com/sirupsen/logrus"
+)
+
+// objectReplacement is the unicode character for "something that isn't text goes here", it's where inline images go
+const objectReplacement = "\ufffc"
+
+// splitInlineImages finds the image urls in the message, e.g. the ones slack emojis are turned into, and swaps
+// each of them for an objectReplacement so the text can be laid out around them. Links that aren't images stay text.
+func splitInlineImages(message string) (string, []string) {
+	message = strings.Replace(message, objectReplacement, "", -1)
+
+	var text strings.Builder
+	var imageUrls []string
+	last := 0
+	for _, match := range image.FindUrlIndexes(message) {
+		url := message[match[0]:match[1]]
+		if image.UrlKind(url) == image.KindOther {
+			continue
+		}
+
+		text.WriteString(message[last:match[0]])
+		text.WriteString(objectReplacement)
+		imageUrls = append(imageUrls, url)
+		last = match[1]
+	}
+	text.WriteString(message[last:])
+
+	return text.String(), imageUrls
+}
+
+// isInlineMessage is true when images should be drawn in the text, instead of taking up the whole board by themselves
+func isInlineMessage(msg *options.FlipboardMessageOptions) bool {
+	text, imageUrls := splitInlineImages(msg.Message)
+	if len(imageUrls) == 0 {
+		return false
+	}
+
+	withoutImages := strings.Replace(text, objectReplacement, "", -1)
+	return len(imageUrls) > 1 || strings.TrimSpace(withoutImages) != ""
+}
+
+// inlineFrames are the frames of every inline image in a message, in the order they're in the text
+type inlineFrames struct {
+	images [][]fontmap.Letter
+	delays []time.Duration // how long each frame is shown, they come from the image with the most frames
+}
+
+// renderInlineImages downloads the inline images and scales them to the line height.
+// Images that can't be downloaded are left as the blank square from renderText.
+func renderInlineImages(imageUrls []string, lineHeight int, msg *options.FlipboardMessageOptions) inlineFrames {
+	var frames inlineFrames
+	for _, imageUrl := range imageUrls {
+		converted, err := image.ConvertUrlToInlineFrames(imageUrl, uint(lineHeight), int(msg.BWThreshold), msg.Dither)
+		if err != nil {
+			log.Errorf("couldn't render inline image: %s", err)
+		} else {
+			replyWithThreshold(msg, imageUrl, converted.BWThreshold)
+		}
+
+		var letters []fontmap.Letter
+		for _, frame := range converted.Flipboards {
+			letters = append(letters, fontmap.AddKerning(fontmap.Letter(*frame), 1))
+		}
+		frames.images = append(frames.images, letters)
+
+		if len(letters) > 1 && len(letters) > len(frames.delays) {
+			frames.delays = converted.Delay
+		}
+	}
+	return frames
+}
+
+// count is how many frames it takes to play the longest animation, still images are a single frame
+func (frames inlineFrames) count() int {
+	if len(frames.delays) == 0 {
+		return 1
+	}
+	return len(frames.delays)
+}
+
+// placeInto returns a copy of the letters with every objectReplacement swapped for its inline image.
+// Shorter animations loop while the longest one plays.
+func (frames inlineFrames) placeInto(msgCharsAsDots []fontmap.Letter, chars []string, frameIndex int) []fontmap.Letter {
+	placed := append([]fontmap.Letter{}, msgCharsAsDots...)
+
+	imageIndex := 0
+	for i, char := range chars {
+		if char != objectReplacement || i >= len(placed) {
+			continue
+		}
+		if imageIndex < len(frames.images) && len(frames.images[imageIndex]) > 0 {
+			imageFrames := frames.images[imageIndex]
+			placed[i] = imageFrames[frameIndex%len(imageFrames)]
+		}
+		imageIndex++
+	}
+	return placed
+}
@@ -0,0 +1,106 @@
+package flipboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/armory/flipdisks/pkg/fontmap"
+	"github.com/armory/flipdisks/pkg/options"
+)
+
+// the urls in these tests can't be reached, so what they are comes from their extension
+func TestSplitInlineImages(t *testing.T) {
+	tests := map[string]struct {
+		message    string
+		expectText string
+		expectUrls []string
+	}{
+		"emoji in the middle": {
+			message:    "Congrats https://a.invalid/tada.gif Sam",
+			expectText: "Congrats " + objectReplacement + " Sam",
+			expectUrls: []string{"https://a.invalid/tada.gif"},
+		},
+		"emojis next to each other": {
+			message:    "yay https://a.invalid/tada.gif?v=1https://a.invalid/cake.png!",
+			expectText: "yay " + objectReplacement + objectReplacement + "!",
+			expectUrls: []string{"https://a.invalid/tada.gif?v=1", "https://a.invalid/cake.png"},
+		},
+		"links that aren't images stay text": {
+			message:    "see http://a.invalid/page.html",
+			expectText: "see http://a.invalid/page.html",
+		},
+		"no urls": {
+			message:    "lunch " + objectReplacement,
+			expectText: "lunch ",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			text, urls := splitInlineImages(test.message)
+			if text != test.expectText || !reflect.DeepEqual(test.expectUrls, urls) {
+				t.Errorf("Expected %q %q, but got %q %q", test.expectText, test.expectUrls, text, urls)
+			}
+		})
+	}
+}
+
+func TestSplitInlineImagesWithoutExtensions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/page" {
+			w.Write([]byte("<html><body>hi</body></html>"))
+			return
+		}
+		http.ServeFile(w, r, "../image/test_fixtures/fast_parrot.gif")
+	}))
+	defer server.Close()
+	defer allowTestServers()()
+
+	text, urls := splitInlineImages("Congrats " + server.URL + "/emoji/tada Sam, see " + server.URL + "/page")
+	if expected := "Congrats " + objectReplacement + " Sam, see " + server.URL + "/page"; text != expected {
+		t.Errorf("Expected %q, but got %q", expected, text)
+	}
+	if !reflect.DeepEqual(urls, []string{server.URL + "/emoji/tada"}) {
+		t.Errorf("Expected only the image to be inline, got %q", urls)
+	}
+}
+
+func TestIsInlineMessage(t *testing.T) {
+	tests := map[string]bool{
+		"Congrats https://a.invalid/tada.gif Sam":              true,
+		"https://a.invalid/tada.gifhttps://a.invalid/tada.gif": true,
+		"https://a.invalid/tada.gif":                           false,
+		"  https://a.invalid/armory.jpg\n":                     false,
+		"just text":                                            false,
+		"a link to a page https://a.invalid/index.html":        false,
+		"it's https://a.invalid/pizza.png o'clock, come get":   true,
+	}
+
+	for message, expected := range tests {
+		if got := isInlineMessage(&options.FlipboardMessageOptions{Message: message}); got != expected {
+			t.Errorf("%q: Expected %t, but got %t", message, expected, got)
+		}
+	}
+}
+
+func TestInlineFramesPlaceInto(t *testing.T) {
+	a := fontmap.Letter{{1}}
+	placeholder := fontmap.Letter{{0}}
+	tada := []fontmap.Letter{{{2}}, {{3}}, {{4}}}
+	cake := []fontmap.Letter{{{5}}}
+
+	frames := inlineFrames{images: [][]fontmap.Letter{tada, cake}}
+	chars := []string{"a", objectReplacement, "a", objectReplacement}
+	letters := []fontmap.Letter{a, placeholder, a, placeholder}
+
+	got := frames.placeInto(letters, chars, 4)
+	expected := []fontmap.Letter{a, tada[1], a, cake[0]}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %v, but got %v", expected, got)
+	}
+	if !reflect.DeepEqual(placeholder, letters[1]) {
+		t.Error("placeInto shouldn't change the letters it was given")
+	}
+}
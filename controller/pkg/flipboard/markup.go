@@ -0,0 +1,117 @@
+package flipboard
+
+import (
+	"strings"
+
+	"github.com/armory/flipdisks/pkg/fontmap"
+)
+
+// textStyle is the inline markup that applies to a character
+type textStyle struct {
+	inverted bool
+	bold     bool
+	blink    bool
+}
+
+// markupTags turn a style on or off, e.g. [inv]ON AIR[/inv]
+var markupTags = map[string]func(style *textStyle, on bool){
+	"inv":    func(style *textStyle, on bool) { style.inverted = on },
+	"invert": func(style *textStyle, on bool) { style.inverted = on },
+	"b":      func(style *textStyle, on bool) { style.bold = on },
+	"bold":   func(style *textStyle, on bool) { style.bold = on },
+	"blink":  func(style *textStyle, on bool) { style.blink = on },
+}
+
+// parseMarkup takes the markup out of the text, and returns the style of every grapheme that's left.
+// There's [inv], [b] and [blink] tags, and slack's *bold*. A tag without a closing tag goes to the end of the message,
+// anything that isn't markup stays in the text, e.g. [todo] or 2 * 3 * 4.
+func parseMarkup(text string) (string, []textStyle) {
+	chars := fontmap.Graphemes(text)
+
+	var plain strings.Builder
+	var styles []textStyle
+	var tagStyle textStyle
+	starBoldEnd := -1 // where the closing * of *bold* is
+
+	for i := 0; i < len(chars); i++ {
+		if length, apply, on := markupTag(chars[i:]); length > 0 {
+			apply(&tagStyle, on)
+			i += length - 1
+			continue
+		}
+
+		if chars[i] == "*" {
+			if i == starBoldEnd {
+				starBoldEnd = -1
+				continue
+			}
+			if starBoldEnd < 0 {
+				if end := closingStar(chars, i); end > 0 {
+					starBoldEnd = end
+					continue
+				}
+			}
+		}
+
+		style := tagStyle
+		style.bold = style.bold || starBoldEnd >= 0
+		plain.WriteString(chars[i])
+		styles = append(styles, style)
+	}
+
+	return plain.String(), styles
+}
+
+// markupTag checks if chars starts with a tag like [inv] or [/inv], length is how many graphemes the tag is
+func markupTag(chars []string) (length int, apply func(style *textStyle, on bool), on bool) {
+	if len(chars) < 3 || chars[0] != "[" {
+		return 0, nil, false
+	}
+
+	end := -1
+	for i := 1; i < len(chars) && i < 10; i++ {
+		if chars[i] == "]" {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	name := strings.ToLower(strings.Join(chars[1:end], ""))
+	on = !strings.HasPrefix(name, "/")
+	apply, known := markupTags[strings.TrimPrefix(name, "/")]
+	if !known {
+		return 0, nil, false
+	}
+	return end + 1, apply, on
+}
+
+// closingStar finds the * that closes the one at start, like slack the stars have to hug the words
+// and be on the same line, *this* is bold but 2 * 3 * 4 isn't
+func closingStar(chars []string, start int) int {
+	if start+1 >= len(chars) || fontmap.IsSpace(chars[start+1]) || chars[start+1] == "*" {
+		return -1
+	}
+
+	for i := start + 2; i < len(chars); i++ {
+		if fontmap.IsNewline(chars[i]) {
+			return -1
+		}
+		if chars[i] == "*" && !fontmap.IsSpace(chars[i-1]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasBlink is true when any of the text blinks
+func hasBlink(styles []textStyle) bool {
+	for _, style := range styles {
+		if style.blink {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package flipboard
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMarkup(t *testing.T) {
+	inv := textStyle{inverted: true}
+	bold := textStyle{bold: true}
+	blink := textStyle{blink: true}
+	plain := textStyle{}
+
+	tests := map[string]struct {
+		message      string
+		expectText   string
+		expectStyles []textStyle
+	}{
+		"inverted word": {
+			message:      "[inv]ON[/inv] AIR",
+			expectText:   "ON AIR",
+			expectStyles: []textStyle{inv, inv, plain, plain, plain, plain},
+		},
+		"slack bold": {
+			message:      "a *bc* d",
+			expectText:   "a bc d",
+			expectStyles: []textStyle{plain, plain, bold, bold, plain, plain},
+		},
+		"stars that don't hug words aren't bold": {
+			message:      "2 * 3 * 4",
+			expectText:   "2 * 3 * 4",
+			expectStyles: []textStyle{plain, plain, plain, plain, plain, plain, plain, plain, plain},
+		},
+		"tags without a closing tag go to the end": {
+			message:      "a[BLINK]bc",
+			expectText:   "abc",
+			expectStyles: []textStyle{plain, blink, blink},
+		},
+		"styles mix": {
+			message:      "[inv]*a*[/inv]",
+			expectText:   "a",
+			expectStyles: []textStyle{{inverted: true, bold: true}},
+		},
+		"unknown tags stay in the text": {
+			message:      "[todo] *a",
+			expectText:   "[todo] *a",
+			expectStyles: []textStyle{plain, plain, plain, plain, plain, plain, plain, plain, plain},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			text, styles := parseMarkup(test.message)
+			if text != test.expectText || !reflect.DeepEqual(test.expectStyles, styles) {
+				t.Errorf("Expected %q %v, got %q %v", test.expectText, test.expectStyles, text, styles)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package flipboard
+
+import (
+	"strconv"
+
+	"github.com/armory/flipdisks/pkg/metrics"
+	"github.com/kevinawoo/flipdots/panel"
+)
+
+var (
+	messagesTotal = metrics.NewCounter("flipdisk_messages_total",
+		"Messages taken off the queue, by where they came from and if they could be displayed.", "source", "outcome")
+
+	renderSeconds = metrics.NewHistogram("flipdisk_render_seconds",
+		"Time spent turning a message into virtual boards, by type of message.", metrics.DefaultSecondsBuckets, "type")
+
+	serialBytesWritten = metrics.NewCounter("flipdisk_serial_bytes_written_total",
+		"Bytes written to the serial port, by panel address, or refresh for the refreshes that show every panel.", "panel")
+
+	panelWriteErrors = metrics.NewCounter("flipdisk_panel_write_errors_total",
+		"Failed or short writes to the serial port, and panels that couldn't be sent at all, by panel address.", "panel")
+
+	framesSkipped = metrics.NewCounter("flipdisk_animation_frames_skipped_total",
+		"Animation frames that were merged into the next one to keep up, because the board couldn't flip as fast as they asked.")
+)
+
+// refreshLabel is the panel label for the bytes that tell every panel to show what was queued
+const refreshLabel = "refresh"
+
+// countingPort keeps track of how much we've written to each panel
+type countingPort struct {
+	panel.SerialPortI
+	panelAddress string
+}
+
+func (p *countingPort) Write(b []byte) (int, error) {
+	n, err := p.SerialPortI.Write(b)
+	serialBytesWritten.Add(float64(n), p.panelAddress)
+	if err != nil || n < len(b) {
+		panelWriteErrors.Inc(p.panelAddress)
+	}
+	return n, err
+}
+
+// refreshPort is the panel's port, but the bytes written to it are counted as a refresh instead of for the panel
+func refreshPort(port panel.SerialPortI) panel.SerialPortI {
+	if counting, ok := port.(*countingPort); ok {
+		return &countingPort{SerialPortI: counting.SerialPortI, panelAddress: refreshLabel}
+	}
+	return port
+}
+
+// canSend is false for panels the library won't send anything to, it only knows a few widths. Those are counted
+// as write errors, nothing ever reaches the port for them.
+func canSend(p panel.Panel) bool {
+	switch p.Width {
+	case 7, 14, 28, 56, 112:
+		return true
+	}
+	if len(p.Address) > 0 {
+		panelWriteErrors.Inc(strconv.Itoa(int(p.Address[0])))
+	}
+	return false
+}
+
+func messageSource(source string) string {
+	if source == "" {
+		return "unknown"
+	}
+	return source
+}
@@ -0,0 +1,59 @@
+package flipboard
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/kevinawoo/flipdots/panel"
+)
+
+// shortPort only takes the first few bytes of every write
+type shortPort struct{ limit int }
+
+func (p *shortPort) Write(b []byte) (int, error) {
+	if len(b) > p.limit {
+		return p.limit, nil
+	}
+	return len(b), nil
+}
+func (p *shortPort) Flush() error { return nil }
+func (p *shortPort) Close() error { return nil }
+
+func TestSendCountsPerPanel(t *testing.T) {
+	port := &shortPort{limit: 1000}
+	newPanel := func(address PanelAddress, width int) panel.Panel {
+		p, _ := panel.NewPanel(width, 7, "", 0)
+		p.Address = []byte{byte(address)}
+		p.Port = &countingPort{SerialPortI: port, panelAddress: strconv.Itoa(int(address))}
+		return *p
+	}
+	board := &Flipboard{panels: &[][]panel.Panel{{newPanel(0, 28), newPanel(1, 28), newPanel(2, 5)}}}
+
+	written := func(label string) float64 { return serialBytesWritten.Get(label) }
+	errors := func(label string) float64 { return panelWriteErrors.Get(label) }
+	before := map[string]float64{"0": written("0"), "1": written("1"), refreshLabel: written(refreshLabel)}
+	unsupportedBefore := errors("2")
+
+	board.SendAllPanelsAtOnce()
+
+	// a queued panel is 0x80, a command, the address, 28 columns and 0x8f, the refresh is 0x80, 0x82 and 0x8f
+	if got := written("0") - before["0"]; got != 32 {
+		t.Errorf("Expected 32 bytes for the first panel, got %v", got)
+	}
+	if got := written("1") - before["1"]; got != 32 {
+		t.Errorf("Expected 32 bytes for the second panel, got %v", got)
+	}
+	if got := written(refreshLabel) - before[refreshLabel]; got != 3 {
+		t.Errorf("Expected 3 bytes for the refresh, got %v", got)
+	}
+	if got := errors("2") - unsupportedBefore; got != 1 {
+		t.Errorf("Expected the panel that's 5 dots wide to be counted as an error, got %v", got)
+	}
+
+	shortBefore := errors("0")
+	port.limit = 10
+	board.SendPanelByPanel()
+	if got := errors("0") - shortBefore; got != 1 {
+		t.Errorf("Expected the short write to be counted as an error, got %v", got)
+	}
+}
@@ -0,0 +1,125 @@
+package flipboard
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armory/flipdisks/pkg/options"
+	"github.com/armory/flipdisks/pkg/virtualboard"
+)
+
+// Paginate splits laid out text into pages that are at most height rows tall, pages only break between lines.
+// Text that fits is a single page.
+func Paginate(virtualBoard virtualboard.VirtualBoard, layout TextLayout, height int) []virtualboard.VirtualBoard {
+	if len(virtualBoard) <= height {
+		return []virtualboard.VirtualBoard{virtualBoard}
+	}
+
+	linePitch := layout.LineHeight + layout.LineSpacing
+	if linePitch < 1 {
+		linePitch = 1
+	}
+
+	// the last line on a page doesn't need the line spacing under it
+	linesPerPage := 1
+	if height > layout.LineHeight {
+		linesPerPage = (height-layout.LineHeight)/linePitch + 1
+	}
+
+	var pages []virtualboard.VirtualBoard
+	for top := 0; top < len(virtualBoard); top += linesPerPage * linePitch {
+		bottom := top + (linesPerPage-1)*linePitch + layout.LineHeight
+		if bottom > len(virtualBoard) {
+			bottom = len(virtualBoard)
+		}
+		pages = append(pages, virtualBoard[top:bottom])
+	}
+	return pages
+}
+
+// pageTime is how long each page is shown, the pages share the DisplayTime unless there's a page-time
+func pageTime(msg *options.FlipboardMessageOptions, pages int) time.Duration {
+	if msg.PageTime > 0 {
+		return time.Duration(msg.PageTime) * time.Millisecond
+	}
+	return time.Duration(msg.DisplayTime) * time.Millisecond / time.Duration(pages)
+}
+
+// textPages is text that's been split into pages, every page has a frame for each frame of its animated inline images
+type textPages struct {
+	pages  [][]virtualboard.VirtualBoard // pages[page][frame]
+	delays []time.Duration               // how long each frame is shown, it's empty when nothing is animated
+}
+
+// displayPages shows the pages one after another. Like a gif, it's all one message, so nothing else
+// can be displayed in between the pages. The last page of still text stays up for its page time, the same way
+// a single page would stay up for the DisplayTime. Animated pages loop until their page time is up.
+func displayPages(msg *options.FlipboardMessageOptions, text textPages, board *Flipboard) {
+	pages := text.pages
+	if len(pages) == 1 && len(text.delays) == 0 {
+		displayVirtualBoardToPhysicalBoard(msg, &pages[0][0], board)
+		return
+	}
+
+	perPage := pageTime(msg, len(pages))
+	for pageIndex, frames := range pages {
+		fmt.Printf("page %d of %d\n", pageIndex+1, len(pages))
+
+		if len(text.delays) == 0 {
+			displayPage(msg, &frames[0], pageIndex, len(pages), board)
+			if pageIndex < len(pages)-1 {
+				time.Sleep(perPage)
+			}
+			continue
+		}
+
+		// play the whole animation at least once, even if the page time is shorter
+		pageStart := time.Now()
+		for played := false; !played || time.Since(pageStart) < perPage; played = true {
+			playAnimation(board, text.delays, func(shown []int) {
+				var boards []*virtualboard.VirtualBoard
+				for _, frame := range shown {
+					boards = append(boards, &frames[frame])
+				}
+				displayPage(msg, mergeFrames(boards), pageIndex, len(pages), board)
+				msg.SendPanelByPanel = false // like gifs, the frames should refresh the whole screen at once
+			})
+		}
+	}
+
+	if len(text.delays) == 0 {
+		msg.SetDisplayTime(perPage)
+	} else {
+		msg.DisplayTime = 0 // the animation already played for its time
+	}
+}
+
+func displayPage(msg *options.FlipboardMessageOptions, page *virtualboard.VirtualBoard, pageIndex, pages int, board *Flipboard) {
+	fill := drawVirtualBoard(msg, page, board)
+	if msg.PageIndicator && pages > 1 {
+		drawPageIndicator(board, pageIndex, pages, !fill)
+	}
+	sendPanels(msg, board)
+}
+
+// drawPageIndicator draws a dot for every page in the bottom right corner of the board, like a progress bar.
+// The pages that have been shown are set to on, the rest are left alone.
+func drawPageIndicator(board *Flipboard, pageIndex, pages int, on bool) {
+	// the library flipped height and width by accident, we'll work around it
+	panelWidth := board.PanelInfo.PanelHeight
+	panelHeight := board.PanelInfo.PanelWidth
+	boardWidth := panelWidth * len(board.PanelAddressesLayout[0])
+	boardHeight := panelHeight * len(board.PanelAddressesLayout)
+
+	y := boardHeight - 1
+	for page := 0; page <= pageIndex; page++ {
+		// every dot has a gap after it, the last page is in the corner
+		x := boardWidth - 1 - (pages-1-page)*2
+		if x < 0 {
+			continue
+		}
+
+		p := board.GetPanel(y/panelHeight, x/panelWidth)
+		p.Set(y%panelHeight, x%panelWidth, on)
+	}
+}
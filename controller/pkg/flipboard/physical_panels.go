@@ -2,8 +2,10 @@ package flipboard
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/armory/flipdisks/pkg/config"
 	"github.com/kevinawoo/flipdots/panel"
 	"github.com/sirupsen/logrus"
 )
@@ -19,6 +21,28 @@ type PanelInfo struct {
 type PanelAddress int
 type PanelLayout [][]PanelAddress
 
+// PanelsFromConfig converts the config's serial and layout sections into what CreatePanels needs
+func PanelsFromConfig(cfg config.Config) (PanelInfo, PanelLayout) {
+	info := PanelInfo{
+		PanelWidth:               cfg.Layout.PanelWidth,
+		PanelHeight:              cfg.Layout.PanelHeight,
+		PhysicallyDisplayedWidth: cfg.Layout.PhysicallyDisplayedWidth,
+		Port:                     cfg.Serial.Port,
+		Baud:                     cfg.Serial.Baud,
+	}
+
+	var layout PanelLayout
+	for _, row := range cfg.Layout.Panels {
+		var addresses []PanelAddress
+		for _, address := range row {
+			addresses = append(addresses, PanelAddress(address))
+		}
+		layout = append(layout, addresses)
+	}
+
+	return info, layout
+}
+
 func CreatePanels(panelInfo PanelInfo, panelLayout PanelLayout) (*[][]panel.Panel, error) {
 	var panels [][]panel.Panel
 
@@ -32,6 +56,9 @@ func CreatePanels(panelInfo PanelInfo, panelLayout PanelLayout) (*[][]panel.Pane
 			}
 
 			p.Address = []byte{byte(panelAddress)}
+			if p.Port != nil {
+				p.Port = &countingPort{SerialPortI: p.Port, panelAddress: strconv.Itoa(int(panelAddress))}
+			}
 
 			panels[y] = append(panels[y], *p)
 		}
@@ -119,6 +146,10 @@ func (b *Flipboard) SendPanelByPanel() () {
 	for y, row := range *b.panels {
 		for x, p := range row {
 			//p.PrintState()
+			if !canSend(p) {
+				logrus.Errorf("could not send to panel (%d,%d): %d dots wide isn't supported", y, x, p.Width)
+				continue
+			}
 			err := p.Send()
 			if err != nil {
 				logrus.Errorf("could not send to panel (%d,%d): %s", y, x, err)
@@ -131,16 +162,18 @@ func (b *Flipboard) SendAllPanelsAtOnce() () {
 	for y, row := range *b.panels {
 		for x, p := range row {
 			//p.PrintState()
+			if !canSend(p) {
+				logrus.Errorf("could not send to panel (%d,%d): %d dots wide isn't supported", y, x, p.Width)
+				continue
+			}
+			// write errors are counted by the panel's countingPort, Queue doesn't give them back to us
 			p.Queue()
-			//err := p.Queue()
-			//if err != nil {
-			//	logrus.Errorf("could not send to panel (%d,%d): %s", y, x, err)
-			//}
-			logrus.Errorf("could not send to panel (%d,%d): %d", y, x, 1)
 		}
 	}
 
+	// the refresh is for every panel, it's sent through the first one's port but it isn't counted for it
 	ps := *b.panels
 	p := ps[0][0]
+	p.Port = refreshPort(p.Port)
 	p.Refresh()
 }
@@ -0,0 +1,201 @@
+package flipboard
+
+import (
+	"errors"
+	"time"
+
+	"github.com/armory/flipdisks/pkg/fontmap"
+	"github.com/armory/flipdisks/pkg/image"
+	"github.com/armory/flipdisks/pkg/options"
+	"github.com/armory/flipdisks/pkg/virtualboard"
+)
+
+// frameSendSmoothing is how slowly the measured frame interval follows the last send, so one slow send
+// doesn't make the next animation merge frames
+const frameSendSmoothing = 4
+
+// SetMinFrameInterval changes how fast the board can flip every dot, animations that are faster merge frames
+func (b *Flipboard) SetMinFrameInterval(interval time.Duration) {
+	b.settingsMutex.Lock()
+	defer b.settingsMutex.Unlock()
+	b.minFrameInterval = interval
+}
+
+// frameInterval is the shortest time a frame can be on the board, the configured interval or the time it takes
+// to send a frame, whichever is longer
+func (b *Flipboard) frameInterval() time.Duration {
+	b.settingsMutex.RLock()
+	defer b.settingsMutex.RUnlock()
+
+	if b.measuredFrameInterval > b.minFrameInterval {
+		return b.measuredFrameInterval
+	}
+	return b.minFrameInterval
+}
+
+// measureFrameSend keeps track of how long sending a whole frame takes
+func (b *Flipboard) measureFrameSend(took time.Duration) {
+	b.settingsMutex.Lock()
+	defer b.settingsMutex.Unlock()
+
+	if b.measuredFrameInterval == 0 {
+		b.measuredFrameInterval = took
+		return
+	}
+	b.measuredFrameInterval += (took - b.measuredFrameInterval) / frameSendSmoothing
+}
+
+// playAnimation shows every frame for its delay. When the frames are faster than the board can flip, the frames
+// that would've come and gone while the board was busy are merged into the next one, so the animation keeps its
+// speed instead of playing in slow motion, and dots that were only up for a moment still show up.
+// show draws and sends the frames, merged, the last one is the frame that's up now.
+func playAnimation(board *Flipboard, delays []time.Duration, show func(frames []int)) {
+	ends := frameEnds(delays)
+	start := time.Now()
+
+	frames := []int{0}
+	for frame := 0; frame < len(delays); {
+		shownAt := time.Since(start)
+		show(frames)
+		board.measureFrameSend(time.Since(start) - shownAt)
+
+		next, at := nextFrame(ends, frame, shownAt, board.frameInterval())
+		if skipped := next - frame - 1; skipped > 0 {
+			framesSkipped.Add(float64(skipped))
+		}
+
+		time.Sleep(at - time.Since(start))
+		frames = frames[:0]
+		for merged := frame + 1; merged <= next; merged++ {
+			frames = append(frames, merged)
+		}
+		frame = next
+	}
+}
+
+// mergeFrames puts frames the board didn't have time for into the last one. Every dot that stands out from the
+// last frame's background, in any of the frames, is kept. A single frame is given back as it is.
+func mergeFrames(frames []*virtualboard.VirtualBoard) *virtualboard.VirtualBoard {
+	last := frames[len(frames)-1]
+	if len(frames) == 1 {
+		return last
+	}
+
+	background := backgroundDot(*last)
+	merged := make(virtualboard.VirtualBoard, len(*last))
+	for y, row := range *last {
+		merged[y] = append(fontmap.Row{}, row...)
+	}
+	for _, frame := range frames[:len(frames)-1] {
+		for y, row := range *frame {
+			for x, dot := range row {
+				if y < len(merged) && x < len(merged[y]) && dot != background {
+					merged[y][x] = dot
+				}
+			}
+		}
+	}
+	return &merged
+}
+
+// backgroundDot is what most of the board's dots are
+func backgroundDot(board virtualboard.VirtualBoard) int {
+	on, total := 0, 0
+	for _, row := range board {
+		for _, dot := range row {
+			on += dot
+			total++
+		}
+	}
+	if on*2 > total {
+		return 1
+	}
+	return 0
+}
+
+// frameEnds is when each frame comes down, from the start of the animation
+func frameEnds(delays []time.Duration) []time.Duration {
+	ends := make([]time.Duration, len(delays))
+	var end time.Duration
+	for i, delay := range delays {
+		end += delay
+		ends[i] = end
+	}
+	return ends
+}
+
+// nextFrame is the frame to show after frame, which went up shownAt into the animation, and when to show it.
+// It's the frame the animation is on by the time the board can flip again, the ones before it are merged into it.
+// When the animation is over, next is len(ends) and at is when the last frame comes down.
+func nextFrame(ends []time.Duration, frame int, shownAt, interval time.Duration) (next int, at time.Duration) {
+	at = ends[frame]
+	if ready := shownAt + interval; ready > at {
+		at = ready
+	}
+
+	next = frame + 1
+	for next < len(ends) && ends[next] <= at {
+		next++
+	}
+	return next, at
+}
+
+// playGif loops the gif for the duration, for the loops, or as many times as the gif itself asks, in that order.
+// A gif that loops forever keeps looping until the DisplayTime is up. Loops are never cut short.
+func playGif(msg *options.FlipboardMessageOptions, gif *image.FlipboardGif, board *Flipboard) error {
+	duration, loops, err := gifPlayTime(msg, gif.LoopCount)
+	if err != nil {
+		return err
+	}
+
+	frames, delays := gif.Loop(msg.Playback, msg.Speed)
+	if len(frames) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	for played := 0; played == 0 || (duration > 0 && time.Since(start) < duration) || played < loops; played++ {
+		playAnimation(board, delays, func(shown []int) {
+			var boards []*virtualboard.VirtualBoard
+			for _, frame := range shown {
+				boards = append(boards, gif.Flipboards[frames[frame]])
+			}
+			displayVirtualBoardToPhysicalBoard(msg, mergeFrames(boards), board)
+		})
+	}
+	return nil
+}
+
+// gifPlayTime is how long a gif should loop for, or when that's 0, how many times it should play.
+// Messages that weren't clamped, like favorites and the http api, are kept to options.MaxDuration and MaxLoops too.
+func gifPlayTime(msg *options.FlipboardMessageOptions, loopCount int) (time.Duration, int, error) {
+	if msg.Duration != "" {
+		duration, err := time.ParseDuration(msg.Duration)
+		if err != nil || duration <= 0 {
+			return 0, 0, errors.New("duration " + msg.Duration + " should be like 20s or 1m30s")
+		}
+		if duration > options.MaxDuration {
+			duration = options.MaxDuration
+		}
+		return duration, 0, nil
+	}
+
+	if msg.Loops < 0 {
+		return 0, 0, errors.New("loops can't be negative")
+	}
+	if msg.Loops > options.MaxLoops {
+		return 0, options.MaxLoops, nil
+	}
+	if msg.Loops > 0 {
+		return 0, msg.Loops, nil
+	}
+
+	switch {
+	case loopCount == 0: // forever
+		return time.Duration(msg.DisplayTime) * time.Millisecond, 1, nil
+	case loopCount < 0:
+		return 0, 1, nil
+	default:
+		return 0, loopCount + 1, nil
+	}
+}
@@ -0,0 +1,212 @@
+package flipboard
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/armory/flipdisks/pkg/options"
+	"github.com/armory/flipdisks/pkg/virtualboard"
+)
+
+func TestNextFrame(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := map[string]struct {
+		delays   []time.Duration
+		interval time.Duration
+
+		expectedFrames []int
+		expectedEnd    time.Duration
+	}{
+		"slower than the board": {
+			delays:         []time.Duration{200 * ms, 200 * ms, 200 * ms},
+			interval:       100 * ms,
+			expectedFrames: []int{0, 1, 2},
+			expectedEnd:    600 * ms,
+		},
+		"twice as fast as the board": {
+			delays:         []time.Duration{50 * ms, 50 * ms, 50 * ms, 50 * ms, 50 * ms, 50 * ms},
+			interval:       100 * ms,
+			expectedFrames: []int{0, 2, 4},
+			expectedEnd:    300 * ms,
+		},
+		"a long frame in the middle of fast ones": {
+			delays:         []time.Duration{20 * ms, 20 * ms, 500 * ms, 20 * ms, 20 * ms},
+			interval:       100 * ms,
+			expectedFrames: []int{0, 2, 3},
+			expectedEnd:    640 * ms,
+		},
+		"the last frame stays until the board can flip": {
+			delays:         []time.Duration{100 * ms, 20 * ms},
+			interval:       100 * ms,
+			expectedFrames: []int{0, 1},
+			expectedEnd:    200 * ms,
+		},
+		"no minimum": {
+			delays:         []time.Duration{20 * ms, 20 * ms, 20 * ms},
+			expectedFrames: []int{0, 1, 2},
+			expectedEnd:    60 * ms,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ends := frameEnds(test.delays)
+
+			// pretend the board shows every frame right on time
+			var shown []int
+			var at time.Duration
+			for frame := 0; frame < len(ends); {
+				shown = append(shown, frame)
+				frame, at = nextFrame(ends, frame, at, test.interval)
+			}
+
+			if !reflect.DeepEqual(test.expectedFrames, shown) {
+				t.Errorf("Expected frames %v, got %v", test.expectedFrames, shown)
+			}
+			if at != test.expectedEnd {
+				t.Errorf("Expected the animation to end at %s, got %s", test.expectedEnd, at)
+			}
+		})
+	}
+}
+
+func TestFrameInterval(t *testing.T) {
+	board := Flipboard{}
+	board.SetMinFrameInterval(100 * time.Millisecond)
+
+	board.measureFrameSend(40 * time.Millisecond)
+	if got := board.frameInterval(); got != 100*time.Millisecond {
+		t.Errorf("Expected the configured interval when sending is faster, got %s", got)
+	}
+
+	board.measureFrameSend(440 * time.Millisecond)
+	if got := board.frameInterval(); got != 140*time.Millisecond {
+		t.Errorf("Expected the measured interval to move a quarter of the way to the slow send, got %s", got)
+	}
+}
+
+func TestGifPlayTime(t *testing.T) {
+	tests := map[string]struct {
+		msg       options.FlipboardMessageOptions
+		loopCount int
+
+		expectedDuration time.Duration
+		expectedLoops    int
+		wantErr          bool
+	}{
+		"a gif that loops forever plays for the display time": {
+			msg:              options.FlipboardMessageOptions{DisplayTime: 5000},
+			expectedDuration: 5 * time.Second,
+			expectedLoops:    1,
+		},
+		"a gif that plays once": {
+			msg:           options.FlipboardMessageOptions{DisplayTime: 5000},
+			loopCount:     -1,
+			expectedLoops: 1,
+		},
+		"a gif that loops twice plays three times": {
+			msg:           options.FlipboardMessageOptions{DisplayTime: 5000},
+			loopCount:     2,
+			expectedLoops: 3,
+		},
+		"loops wins over the gif": {
+			msg:           options.FlipboardMessageOptions{DisplayTime: 5000, Loops: 3},
+			expectedLoops: 3,
+		},
+		"duration wins over loops": {
+			msg:              options.FlipboardMessageOptions{Loops: 3, Duration: "20s"},
+			loopCount:        -1,
+			expectedDuration: 20 * time.Second,
+		},
+		"duration without a unit": {
+			msg:     options.FlipboardMessageOptions{Duration: "20"},
+			wantErr: true,
+		},
+		"negative loops": {
+			msg:     options.FlipboardMessageOptions{Loops: -1},
+			wantErr: true,
+		},
+		"a duration that's too long": {
+			msg:              options.FlipboardMessageOptions{Duration: "100h"},
+			expectedDuration: options.MaxDuration,
+		},
+		"too many loops": {
+			msg:           options.FlipboardMessageOptions{Loops: 1000000},
+			expectedLoops: options.MaxLoops,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			duration, loops, err := gifPlayTime(&test.msg, test.loopCount)
+			if test.wantErr {
+				if err == nil {
+					t.Error("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if duration != test.expectedDuration || loops != test.expectedLoops {
+				t.Errorf("Expected %s and %d loops, got %s and %d loops", test.expectedDuration, test.expectedLoops, duration, loops)
+			}
+		})
+	}
+}
+
+func TestMergeFrames(t *testing.T) {
+	tests := map[string]struct {
+		frames []virtualboard.VirtualBoard
+
+		expected virtualboard.VirtualBoard
+	}{
+		"one frame": {
+			frames:   []virtualboard.VirtualBoard{{{0, 1}, {1, 0}}},
+			expected: virtualboard.VirtualBoard{{0, 1}, {1, 0}},
+		},
+		"a dot that was only up for a moment": {
+			frames: []virtualboard.VirtualBoard{
+				{{0, 0, 0}, {0, 1, 0}},
+				{{1, 0, 0}, {0, 0, 0}},
+			},
+			expected: virtualboard.VirtualBoard{{1, 0, 0}, {0, 1, 0}},
+		},
+		"dark dots on a light background": {
+			frames: []virtualboard.VirtualBoard{
+				{{1, 0, 1}, {1, 1, 1}},
+				{{1, 1, 1}, {1, 1, 0}},
+			},
+			expected: virtualboard.VirtualBoard{{1, 0, 1}, {1, 1, 0}},
+		},
+		"frames that are bigger than the last one": {
+			frames: []virtualboard.VirtualBoard{
+				{{0, 0, 1}, {0, 0, 0}, {1, 1, 1}},
+				{{0, 0}},
+			},
+			expected: virtualboard.VirtualBoard{{0, 0}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var frames []*virtualboard.VirtualBoard
+			for i := range test.frames {
+				frames = append(frames, &test.frames[i])
+			}
+			last := test.frames[len(test.frames)-1]
+			lastBefore := fmt.Sprint(last)
+
+			merged := mergeFrames(frames)
+			if !reflect.DeepEqual(*merged, test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, *merged)
+			}
+			if len(frames) > 1 && fmt.Sprint(last) != lastBefore {
+				t.Error("Expected the frames to be left alone, they're played again on the next loop")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package flipboard
+
+import (
+	"strings"
+
+	"github.com/armory/flipdisks/pkg/options"
+	log "github.com/sirupsen/logrus"
+)
+
+// prerenderWorkers is how many queued messages can be downloaded and rendered at once, the Pi doesn't have much to spare
+const prerenderWorkers = 2
+
+// prerender is a queued message that's being rendered in the background
+type prerender struct {
+	done     chan struct{} // closed when it's rendered, or when it failed
+	rendered *renderedMessage
+	err      error
+}
+
+// prerender starts rendering a message as soon as there's a free worker, so it's ready by the time it's its turn
+func (b *Flipboard) prerender(msg *options.FlipboardMessageOptions) {
+	if b.prerenderSlots == nil || !needsRendering(msg) {
+		return
+	}
+
+	b.prerenderMutex.Lock()
+	defer b.prerenderMutex.Unlock()
+	b.startPrerender(msg)
+}
+
+// startPrerender starts a new render of the message, prerenderMutex has to be held
+func (b *Flipboard) startPrerender(msg *options.FlipboardMessageOptions) {
+	job := &prerender{done: make(chan struct{})}
+	b.prerendered[msg] = job
+
+	go func() {
+		b.prerenderSlots <- struct{}{}
+		defer func() { <-b.prerenderSlots }()
+
+		job.rendered, job.err = renderAndReport(msg, b)
+		close(job.done)
+	}()
+}
+
+// rendered is the message's prerender, it waits for it to finish. Messages that weren't prerendered,
+// or were prerendered for panels that have been swapped out since, are rendered now.
+func (b *Flipboard) rendered(msg *options.FlipboardMessageOptions) (*renderedMessage, error) {
+	b.prerenderMutex.Lock()
+	job, exists := b.prerendered[msg]
+	delete(b.prerendered, msg)
+	b.prerenderMutex.Unlock()
+
+	if !exists {
+		return renderAndReport(msg, b)
+	}
+	<-job.done
+	if job.err == nil && job.rendered.layout.version != b.currentLayout().version {
+		return renderAndReport(msg, b)
+	}
+	return job.rendered, job.err
+}
+
+// restartPrerenders renders the queued messages again, for when the panels have changed.
+// The old renders finish in the background, nothing waits for them.
+func (b *Flipboard) restartPrerenders() {
+	b.prerenderMutex.Lock()
+	defer b.prerenderMutex.Unlock()
+	for msg := range b.prerendered {
+		b.startPrerender(msg)
+	}
+}
+
+// forgetPrerender is for messages that are taken off the queue without being displayed
+func (b *Flipboard) forgetPrerender(msg *options.FlipboardMessageOptions) {
+	b.prerenderMutex.Lock()
+	defer b.prerenderMutex.Unlock()
+	delete(b.prerendered, msg)
+}
+
+// renderAndReport renders the message for the board's current layout,
+// when it can't be rendered the sender is told right away that it'll be skipped
+func renderAndReport(msg *options.FlipboardMessageOptions, board *Flipboard) (*renderedMessage, error) {
+	rendered, err := renderMessage(msg, board.currentLayout())
+	if err != nil {
+		log.Error("couldn't render message, it'll be skipped: " + err.Error())
+		if msg.Reply != nil {
+			msg.Reply("Your message can't be shown, it'll be skipped: " + err.Error())
+		}
+	}
+	return rendered, err
+}
+
+// needsRendering is false for messages that go straight to the board, like the debug messages and virtual boards
+func needsRendering(msg *options.FlipboardMessageOptions) bool {
+	debug := msg.Message == "debug all panels" || strings.Contains(msg.Message, "debug panel")
+	return msg.VirtualBoard == nil && !debug
+}
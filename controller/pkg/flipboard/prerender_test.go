@@ -0,0 +1,174 @@
+package flipboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armory/flipdisks/pkg/image"
+	"github.com/armory/flipdisks/pkg/options"
+)
+
+func testPrerenderBoard() *Flipboard {
+	info := PanelInfo{PanelWidth: 28, PanelHeight: 7}
+	layout := [][]PanelAddress{{0, 1}}
+	panels, _ := CreatePanels(info, layout) // there's no port, so they're debug panels
+	return &Flipboard{
+		panels:               panels,
+		PanelInfo:            info,
+		PanelAddressesLayout: layout,
+		prerenderSlots:       make(chan struct{}, prerenderWorkers),
+		prerendered:          map[*options.FlipboardMessageOptions]*prerender{},
+	}
+}
+
+// allowTestServers lets the board download from httptest servers, they're on loopback.
+// Call the func it returns to put the limits back.
+func allowTestServers() func() {
+	limits := image.DefaultFetchLimits()
+	limits.AllowedHosts = []string{"127.0.0.1"}
+	image.SetFetchLimits(limits)
+	return func() { image.SetFetchLimits(image.DefaultFetchLimits()) }
+}
+
+func TestPrerender(t *testing.T) {
+	var mutex sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	release := make(chan struct{})
+
+	files := http.FileServer(http.Dir("../image/test_fixtures"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+
+		<-release
+		http.StripPrefix("/"+strings.Split(r.URL.Path, "/")[1], files).ServeHTTP(w, r)
+
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+	}))
+	defer server.Close()
+	defer allowTestServers()()
+
+	board := testPrerenderBoard()
+
+	var msgs []*options.FlipboardMessageOptions
+	for i := 0; i < 5; i++ {
+		msg := options.GetDefaultOptions()
+		msg.Message = server.URL + "/" + strconv.Itoa(i) + "/fast_parrot.gif"
+		msgs = append(msgs, &msg)
+		board.prerender(&msg)
+	}
+
+	// give every worker a chance to start before letting the downloads finish
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for _, msg := range msgs {
+		rendered, err := board.rendered(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rendered.media) != 1 || len(rendered.media[0].Flipboards) < 2 {
+			t.Errorf("Expected the gif to be rendered, got %+v", rendered.media)
+		}
+	}
+
+	if maxInFlight > prerenderWorkers {
+		t.Errorf("Expected at most %d messages rendering at once, got %d", prerenderWorkers, maxInFlight)
+	}
+	if len(board.prerendered) != 0 {
+		t.Errorf("Expected every prerender to be taken, %d are left", len(board.prerendered))
+	}
+}
+
+func TestPrerenderFailureIsReported(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	defer allowTestServers()()
+
+	board := testPrerenderBoard()
+
+	replies := make(chan string, 1)
+	msg := options.GetDefaultOptions()
+	msg.Message = server.URL + "/missing.gif"
+	msg.Reply = func(note string) { replies <- note }
+	board.prerender(&msg)
+
+	// the sender hears about it before it's the message's turn
+	select {
+	case reply := <-replies:
+		if !strings.Contains(reply, "skipped") {
+			t.Errorf("Expected the reply to say the message will be skipped, got %q", reply)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a reply about the message that couldn't be rendered")
+	}
+
+	if _, err := board.rendered(&msg); err == nil {
+		t.Error("Expected the message to fail when it's its turn")
+	}
+}
+
+// run with -race, the messages are rendered while the panels are being swapped
+func TestPrerenderWhileReconfiguring(t *testing.T) {
+	board := testPrerenderBoard()
+
+	var msgs []*options.FlipboardMessageOptions
+	for i := 0; i < 20; i++ {
+		msg := options.GetDefaultOptions()
+		msg.Message = "message " + strconv.Itoa(i)
+		msgs = append(msgs, &msg)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			info := PanelInfo{PanelWidth: 28, PanelHeight: 7, PhysicallyDisplayedWidth: 7}
+			if err := board.Reconfigure(info, PanelLayout{make([]PanelAddress, i%3+1)}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for _, msg := range msgs {
+		board.prerender(msg)
+	}
+	<-done
+
+	current := board.currentLayout()
+	for _, msg := range msgs {
+		board.displayMutex.Lock()
+		rendered, err := board.rendered(msg)
+		board.displayMutex.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rendered.layout.version != current.version || len(rendered.layout.addresses[0]) != len(current.addresses[0]) {
+			t.Errorf("Expected %q to be rendered for the last layout, it was rendered for %+v", msg.Message, rendered.layout)
+		}
+	}
+}
+
+func TestNeedsRendering(t *testing.T) {
+	for message, expected := range map[string]bool{
+		"hello":            true,
+		"debug panels":     false,
+		"debug all panels": false,
+		"debug panel 3":    false,
+	} {
+		if got := needsRendering(&options.FlipboardMessageOptions{Message: message}); got != expected {
+			t.Errorf("Expected needsRendering(%q) to be %t, got %t", message, expected, got)
+		}
+	}
+}
@@ -1,103 +1,443 @@
 package flipboard
 
 import (
-	"regexp"
+	"time"
 
 	"github.com/armory/flipdisks/pkg/fontmap"
 	"github.com/armory/flipdisks/pkg/options"
 	"github.com/armory/flipdisks/pkg/virtualboard"
+	log "github.com/sirupsen/logrus"
 )
 
-func renderTextToVirtualBoard(msg *options.FlipboardMessageOptions, board *Flipboard) *virtualboard.VirtualBoard {
-	var virtualBoard virtualboard.VirtualBoard
+// blinkInterval is how long [blink] text is on, and then off
+const blinkInterval = 500 * time.Millisecond
+
+// renderTextToPages lays out the text with its inline images, text that's taller than the board is split into pages.
+// Animated inline images and blinking text get a frame of the whole page for every step of the animation.
+func renderTextToPages(msg *options.FlipboardMessageOptions, layout boardLayout) textPages {
+	width, height := textArea(layout)
+
+	// messages from slack are already clamped, the ones from favorites and the http api might not be
+	clamped := *msg
+	for _, note := range clamped.Clamp() {
+		log.Warn(note)
+		if msg.Reply != nil {
+			msg.Reply(note)
+		}
+	}
+	msg = &clamped
+
+	font, scale := getFont(msg.Font), msg.FontSize
+	if msg.Fit == "auto" {
+		var fits bool
+		font, scale, fits = FitText(msg, width, height)
+		if !fits {
+			log.Warnf("%q doesn't fit on the board, even with the smallest font, it'll be split into pages", msg.Message)
+		}
+	}
+
+	rendered := renderText(msg, font, scale)
+	chars := fontmap.Graphemes(rendered.text)
+	_, imageUrls := splitInlineImages(msg.Message)
+	frames := renderInlineImages(imageUrls, rendered.layout.LineHeight, msg)
 
-	msgCharsAsDots := fontmap.Render(msg.Message)
-	virtualBoard = CreateVirtualBoard(board.PanelInfo.PhysicallyDisplayedWidth, len(board.PanelAddressesLayout[0]), msgCharsAsDots, msg.Message)
-
-	// todo, it would be nice to just invert it without through the whole board again
-	// handle inverting for words
-	if msg.Inverted {
-		for _, row := range virtualBoard {
-			for charIndex, x := range row {
-				if x == 0 {
-					row[charIndex] = 1
-				} else {
-					row[charIndex] = 0
+	delays := frames.delays
+	blinks := hasBlink(rendered.styles)
+	if blinks && len(delays) == 0 {
+		delays = []time.Duration{blinkInterval, blinkInterval}
+	}
+
+	var text textPages
+	text.delays = delays
+
+	var elapsed time.Duration
+	for frameIndex := 0; frameIndex == 0 || frameIndex < len(delays); frameIndex++ {
+		frameCharsAsDots := frames.placeInto(rendered.letters, chars, frameIndex)
+		if blinks && (elapsed/blinkInterval)%2 == 1 {
+			frameCharsAsDots = hideBlinking(frameCharsAsDots, rendered.styles)
+		}
+		if frameIndex < len(delays) {
+			elapsed += delays[frameIndex]
+		}
+
+		virtualBoard := CreateVirtualBoard(layout.info.PhysicallyDisplayedWidth, len(layout.addresses[0]), frameCharsAsDots, rendered.text, rendered.layout)
+
+		// todo, it would be nice to just invert it without through the whole board again
+		// handle inverting for words
+		if msg.Inverted {
+			for _, row := range virtualBoard {
+				for charIndex, x := range row {
+					if x == 0 {
+						row[charIndex] = 1
+					} else {
+						row[charIndex] = 0
+					}
 				}
 			}
 		}
+
+		for pageIndex, page := range Paginate(virtualBoard, rendered.layout, height) {
+			if pageIndex == len(text.pages) {
+				text.pages = append(text.pages, nil)
+			}
+			text.pages[pageIndex] = append(text.pages[pageIndex], page)
+		}
+	}
+
+	return text
+}
+
+// renderedText is a message's letters and how to lay them out
+type renderedText struct {
+	text    string // the message without its markup, with an objectReplacement for every inline image
+	letters []fontmap.Letter
+	styles  []textStyle
+	layout  TextLayout
+}
+
+// renderText renders the letters of the message in font at scale, and how they should be laid out.
+// Inline images are a blank square letter that's as tall as the line, renderInlineImages draws them.
+func renderText(msg *options.FlipboardMessageOptions, font *fontmap.Font, scale int) renderedText {
+	text, _ := splitInlineImages(msg.Message)
+	text, styles := parseMarkup(text)
+	chars := fontmap.Graphemes(text)
+
+	msgCharsAsDots := fontmap.RenderWithFont(text, font, scale)
+	layout := TextLayout{
+		LineHeight:  fontmap.LineHeight(font, scale),
+		LineSpacing: msg.LineSpacing,
+		TextAlign:   textAlign(msg),
+		Spacing:     fontmap.Spacing(text, font, scale, msg.Kerning),
+		Inverted:    make([]bool, len(chars)),
+	}
+	addWordSpacing(layout.Spacing, chars, msg.WordSpacing)
+
+	for i, char := range chars {
+		if i >= len(msgCharsAsDots) || i >= len(styles) {
+			break
+		}
+
+		if char == objectReplacement {
+			msgCharsAsDots[i] = fontmap.GenerateSpace(layout.LineHeight, layout.LineHeight, 0)
+		} else if styles[i].bold {
+			msgCharsAsDots[i] = fontmap.Bold(msgCharsAsDots[i])
+		}
+		layout.Inverted[i] = styles[i].inverted
+	}
+
+	return renderedText{text: text, letters: msgCharsAsDots, styles: styles, layout: layout}
+}
+
+// hideBlinking returns a copy of the letters with the blinking ones blanked out, they still take up their space
+func hideBlinking(msgCharsAsDots []fontmap.Letter, styles []textStyle) []fontmap.Letter {
+	hidden := append([]fontmap.Letter{}, msgCharsAsDots...)
+	for i, letter := range hidden {
+		if i < len(styles) && styles[i].blink && letter != nil {
+			hidden[i] = fontmap.GenerateSpace(letter.Width(), len(letter), 0)
+		}
 	}
+	return hidden
+}
 
-	return &virtualBoard
+// textArea is how many dots wide and tall the board is for text, text wraps at the physically displayed width
+func textArea(layout boardLayout) (int, int) {
+	// the library flipped height and width by accident, so the panel's width is how tall it is
+	width := layout.info.PhysicallyDisplayedWidth * len(layout.addresses[0])
+	height := layout.info.PanelWidth * len(layout.addresses)
+	return width, height
+}
+
+// textAlign is how each line lines up inside the block of text. Without a text-align, the lines line up
+// the same way the block does on the board, so centered messages have centered lines.
+func textAlign(msg *options.FlipboardMessageOptions) string {
+	if msg.TextAlign != "" {
+		return msg.TextAlign
+	}
+
+	xAlign, _ := options.GetAlignOptions(msg.Align)
+	switch xAlign {
+	case "center", "right":
+		return xAlign
+	}
+	return "left"
 }
 
-func CreateVirtualBoard(panelWidth int, numberOfPanelsWide int, msgCharsAsDots []fontmap.Letter, msg string) virtualboard.VirtualBoard {
-	// we have to convert our long array of dotCharacters to a virtual board
-	var longestLine, lineNumber int
-	longestLine = 0
-	lineNumber = 0
+// addWordSpacing adds extra columns after every space
+func addWordSpacing(spacing []int, chars []string, wordSpacing int) {
+	for i := range spacing {
+		if i < len(chars) && fontmap.IsSpace(chars[i]) {
+			spacing[i] += wordSpacing
+		}
+	}
+}
+
+// getFont finds the font for a message, unknown fonts fall back to the default font
+func getFont(name string) *fontmap.Font {
+	if name == "" {
+		name = fontmap.DefaultFontName
+	}
+
+	font, exists := fontmap.Get(name)
+	if !exists {
+		log.Warnf("unknown font %s, using %s", name, fontmap.DefaultFontName)
+		font, _ = fontmap.Get(fontmap.DefaultFontName)
+	}
+	return font
+}
+
+// TextLayout is how CreateVirtualBoard arranges the letters
+type TextLayout struct {
+	LineHeight  int    // rows in a line of text
+	LineSpacing int    // extra rows between lines, negative squeezes them together
+	TextAlign   string // left, center, right or justify, how each line lines up inside the block of text
+	Spacing     []int  // Spacing[i] is how many columns go between letter i and the next one, it can be nil
+	Inverted    []bool // Inverted[i] draws letter i light on dark, next to each other they're one solid block, it can be nil
+}
+
+// CreateVirtualBoard lays out the letters, they wrap at the width of the panels.
+// msgCharsAsDots are the letters for each grapheme in msg, the way fontmap.RenderWithFont renders them.
+// Negative spacing between letters overlaps them.
+func CreateVirtualBoard(panelWidth int, numberOfPanelsWide int, msgCharsAsDots []fontmap.Letter, msg string, layout TextLayout) virtualboard.VirtualBoard {
 	lineMaxWidth := panelWidth * numberOfPanelsWide
+	placements, lines := layoutText(lineMaxWidth, msgCharsAsDots, fontmap.Graphemes(msg), layout.Spacing)
+	alignLines(placements, lines, layout.TextAlign)
+
+	linePitch := layout.LineHeight + layout.LineSpacing
+	if linePitch < 1 {
+		linePitch = 1
+	}
+
 	var virtualBoard virtualboard.VirtualBoard
+	for _, placement := range placements {
+		// write character to the virtual board
+		for charRowIndex, charRow := range placement.letter {
+			boardCharRowIndex := charRowIndex + (placement.line * linePitch)
 
-	// join the letters together to form one long string
-	for charIndexInMessage := 0; charIndexInMessage < len(msgCharsAsDots); charIndexInMessage++ {
-		charAsDots := msgCharsAsDots[charIndexInMessage]
+			// create all missing rows from the virtual board, up to our current boardCharRowIndex
+			for len(virtualBoard) <= boardCharRowIndex {
+				virtualBoard = append(virtualBoard, fontmap.Row{})
+			}
 
-		// handle line breaks
-		if msg[charIndexInMessage] == '\n' && charAsDots == nil {
-			lineNumber++
-			longestLine = 0
+			// make room for the letter, then combine its dots with anything it overlaps
+			for len(virtualBoard[boardCharRowIndex]) < placement.x+len(charRow) {
+				virtualBoard[boardCharRowIndex] = append(virtualBoard[boardCharRowIndex], 0)
+			}
+			for x, dot := range charRow {
+				virtualBoard[boardCharRowIndex][placement.x+x] |= dot
+			}
+		}
+	}
+	invertSpans(&virtualBoard, placements, layout.Inverted, linePitch, layout.LineHeight)
+	return virtualBoard
+}
+
+// invertSpans flips the dots behind inverted letters. Inverted letters next to each other are one block,
+// including the spacing between them, and a block gets a column of padding on the left to match the blank
+// column letters have on their right.
+func invertSpans(virtualBoard *virtualboard.VirtualBoard, placements []letterPlacement, inverted []bool, linePitch, lineHeight int) {
+	runLine, runEnd := -1, 0
+	for _, placement := range placements {
+		if placement.charIndex >= len(inverted) || !inverted[placement.charIndex] {
+			runLine = -1
 			continue
 		}
 
-		// try to word break, if it doesn't work, then we'lll need to character break
-		if msg[charIndexInMessage] == ' ' {
-			unprocessedStringMsg := msg[charIndexInMessage:] // msg will look something like: "   bbb"
-			unprocessedDotMessage := msgCharsAsDots[charIndexInMessage:]
+		start := placement.x - 1
+		if placement.line == runLine {
+			start = runEnd // the spacing between the letters
+		}
+		if start < 0 {
+			start = 0
+		}
+		end := placement.x + placement.letter.Width()
+		if end < start {
+			end = start
+		}
+
+		for y := placement.line * linePitch; y < placement.line*linePitch+lineHeight; y++ {
+			for len(*virtualBoard) <= y {
+				*virtualBoard = append(*virtualBoard, fontmap.Row{})
+			}
+			row := (*virtualBoard)[y]
+			for len(row) < end {
+				row = append(row, 0)
+			}
+			for x := start; x < end; x++ {
+				row[x] ^= 1
+			}
+			(*virtualBoard)[y] = row
+		}
+
+		runLine, runEnd = placement.line, end
+	}
+}
+
+// letterPlacement is where a letter ends up, x is the column on its line
+type letterPlacement struct {
+	letter    fontmap.Letter
+	charIndex int
+	x         int
+	line      int
+	isSpace   bool
+}
+
+// textLine is a line of laid out text, wrapped is false for the last line of a paragraph
+type textLine struct {
+	width   int
+	wrapped bool
+}
+
+// layoutText decides where every letter goes. Lines break on new lines, before words that don't fit,
+// and in the middle of words that are wider than the board. chars are the graphemes for each letter.
+func layoutText(lineMaxWidth int, msgCharsAsDots []fontmap.Letter, chars []string, spacing []int) ([]letterPlacement, []textLine) {
+	var placements []letterPlacement
+	var lineWidth, lineNumber int
+	lines := []textLine{{}}
+
+	spacingAfter := func(charIndex int) int {
+		if charIndex < 0 || charIndex >= len(spacing) {
+			return 0
+		}
+		return spacing[charIndex]
+	}
+
+	// nothing goes before the first letter of a line
+	spacingBefore := func(charIndex int) int {
+		if lineWidth == 0 {
+			return 0
+		}
+		return spacingAfter(charIndex - 1)
+	}
+
+	newLine := func(wrapped bool) {
+		lines[lineNumber].wrapped = wrapped
+		lines = append(lines, textLine{})
+		lineNumber++
+		lineWidth = 0
+	}
+
+	isWordChar := func(charIndex int) bool {
+		return !fontmap.IsSpace(chars[charIndex]) && !fontmap.IsNewline(chars[charIndex])
+	}
+
+	for charIndex := 0; charIndex < len(msgCharsAsDots) && charIndex < len(chars); charIndex++ {
+		charAsDots := msgCharsAsDots[charIndex]
+
+		// handle line breaks
+		if fontmap.IsNewline(chars[charIndex]) {
+			newLine(false)
+			continue
+		}
 
-			matchPos := regexp.MustCompile(`\S+`).FindStringIndex(unprocessedStringMsg) // matchPos[0] will be the first "b"
-			nextDotWord := unprocessedDotMessage[matchPos[0]:matchPos[1]]
+		// try to word break, if it doesn't work, then we'll need to character break
+		if fontmap.IsSpace(chars[charIndex]) {
+			wordStart := charIndex
+			for wordStart < len(chars) && fontmap.IsSpace(chars[wordStart]) {
+				wordStart++
+			}
+			if wordStart == len(chars) || wordStart >= len(msgCharsAsDots) || fontmap.IsNewline(chars[wordStart]) {
+				continue // it's just trailing whitespace
+			}
 
-			// find the width of dots for the word
+			// find the width of dots for the word, with the spacing between its letters
 			wordDotWidth := 0
-			for _, dotChar := range nextDotWord {
-				if len(dotChar) > 0 {
-					wordDotWidth += len(dotChar[0])
+			for wordEnd := wordStart; wordEnd < len(chars) && wordEnd < len(msgCharsAsDots) && isWordChar(wordEnd); wordEnd++ {
+				if wordEnd > wordStart {
+					wordDotWidth += spacingAfter(wordEnd - 1)
 				}
+				wordDotWidth += msgCharsAsDots[wordEnd].Width()
 			}
 
 			// since we're breaking on the word, we should discard all the whitespace before the word
-			if longestLine+wordDotWidth > lineMaxWidth {
-				lineNumber++
-				longestLine = 0
-
-				// advance our pointer to the beginning of the next word
-				charIndexInMessage += matchPos[0]
-				charAsDots = msgCharsAsDots[charIndexInMessage]
+			if lineWidth+wordDotWidth > lineMaxWidth {
+				newLine(true)
+				charIndex = wordStart
+				charAsDots = msgCharsAsDots[charIndex]
 			}
-		} else if longestLine+len(charAsDots[0]) > lineMaxWidth {
+		} else if lineWidth+spacingBefore(charIndex)+charAsDots.Width() > lineMaxWidth {
 			// if there's no spaces, and the word is super long, let's fallback and do a character break
-			lineNumber++
-			longestLine = 0
+			newLine(true)
 		}
 
-		// write character to the virtual board
-		for charRowIndex, charRow := range charAsDots {
-			boardCharRowIndex := charRowIndex + (lineNumber * fontmap.TI84.Metadata.MaxHeight)
+		// where the letter starts on the line, it can tuck into the letter before it
+		x := lineWidth + spacingBefore(charIndex)
+		if x < 0 {
+			x = 0
+		}
+		placements = append(placements, letterPlacement{letter: charAsDots, charIndex: charIndex, x: x, line: lineNumber, isSpace: fontmap.IsSpace(chars[charIndex])})
 
-			// create all missing rows from the virtual board, up to our current boardCharRowIndex
-			for len(virtualBoard) <= boardCharRowIndex {
-				virtualBoard = append(virtualBoard, fontmap.Row{})
-			}
+		// keep track of the longest char row for the line
+		if lineWidth < x+charAsDots.Width() {
+			lineWidth = x + charAsDots.Width()
+			lines[lineNumber].width = lineWidth
+		}
+	}
 
-			virtualBoard[boardCharRowIndex] = append(virtualBoard[boardCharRowIndex], charRow...)
+	return placements, lines
+}
 
-			// keep track of the longest char row for the line
-			if longestLine < len(virtualBoard[boardCharRowIndex]) {
-				longestLine = len(virtualBoard[boardCharRowIndex])
-			}
+// alignLines moves the letters of each line to line up inside the widest line.
+// Justified lines stretch their spaces, except for the last line of a paragraph.
+func alignLines(placements []letterPlacement, lines []textLine, textAlign string) {
+	blockWidth := 0
+	for _, line := range lines {
+		if line.width > blockWidth {
+			blockWidth = line.width
+		}
+	}
 
+	if textAlign == "justify" {
+		justifyLines(placements, lines, blockWidth)
+		return
+	}
+
+	for i := range placements {
+		extra := blockWidth - lines[placements[i].line].width
+		switch textAlign {
+		case "center":
+			placements[i].x += extra / 2
+		case "right":
+			placements[i].x += extra
+		}
+	}
+}
+
+func justifyLines(placements []letterPlacement, lines []textLine, blockWidth int) {
+	// the spaces that can stretch are between words, not the indent at the start of a line
+	gaps := make([]int, len(lines))
+	seenWord := make([]bool, len(lines))
+	for _, placement := range placements {
+		if !placement.isSpace {
+			seenWord[placement.line] = true
+		} else if seenWord[placement.line] {
+			gaps[placement.line]++
+		}
+	}
+
+	shift := make([]int, len(lines))
+	gapIndex := make([]int, len(lines))
+	for i := range seenWord {
+		seenWord[i] = false
+	}
+	for i, placement := range placements {
+		line := placement.line
+		placements[i].x += shift[line]
+
+		if !lines[line].wrapped || gaps[line] == 0 {
+			continue
+		}
+		if !placement.isSpace {
+			seenWord[line] = true
+			continue
+		}
+		if seenWord[line] {
+			// spread the extra columns over the spaces, the first spaces get the leftovers
+			extra := blockWidth - lines[line].width
+			shift[line] += extra / gaps[line]
+			if gapIndex[line] < extra%gaps[line] {
+				shift[line]++
+			}
+			gapIndex[line]++
 		}
 	}
-	return virtualBoard
 }
@@ -0,0 +1,40 @@
+package flipboard
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/armory/flipdisks/pkg/options"
+)
+
+func TestRenderTextToPagesClampsSizes(t *testing.T) {
+	board := testPrerenderBoard()
+
+	var replies []string
+	msg := options.FlipboardMessageOptions{
+		Message:     "BIG",
+		FontSize:    100000,
+		Kerning:     100000,
+		WordSpacing: 100000,
+		LineSpacing: 100000,
+		Reply:       func(note string) { replies = append(replies, note) },
+	}
+	pages := renderTextToPages(&msg, board.currentLayout())
+
+	if len(pages.pages) == 0 {
+		t.Fatal("Expected the text to be rendered")
+	}
+	for _, frame := range pages.pages[0] {
+		for _, row := range frame {
+			if len(row) > 1000 {
+				t.Fatalf("Expected the sizes to be clamped, got a row %d dots wide", len(row))
+			}
+		}
+	}
+	if len(replies) != 4 || !strings.Contains(replies[0], "font-size: 100000 is too much, using 8") {
+		t.Errorf("Expected the sender to hear about every size that was clamped, got %q", replies)
+	}
+	if msg.FontSize != 100000 {
+		t.Error("Expected the message itself to be left alone")
+	}
+}
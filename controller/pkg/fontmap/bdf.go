@@ -0,0 +1,394 @@
+package fontmap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxBDFSize is the biggest a glyph, or a font's ascent and descent, can be. The board is a few dozen dots tall,
+// anything bigger is a broken font, and it'd take a lot of memory to render.
+const maxBDFSize = 256
+
+// bdfGlyph is a glyph the way BDF describes it, the bitmap only covers the bounding box
+type bdfGlyph struct {
+	name     string
+	encoding int
+	metrics  GlyphMetrics
+	bitmap   []Row
+}
+
+// ParseBDF reads an Adobe Glyph Bitmap Distribution Format (BDF 2.1) font.
+// Every glyph is rendered to a letter that's as tall as the font, with the glyph sitting on the baseline.
+func ParseBDF(r io.Reader) (Font, error) {
+	font := Font{
+		Charmap: CharmapType{},
+		Metrics: map[string]GlyphMetrics{},
+	}
+
+	var glyphs []bdfGlyph
+	var fontBoundingBox GlyphMetrics
+	ascent, descent := -1, -1
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	nextLine := func() ([]string, bool) {
+		for scanner.Scan() {
+			lineNumber++
+			fields := strings.Fields(scanner.Text())
+			if len(fields) > 0 {
+				return fields, true
+			}
+		}
+		return nil, false
+	}
+	parseErr := func(msg string) error {
+		return fmt.Errorf("bdf line %d: %s", lineNumber, msg)
+	}
+
+	fields, ok := nextLine()
+	if !ok || fields[0] != "STARTFONT" {
+		return font, errors.New("not a bdf font, it should start with STARTFONT")
+	}
+
+	for {
+		fields, ok := nextLine()
+		if !ok {
+			return font, parseErr("missing ENDFONT")
+		}
+
+		switch fields[0] {
+		case "FONT":
+			if font.Name == "" && len(fields) > 1 {
+				font.Name = strings.Join(fields[1:], " ")
+			}
+
+		case "FONTBOUNDINGBOX":
+			bbx, err := atoiFields(fields[1:], 4)
+			if err != nil {
+				return font, parseErr("bad FONTBOUNDINGBOX: " + err.Error())
+			}
+			if err := checkBoundingBox(bbx); err != nil {
+				return font, parseErr("bad FONTBOUNDINGBOX: " + err.Error())
+			}
+			fontBoundingBox = GlyphMetrics{Width: bbx[0], Height: bbx[1], XOffset: bbx[2], YOffset: bbx[3]}
+
+		case "FAMILY_NAME":
+			font.Name = strings.Trim(strings.Join(fields[1:], " "), `"`)
+
+		case "FONT_ASCENT":
+			v, err := atoiFields(fields[1:], 1)
+			if err != nil {
+				return font, parseErr("bad FONT_ASCENT: " + err.Error())
+			}
+			if v[0] < 0 || v[0] > maxBDFSize {
+				return font, parseErr(fmt.Sprintf("bad FONT_ASCENT: %d should be between 0 and %d", v[0], maxBDFSize))
+			}
+			ascent = v[0]
+
+		case "FONT_DESCENT":
+			v, err := atoiFields(fields[1:], 1)
+			if err != nil {
+				return font, parseErr("bad FONT_DESCENT: " + err.Error())
+			}
+			if v[0] < 0 || v[0] > maxBDFSize {
+				return font, parseErr(fmt.Sprintf("bad FONT_DESCENT: %d should be between 0 and %d", v[0], maxBDFSize))
+			}
+			descent = v[0]
+
+		case "STARTCHAR":
+			glyph, err := parseBDFGlyph(strings.Join(fields[1:], " "), fontBoundingBox, nextLine, parseErr)
+			if err != nil {
+				return font, err
+			}
+			glyphs = append(glyphs, glyph)
+
+		case "ENDFONT":
+			if err := scanner.Err(); err != nil {
+				return font, err
+			}
+
+			// fonts without the properties get their baseline from the bounding box
+			if ascent < 0 {
+				ascent = fontBoundingBox.Height + fontBoundingBox.YOffset
+			}
+			if descent < 0 {
+				descent = -fontBoundingBox.YOffset
+			}
+			font.Metadata.Ascent = ascent
+			font.Metadata.Descent = descent
+			font.Metadata.MaxHeight = ascent + descent
+
+			if font.Metadata.MaxHeight <= 0 {
+				return font, errors.New("bdf font has no height, it needs FONT_ASCENT and FONT_DESCENT or a FONTBOUNDINGBOX")
+			}
+
+			var totalHeight, totalWidth int
+			for _, glyph := range glyphs {
+				if glyph.encoding < 0 {
+					continue // not in unicode, we'd never be able to look it up
+				}
+
+				char := string(rune(glyph.encoding))
+				font.Charmap[char] = glyph.toLetter(font.Metadata)
+				font.Metrics[char] = glyph.metrics
+
+				totalHeight += glyph.metrics.Height
+				totalWidth += glyph.metrics.Advance
+			}
+
+			if len(font.Charmap) > 0 {
+				font.Metadata.AverageHeight = totalHeight / len(font.Charmap)
+				font.Metadata.AverageWidth = totalWidth / len(font.Charmap)
+			}
+
+			return font, nil
+		}
+	}
+}
+
+func parseBDFGlyph(name string, fontBoundingBox GlyphMetrics, nextLine func() ([]string, bool), parseErr func(string) error) (bdfGlyph, error) {
+	glyph := bdfGlyph{name: name, encoding: -1, metrics: fontBoundingBox}
+	glyph.metrics.Advance = fontBoundingBox.Width
+
+	for {
+		fields, ok := nextLine()
+		if !ok {
+			return glyph, parseErr("glyph " + name + " is missing ENDCHAR")
+		}
+
+		switch fields[0] {
+		case "ENCODING":
+			v, err := atoiFields(fields[1:], 1)
+			if err != nil {
+				return glyph, parseErr("bad ENCODING: " + err.Error())
+			}
+			glyph.encoding = v[0]
+
+		case "DWIDTH":
+			v, err := atoiFields(fields[1:], 1)
+			if err != nil {
+				return glyph, parseErr("bad DWIDTH: " + err.Error())
+			}
+			if v[0] < -maxBDFSize || v[0] > maxBDFSize {
+				return glyph, parseErr(fmt.Sprintf("bad DWIDTH: %d is too wide", v[0]))
+			}
+			glyph.metrics.Advance = v[0]
+
+		case "BBX":
+			bbx, err := atoiFields(fields[1:], 4)
+			if err != nil {
+				return glyph, parseErr("bad BBX: " + err.Error())
+			}
+			if err := checkBoundingBox(bbx); err != nil {
+				return glyph, parseErr("bad BBX: " + err.Error())
+			}
+			glyph.metrics.Width, glyph.metrics.Height = bbx[0], bbx[1]
+			glyph.metrics.XOffset, glyph.metrics.YOffset = bbx[2], bbx[3]
+
+		case "BITMAP":
+			for y := 0; y < glyph.metrics.Height; y++ {
+				fields, ok := nextLine()
+				if !ok {
+					return glyph, parseErr("glyph " + name + " bitmap is too short")
+				}
+
+				row, err := hexToRow(fields[0], glyph.metrics.Width)
+				if err != nil {
+					return glyph, parseErr("glyph " + name + ": " + err.Error())
+				}
+				glyph.bitmap = append(glyph.bitmap, row)
+			}
+
+		case "ENDCHAR":
+			return glyph, nil
+		}
+	}
+}
+
+// toLetter places the glyph's bitmap into a letter the height of the font, so every letter lines up on the baseline
+func (glyph bdfGlyph) toLetter(metadata MetadataType) Letter {
+	m := glyph.metrics
+
+	// some glyphs hang past their advance, or start before it, we'll keep all their dots
+	left := 0
+	if m.XOffset < 0 {
+		left = m.XOffset
+	}
+	right := m.Advance
+	if m.XOffset+m.Width > right {
+		right = m.XOffset + m.Width
+	}
+
+	letter := GenerateSpace(right-left, metadata.MaxHeight, 0)
+
+	// the bottom of the bounding box is YOffset above the baseline
+	top := metadata.Ascent - (m.YOffset + m.Height)
+	for y, bitmapRow := range glyph.bitmap {
+		letterY := top + y
+		if letterY < 0 || letterY >= len(letter) {
+			continue // taller than the font says it is, drop it
+		}
+
+		for x, dot := range bitmapRow {
+			letter[letterY][x+m.XOffset-left] = dot
+		}
+	}
+
+	return letter
+}
+
+// hexToRow converts a BDF bitmap line, it's padded to full bytes with the most significant bit on the left
+func hexToRow(hex string, width int) (Row, error) {
+	row := make(Row, width)
+	for x := 0; x < width; x++ {
+		nibbleIndex := x / 4
+		if nibbleIndex >= len(hex) {
+			return nil, errors.New("bitmap row " + hex + " is narrower than the glyph")
+		}
+
+		nibble, err := strconv.ParseUint(hex[nibbleIndex:nibbleIndex+1], 16, 8)
+		if err != nil {
+			return nil, errors.New("bitmap row " + hex + " isn't hex")
+		}
+
+		row[x] = int(nibble>>uint(3-x%4)) & 1
+	}
+	return row, nil
+}
+
+// checkBoundingBox makes sure a width, height, x and y offset can be rendered
+func checkBoundingBox(bbx []int) error {
+	if bbx[0] < 0 || bbx[1] < 0 {
+		return fmt.Errorf("%dx%d can't be negative", bbx[0], bbx[1])
+	}
+	for _, v := range bbx {
+		if v < -maxBDFSize || v > maxBDFSize {
+			return fmt.Errorf("%d is bigger than %d", v, maxBDFSize)
+		}
+	}
+	return nil
+}
+
+func atoiFields(fields []string, count int) ([]int, error) {
+	if len(fields) < count {
+		return nil, fmt.Errorf("expected %d numbers, got %d", count, len(fields))
+	}
+
+	var out []int
+	for _, field := range fields[:count] {
+		v, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// LoadBDF reads a BDF font from a file. The font is named after the file, e.g. fonts/5x7.bdf is "5x7",
+// since a lot of BDF fonts share the same family name.
+func LoadBDF(path string) (Font, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Font{}, err
+	}
+	defer f.Close()
+
+	font, err := ParseBDF(f)
+	if err != nil {
+		return font, errors.New("couldn't load " + path + ": " + err.Error())
+	}
+
+	font.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return font, nil
+}
+
+// WriteBDF saves the font as a BDF font, so it can go in the fonts dir. Every glyph's box is its whole letter,
+// reading it back with ParseBDF gives the same letters. BDF glyphs are a single unicode character,
+// letters for emojis with skin tones and the like are skipped.
+func WriteBDF(w io.Writer, font *Font) error {
+	ascent, descent := font.Metadata.Ascent, font.Metadata.Descent
+	if ascent+descent != font.Metadata.MaxHeight {
+		ascent, descent = font.Metadata.MaxHeight, 0 // no baseline, the letters sit on the bottom row
+	}
+	height := ascent + descent
+
+	var chars []string
+	maxWidth := 0
+	for char, letter := range font.Charmap {
+		if utf8.RuneCountInString(char) != 1 {
+			log.Warnf("%s can't be saved in a bdf font, only single characters can", char)
+			continue
+		}
+		chars = append(chars, char)
+		if letter.Width() > maxWidth {
+			maxWidth = letter.Width()
+		}
+	}
+	sort.Strings(chars)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "STARTFONT 2.1\n")
+	fmt.Fprintf(&b, "FONT %s\n", font.Name)
+	fmt.Fprintf(&b, "SIZE %d 72 72\n", height)
+	fmt.Fprintf(&b, "FONTBOUNDINGBOX %d %d 0 %d\n", maxWidth, height, -descent)
+	fmt.Fprintf(&b, "STARTPROPERTIES 3\n")
+	fmt.Fprintf(&b, "FAMILY_NAME %q\n", font.Name)
+	fmt.Fprintf(&b, "FONT_ASCENT %d\n", ascent)
+	fmt.Fprintf(&b, "FONT_DESCENT %d\n", descent)
+	fmt.Fprintf(&b, "ENDPROPERTIES\n")
+	fmt.Fprintf(&b, "CHARS %d\n", len(chars))
+
+	for _, char := range chars {
+		letter := font.Charmap[char]
+		r, _ := utf8.DecodeRuneInString(char)
+		width := letter.Width()
+
+		fmt.Fprintf(&b, "STARTCHAR U+%04X\n", r)
+		fmt.Fprintf(&b, "ENCODING %d\n", r)
+		if height > 0 {
+			fmt.Fprintf(&b, "SWIDTH %d 0\n", width*1000/height)
+		}
+		fmt.Fprintf(&b, "DWIDTH %d 0\n", width)
+		fmt.Fprintf(&b, "BBX %d %d 0 %d\n", width, height, -descent)
+		fmt.Fprintf(&b, "BITMAP\n")
+		for y := 0; y < height; y++ {
+			var row Row
+			if y < len(letter) {
+				row = letter[y]
+			}
+			fmt.Fprintf(&b, "%s\n", rowToHex(row, width))
+		}
+		fmt.Fprintf(&b, "ENDCHAR\n")
+	}
+	fmt.Fprintf(&b, "ENDFONT\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// rowToHex is the opposite of hexToRow, the row is padded to full bytes
+func rowToHex(row Row, width int) string {
+	bytes := (width + 7) / 8
+	if bytes < 1 {
+		bytes = 1
+	}
+
+	hex := make([]byte, bytes)
+	for x := 0; x < width && x < len(row); x++ {
+		if row[x] != 0 {
+			hex[x/8] |= 0x80 >> uint(x%8)
+		}
+	}
+	return fmt.Sprintf("%X", hex)
+}
@@ -0,0 +1,155 @@
+package fontmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBDF(t *testing.T) {
+	font, err := LoadBDF("test_fixtures/tiny.bdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "tiny", font.Name, "fonts are named after their file")
+	assert.Equal(t, 5, font.Metadata.Ascent)
+	assert.Equal(t, 1, font.Metadata.Descent)
+	assert.Equal(t, 6, font.Metadata.MaxHeight)
+	assert.Len(t, font.Charmap, 4, "unencoded glyphs should be skipped")
+
+	tests := map[string]struct {
+		expectedLetter  Letter
+		expectedMetrics GlyphMetrics
+	}{
+		"A": {
+			expectedLetter: Letter{
+				Row{0, 1, 0, 0},
+				Row{1, 0, 1, 0},
+				Row{1, 1, 1, 0},
+				Row{1, 0, 1, 0},
+				Row{1, 0, 1, 0},
+				Row{0, 0, 0, 0},
+			},
+			expectedMetrics: GlyphMetrics{Width: 3, Height: 5, XOffset: 0, YOffset: 0, Advance: 4},
+		},
+		"g": { // hangs below the baseline
+			expectedLetter: Letter{
+				Row{0, 0, 0, 0},
+				Row{0, 1, 1, 0},
+				Row{1, 0, 1, 0},
+				Row{0, 1, 1, 0},
+				Row{0, 0, 1, 0},
+				Row{0, 1, 0, 0},
+			},
+			expectedMetrics: GlyphMetrics{Width: 3, Height: 5, XOffset: 0, YOffset: -1, Advance: 4},
+		},
+		"j": { // starts left of where the letter does
+			expectedLetter: Letter{
+				Row{0, 1, 0},
+				Row{0, 0, 0},
+				Row{0, 1, 0},
+				Row{0, 1, 0},
+				Row{0, 1, 0},
+				Row{1, 0, 0},
+			},
+			expectedMetrics: GlyphMetrics{Width: 2, Height: 6, XOffset: -1, YOffset: -1, Advance: 2},
+		},
+		" ": {
+			expectedLetter:  GenerateSpace(4, 6, 0),
+			expectedMetrics: GlyphMetrics{Advance: 4},
+		},
+	}
+
+	for char, test := range tests {
+		t.Run(char, func(t *testing.T) {
+			got := font.Charmap[char]
+			if !reflect.DeepEqual(test.expectedLetter, got) {
+				t.Errorf("Expected\n%s", test.expectedLetter)
+				t.Errorf("Got\n%s", got)
+			}
+			assert.Equal(t, test.expectedMetrics, font.Metrics[char])
+		})
+	}
+}
+
+func TestParseBDFErrors(t *testing.T) {
+	tests := map[string]string{
+		"not bdf":         "hello",
+		"no ENDFONT":      "STARTFONT 2.1\nFONTBOUNDINGBOX 4 6 0 -1\n",
+		"no height":       "STARTFONT 2.1\nENDFONT\n",
+		"bad bitmap":      "STARTFONT 2.1\nFONTBOUNDINGBOX 4 6 0 -1\nSTARTCHAR A\nENCODING 65\nBBX 3 1 0 0\nBITMAP\nZZ\nENDCHAR\nENDFONT\n",
+		"short bitmap":    "STARTFONT 2.1\nFONTBOUNDINGBOX 4 6 0 -1\nSTARTCHAR A\nENCODING 65\nBBX 3 2 0 0\nBITMAP\n40\n",
+		"bad bounding":    "STARTFONT 2.1\nFONTBOUNDINGBOX 4 six 0 -1\nENDFONT\n",
+		"no ENDCHAR":      "STARTFONT 2.1\nFONTBOUNDINGBOX 4 6 0 -1\nSTARTCHAR A\nENCODING 65\n",
+		"narrow bitmap":   "STARTFONT 2.1\nFONTBOUNDINGBOX 9 6 0 -1\nSTARTCHAR A\nENCODING 65\nBBX 9 1 0 0\nBITMAP\n40\nENDCHAR\nENDFONT\n",
+		"negative width":  "STARTFONT 2.1\nFONTBOUNDINGBOX 4 6 0 -1\nSTARTCHAR A\nENCODING 65\nBBX -3 1 0 0\nBITMAP\n40\nENDCHAR\nENDFONT\n",
+		"negative height": "STARTFONT 2.1\nFONTBOUNDINGBOX 4 6 0 -1\nSTARTCHAR A\nENCODING 65\nBBX 3 -1 0 0\nBITMAP\n40\nENDCHAR\nENDFONT\n",
+		"huge glyph":      "STARTFONT 2.1\nFONTBOUNDINGBOX 4 6 0 -1\nSTARTCHAR A\nENCODING 65\nBBX 100000 1 0 0\nBITMAP\n40\nENDCHAR\nENDFONT\n",
+		"huge offset":     "STARTFONT 2.1\nFONTBOUNDINGBOX 4 6 0 -1\nSTARTCHAR A\nENCODING 65\nBBX 3 1 100000 0\nBITMAP\n40\nENDCHAR\nENDFONT\n",
+		"negative font":   "STARTFONT 2.1\nFONTBOUNDINGBOX -4 6 0 -1\nENDFONT\n",
+		"huge ascent":     "STARTFONT 2.1\nFONT_ASCENT 100000\nFONT_DESCENT 1\nENDFONT\n",
+	}
+
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseBDF(strings.NewReader(raw))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	assert.NoError(t, LoadDir("test_fixtures"))
+
+	font, exists := Get("TINY")
+	assert.True(t, exists, "font names shouldn't be case sensitive")
+	assert.Equal(t, "tiny", font.Name)
+	assert.Equal(t, []string{"TI84"}, font.Fallbacks, "fallbacks come from tiny.fallbacks")
+
+	_, exists = Get(DefaultFontName)
+	assert.True(t, exists, "TI84 is always there")
+	assert.Contains(t, Names(), "tiny")
+
+	assert.Error(t, LoadDir("test_fixtures/nope"))
+	_, exists = Get("tiny")
+	assert.True(t, exists, "the fonts from before stay when the dir can't be read")
+
+	empty, err := ioutil.TempDir("", "flipdisk-fonts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(empty)
+	assert.NoError(t, LoadDir(empty))
+	_, exists = Get("tiny")
+	assert.False(t, exists, "fonts that were removed from the dir go away")
+	_, exists = Get(DefaultFontName)
+	assert.True(t, exists, "TI84 is always there")
+
+	assert.NoError(t, LoadDir("test_fixtures"))
+	UnloadDir()
+	assert.NotContains(t, Names(), "tiny")
+}
+
+func TestWriteBDF(t *testing.T) {
+	var saved bytes.Buffer
+	if err := WriteBDF(&saved, &TI84); err != nil {
+		t.Fatal(err)
+	}
+
+	font, err := ParseBDF(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, TI84.Metadata.Ascent, font.Metadata.Ascent)
+	assert.Equal(t, TI84.Metadata.Descent, font.Metadata.Descent)
+	if !reflect.DeepEqual(TI84.Charmap, font.Charmap) {
+		t.Error("the letters should be the same after saving and loading")
+	}
+}
@@ -1,22 +1,37 @@
 package fontmap
 
-import (
-	"strings"
-
-	log "github.com/sirupsen/logrus"
-)
-
 type Font struct {
 	Name     string       `json:"name"`
 	Metadata MetadataType `json:"metadata"`
 	Charmap  CharmapType  `json:"charmap"`
+
+	// Metrics are the glyph bounding boxes, fonts that are typed in by hand don't have them
+	Metrics map[string]GlyphMetrics `json:"metrics,omitempty"`
+
+	// Kerning moves pairs of letters closer or further apart, it's keyed by both letters, e.g. "AV": -1
+	Kerning map[string]int `json:"kerning,omitempty"`
+
+	// Fallbacks are the names of the fonts to get the characters this font doesn't have from, in order
+	Fallbacks []string `json:"fallbacks,omitempty"`
 }
 
 type MetadataType struct {
-	TallerCharacters map[string]int `json:"tallerCharacters"`
-	AverageHeight    int            `json:"averageHeight"`
-	AverageWidth     int            `json:"averageWidth"`
-	MaxHeight        int            `json:"maxHeight"`
+	AverageHeight int `json:"averageHeight"`
+	AverageWidth  int `json:"averageWidth"`
+	MaxHeight     int `json:"maxHeight"` // the height of every letter, Ascent + Descent
+
+	// Ascent is how many rows are above the baseline, Descent is how many are below it for letters with tails
+	Ascent  int `json:"ascent"`
+	Descent int `json:"descent"`
+}
+
+// GlyphMetrics is the bounding box of the dots in a glyph, relative to where it sits on the baseline
+type GlyphMetrics struct {
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+	XOffset int `json:"xOffset"` // from the left edge of the letter
+	YOffset int `json:"yOffset"` // from the baseline to the bottom of the box, negative for tails
+	Advance int `json:"advance"` // how far the next letter starts
 }
 
 type CharmapType map[string]Letter
@@ -54,20 +69,143 @@ func GenerateSpace(width int, height int, fill int) Letter {
 	return space
 }
 
-// AddKerning will add trailing whitespace to the end of the letter
+// AddKerning returns a copy of the letter with trailing whitespace added to the end.
+// A negative amount trims columns off the end instead, use Join to overlap letters without losing any dots.
 func AddKerning(letter Letter, amountOfKerning int) Letter {
-	if amountOfKerning < 0 {
-		log.Error("AddKerning does not support negative amounts yet")
-		return letter
+	kerned := make(Letter, len(letter))
+
+	for rowIndex, row := range letter {
+		width := len(row) + amountOfKerning
+		if width < 0 {
+			width = 0
+		}
+
+		kerned[rowIndex] = make(Row, width)
+		copy(kerned[rowIndex], row)
+	}
+
+	return kerned
+}
+
+// Join returns a new letter with right placed spacing columns after left. A negative spacing overlaps
+// the letters, the dots that land on each other are combined. Neither letter is changed.
+func Join(left, right Letter, spacing int) Letter {
+	leftWidth := left.Width()
+	rightStart := leftWidth + spacing
+	if rightStart < 0 {
+		rightStart = 0
+	}
+
+	joinedWidth := leftWidth
+	if rightStart+right.Width() > joinedWidth {
+		joinedWidth = rightStart + right.Width()
+	}
+
+	height := len(left)
+	if len(right) > height {
+		height = len(right)
+	}
+
+	joined := GenerateSpace(joinedWidth, height, 0)
+	for y, row := range left {
+		copy(joined[y], row)
+	}
+	for y, row := range right {
+		for x, dot := range row {
+			joined[y][rightStart+x] |= dot
+		}
+	}
+
+	return joined
+}
+
+// Width is how many columns wide the letter is
+func (letter Letter) Width() int {
+	w := 0
+	for _, row := range letter {
+		if len(row) > w {
+			w = len(row)
+		}
+	}
+	return w
+}
+
+// PairKerning is how many columns to move right towards left, e.g. -1 to tuck a V under an A
+func (font *Font) PairKerning(left, right string) int {
+	return font.Kerning[left+right]
+}
+
+// Spacing returns how many columns go between each character in msg and the next one,
+// it's the tracking plus the font's kerning for the pair. It lines up with the letters from RenderWithFont.
+func Spacing(msg string, font *Font, scale int, tracking int) []int {
+	if scale < 1 {
+		scale = 1
 	}
 
-	for rowIndex := range letter {
-			for j := 0; j < amountOfKerning; j++ {
-				letter[rowIndex] = append(letter[rowIndex], 0)
+	chars := Graphemes(msg)
+	spacing := make([]int, len(chars))
+	for i := 0; i+1 < len(chars); i++ {
+		spacing[i] = tracking + font.PairKerning(chars[i], chars[i+1])*scale
+	}
+	return spacing
+}
+
+// Bold returns a copy of the letter with every stroke doubled to the right. The letter only gets wider
+// when it has dots in its last column, letters usually end with a blank column.
+func Bold(letter Letter) Letter {
+	if letter == nil {
+		return nil
+	}
+
+	width := letter.Width()
+	for _, row := range letter {
+		if len(row) > 0 && len(row) == width && row[width-1] != 0 {
+			width++
+			break
+		}
+	}
+
+	bold := GenerateSpace(width, len(letter), 0)
+	for y, row := range letter {
+		for x, dot := range row {
+			if dot != 0 {
+				bold[y][x] = dot
+				bold[y][x+1] = dot
+			}
+		}
+	}
+	return bold
+}
+
+// Scale makes every dot in the letter a factor x factor block of dots, the letter isn't changed
+func Scale(letter Letter, factor int) Letter {
+	if letter == nil {
+		return nil
+	}
+
+	var scaled Letter
+	for _, row := range letter {
+		scaledRow := make(Row, 0, len(row)*factor)
+		for _, dot := range row {
+			for i := 0; i < factor; i++ {
+				scaledRow = append(scaledRow, dot)
 			}
+		}
+
+		for i := 0; i < factor; i++ {
+			scaled = append(scaled, append(Row{}, scaledRow...))
+		}
 	}
 
-	return letter
+	return scaled
+}
+
+// LineHeight is how many rows a line of text takes up in font at scale
+func LineHeight(font *Font, scale int) int {
+	if scale < 1 {
+		scale = 1
+	}
+	return font.Metadata.MaxHeight * scale
 }
 
 // Render will take each character in msg, and create the flipdisk rendered character
@@ -77,28 +215,47 @@ func AddKerning(letter Letter, amountOfKerning int) Letter {
 // the final output will by an array of 2x2 matrixes
 //
 // Special Conditions:
+//  - characters are graphemes, see Graphemes, so "é" or "👍🏽" is one letter
 //  - new lines are rendered to nil, you'll have to handle this separately
-//  - unknown characters will be rendered as a black space
+//  - unknown characters will be rendered as the replacement glyph, see SetReplacementGlyph
 func Render(msg string) []Letter {
+	return RenderWithFont(msg, &TI84, 1)
+}
+
+// RenderWithFont is Render, but with the characters from font, every dot is scaled into a scale x scale block
+func RenderWithFont(msg string, font *Font, scale int) []Letter {
 	var msgCharsAsDots []Letter
 
-	for _, char := range strings.Split(msg, "") {
-		switch char {
-		case " ":
-			spaceWidth := 2 // magic 2 for pretty printing letters with tails
-			msgCharsAsDots = append(msgCharsAsDots, GenerateSpace(spaceWidth, TI84.Metadata.MaxHeight, 0))
-		case "\n":
-			msgCharsAsDots = append(msgCharsAsDots, nil)
-		default:
-			dotLetter, charExists := TI84.Charmap[char]
+	if scale < 1 {
+		scale = 1
+	}
 
-			if charExists {
-				msgCharsAsDots = append(msgCharsAsDots, AddKerning(dotLetter, 0))
+	for _, char := range Graphemes(msg) {
+		var dotLetter Letter
+
+		switch {
+		case IsNewline(char):
+			msgCharsAsDots = append(msgCharsAsDots, nil)
+			continue
+		case IsSpace(char):
+			if space, exists := font.Charmap[" "]; exists {
+				dotLetter = space
 			} else {
-				// todo, figure out if this is really how we ant to handle unknown characters
-				msgCharsAsDots = append(msgCharsAsDots, GenerateSpace(3, TI84.Metadata.MaxHeight, 1))
+				spaceWidth := 2 // magic 2 for pretty printing letters with tails
+				dotLetter = GenerateSpace(spaceWidth, font.Metadata.MaxHeight, 0)
 			}
+		default:
+			letter, charExists := font.Glyph(char)
+			if !charExists {
+				letter = font.Replacement()
+			}
+			dotLetter = AddKerning(letter, 0)
+		}
+
+		if scale > 1 {
+			dotLetter = Scale(dotLetter, scale)
 		}
+		msgCharsAsDots = append(msgCharsAsDots, dotLetter)
 	}
 
 	return msgCharsAsDots
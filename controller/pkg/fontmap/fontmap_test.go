@@ -144,11 +144,20 @@ func TestAddKerning(t *testing.T) {
 			},
 			amountOfKerning: -1,
 			expected: Letter{
-				Row{1},
+				Row{},
+			},
+		},
+		{
+			letter: Letter{
+				{1, 0, 1},
+				{0, 1, 1},
+			},
+			amountOfKerning: -1,
+			expected: Letter{
+				{1, 0},
+				{0, 1},
 			},
 		},
-
-
 		{
 			letter: Letter{
 				{1, 0, 1},
@@ -172,6 +181,92 @@ func TestAddKerning(t *testing.T) {
 			t.Errorf("Got: \n%s", got)
 		}
 	}
+
+	original := Letter{Row{1, 1}}
+	AddKerning(original, -1)
+	if !reflect.DeepEqual(Letter{Row{1, 1}}, original) {
+		t.Errorf("AddKerning shouldn't change the letter, it's now %#v", original)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	left := Letter{
+		{1, 1, 0},
+		{1, 0, 0},
+	}
+	right := Letter{
+		{0, 1},
+		{1, 1},
+	}
+
+	tests := []struct {
+		spacing  int
+		expected Letter
+	}{
+		{
+			spacing: 1,
+			expected: Letter{
+				{1, 1, 0, 0, 0, 1},
+				{1, 0, 0, 0, 1, 1},
+			},
+		},
+		{
+			spacing: 0,
+			expected: Letter{
+				{1, 1, 0, 0, 1},
+				{1, 0, 0, 1, 1},
+			},
+		},
+		{
+			spacing: -2,
+			expected: Letter{
+				{1, 1, 1},
+				{1, 1, 1},
+			},
+		},
+		{
+			spacing: -5,
+			expected: Letter{
+				{1, 1, 0},
+				{1, 1, 0},
+			},
+		},
+	}
+
+	for _, testCase := range tests {
+		got := Join(left, right, testCase.spacing)
+		if !reflect.DeepEqual(testCase.expected, got) {
+			t.Errorf("spacing %d: Expected %#v, but got %#v", testCase.spacing, testCase.expected, got)
+		}
+	}
+
+	if !reflect.DeepEqual(Letter{{1, 1, 0}, {1, 0, 0}}, left) {
+		t.Errorf("Join shouldn't change the letters, left is now %#v", left)
+	}
+}
+
+func TestSpacing(t *testing.T) {
+	font := &Font{
+		Charmap: TI84.Charmap,
+		Kerning: map[string]int{"AV": -1, "VA": -1},
+	}
+
+	tests := []struct {
+		msg             string
+		scale, tracking int
+		expected        []int
+	}{
+		{msg: "AVAT.", scale: 1, tracking: 1, expected: []int{0, 0, 1, 1, 0}},
+		{msg: "VA ", scale: 2, tracking: 0, expected: []int{-2, 0, 0}},
+		{msg: "", scale: 1, tracking: 1, expected: []int{}},
+	}
+
+	for _, testCase := range tests {
+		got := Spacing(testCase.msg, font, testCase.scale, testCase.tracking)
+		if !reflect.DeepEqual(testCase.expected, got) {
+			t.Errorf("%q: Expected %v, but got %v", testCase.msg, testCase.expected, got)
+		}
+	}
 }
 
 func TestRender(t *testing.T) {
@@ -287,29 +382,9 @@ func TestRender(t *testing.T) {
 				Row{0, 0, 0, 0},
 			},
 		}},
-		{message: "Á", expect: []Letter{
-			{
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-			},
-		}},
-		{message: "🔥", expect: []Letter{
-			{
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-				Row{1, 1, 1},
-			},
-		}},
-
+		{message: "Á", expect: []Letter{TI84.Charmap["A"]}},
+		{message: "🔥", expect: []Letter{TI84.Charmap["?"]}},
+		{message: "👍🏽\r\nﬁ", expect: []Letter{TI84.Charmap["?"], nil, TI84.Charmap["?"]}},
 	}
 	for index, testCase := range tests {
 		got := Render(testCase.message)
@@ -320,3 +395,102 @@ func TestRender(t *testing.T) {
 		}
 	}
 }
+
+func TestBold(t *testing.T) {
+	tests := map[string]struct {
+		letter   Letter
+		expected Letter
+	}{
+		"blank column on the right": {
+			letter: Letter{
+				Row{1, 0, 0},
+				Row{0, 1, 0},
+			},
+			expected: Letter{
+				Row{1, 1, 0},
+				Row{0, 1, 1},
+			},
+		},
+		"dots in the last column make it wider": {
+			letter: Letter{
+				Row{1, 0},
+				Row{0, 1},
+			},
+			expected: Letter{
+				Row{1, 1, 0},
+				Row{0, 1, 1},
+			},
+		},
+		"newline": {
+			letter:   nil,
+			expected: nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := Bold(test.letter)
+			if !reflect.DeepEqual(test.expected, got) {
+				t.Errorf("Expected\n%s", test.expected)
+				t.Errorf("Got\n%s", got)
+			}
+		})
+	}
+}
+
+func TestScale(t *testing.T) {
+	letter := Letter{
+		Row{1, 0},
+		Row{0, 1},
+	}
+
+	expected := Letter{
+		Row{1, 1, 0, 0},
+		Row{1, 1, 0, 0},
+		Row{0, 0, 1, 1},
+		Row{0, 0, 1, 1},
+	}
+
+	got := Scale(letter, 2)
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected\n%s", expected)
+		t.Errorf("Got\n%s", got)
+	}
+
+	if !reflect.DeepEqual(letter, Scale(letter, 1)) {
+		t.Error("scaling by 1 should be the same letter")
+	}
+
+	if Scale(nil, 3) != nil {
+		t.Error("new lines should stay nil")
+	}
+}
+
+func TestRenderWithFont(t *testing.T) {
+	font, err := LoadBDF("test_fixtures/tiny.bdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := RenderWithFont("A A\n", &font, 1)
+	if len(got) != 4 {
+		t.Fatalf("Expected 4 letters, got %d", len(got))
+	}
+	if !reflect.DeepEqual(font.Charmap["A"], got[0]) {
+		t.Errorf("Expected the font's A, got\n%s", got[0])
+	}
+	if !reflect.DeepEqual(GenerateSpace(4, 6, 0), got[1]) {
+		t.Errorf("Expected the font's own space, got\n%s", got[1])
+	}
+	if got[3] != nil {
+		t.Error("new lines should be nil")
+	}
+
+	scaled := RenderWithFont("A", &font, 3)
+	if len(scaled[0]) != 18 || len(scaled[0][0]) != 12 {
+		t.Errorf("Expected a 12x18 letter, got %dx%d", len(scaled[0][0]), len(scaled[0]))
+	}
+	if LineHeight(&font, 3) != 18 {
+		t.Errorf("Expected the line height to scale with the font, got %d", LineHeight(&font, 3))
+	}
+}
@@ -0,0 +1,117 @@
+package fontmap
+
+import (
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultReplacementGlyph is drawn for characters a font doesn't have
+const DefaultReplacementGlyph = "?"
+
+var replacement = struct {
+	sync.RWMutex
+	glyph string
+}{glyph: DefaultReplacementGlyph}
+
+// SetReplacementGlyph changes the character that's drawn for characters a font doesn't have
+func SetReplacementGlyph(glyph string) {
+	replacement.Lock()
+	defer replacement.Unlock()
+	replacement.glyph = glyph
+}
+
+// ReplacementGlyph is the character that's drawn for characters a font doesn't have
+func ReplacementGlyph() string {
+	replacement.RLock()
+	defer replacement.RUnlock()
+	return replacement.glyph
+}
+
+// Glyph finds the letter for a character. Characters the font doesn't have come from its fallback fonts,
+// then the default font. Accented letters none of them have fall back to the letter without the accent,
+// so é is drawn as e. The returned letter can be the font's, don't change it.
+func (font *Font) Glyph(char string) (Letter, bool) {
+	chain := font.fallbackChain()
+	for _, f := range chain {
+		if letter, exists := f.Charmap[char]; exists {
+			return onBaseline(letter, f, font), true
+		}
+	}
+
+	// é can be decomposed into e and an accent, ﬁ or Ｗ have compatibility decompositions into fi and W
+	for _, form := range []norm.Form{norm.NFD, norm.NFKD} {
+		base, marksOnly := baseCharacter(form.String(char))
+		if !marksOnly {
+			continue
+		}
+		for _, f := range chain {
+			if letter, exists := f.Charmap[base]; exists {
+				return onBaseline(letter, f, font), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// onBaseline moves a letter from a fallback font so it sits on the font's baseline, and is as tall as the font's letters
+func onBaseline(letter Letter, from, to *Font) Letter {
+	fromBaseline := from.Metadata.MaxHeight - from.Metadata.Descent
+	toBaseline := to.Metadata.MaxHeight - to.Metadata.Descent
+	if from == to || (fromBaseline == toBaseline && from.Metadata.MaxHeight == to.Metadata.MaxHeight) {
+		return letter
+	}
+
+	moved := GenerateSpace(letter.Width(), to.Metadata.MaxHeight, 0)
+	for y := range moved {
+		fromY := y - toBaseline + fromBaseline
+		if fromY >= 0 && fromY < len(letter) {
+			copy(moved[y], letter[fromY])
+		}
+	}
+	return moved
+}
+
+// baseCharacter splits off the first character, marksOnly is false if there's more than accents after it
+func baseCharacter(decomposed string) (base string, marksOnly bool) {
+	for i, r := range decomposed {
+		if i == 0 {
+			base = string(r)
+			continue
+		}
+		if !unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc, unicode.Variation_Selector) {
+			return base, false
+		}
+	}
+	return base, base != ""
+}
+
+// Replacement is the letter drawn for characters the font doesn't have. If the font doesn't have the
+// replacement glyph either, it's an empty box.
+func (font *Font) Replacement() Letter {
+	if letter, exists := font.Glyph(ReplacementGlyph()); exists {
+		return letter
+	}
+
+	// a box the height of the capital letters, sitting on the baseline
+	height := font.Metadata.Ascent
+	if height <= 0 || height > font.Metadata.MaxHeight {
+		height = font.Metadata.MaxHeight
+	}
+	top := font.Metadata.MaxHeight - font.Metadata.Descent - height
+	if top < 0 {
+		top = 0
+	}
+
+	box := GenerateSpace(4, font.Metadata.MaxHeight, 0)
+	for y := top; y < top+height && y < len(box); y++ {
+		for x := 0; x < 3; x++ {
+			if y == top || y == top+height-1 || x == 0 || x == 2 {
+				box[y][x] = 1
+			}
+		}
+	}
+	return box
+}
@@ -0,0 +1,93 @@
+package fontmap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGlyph(t *testing.T) {
+	tests := []struct {
+		char     string
+		expected Letter
+		exists   bool
+	}{
+		{char: "e", expected: TI84.Charmap["e"], exists: true},
+		{char: "é", expected: TI84.Charmap["e"], exists: true},
+		{char: "é", expected: TI84.Charmap["e"], exists: true},
+		{char: "Ñ", expected: TI84.Charmap["N"], exists: true},
+		{char: "Ｗ", expected: TI84.Charmap["W"], exists: true},
+		{char: "ﬁ", expected: nil, exists: false},
+		{char: "🔥", expected: nil, exists: false},
+	}
+
+	for _, testCase := range tests {
+		got, exists := TI84.Glyph(testCase.char)
+		if exists != testCase.exists || !reflect.DeepEqual(testCase.expected, got) {
+			t.Errorf("%q: Expected %v %v, but got %v %v", testCase.char, testCase.expected, testCase.exists, got, exists)
+		}
+	}
+}
+
+func TestGlyphFallbacks(t *testing.T) {
+	// slack turns quotes into curly ones, they come from TI84Extended
+	if got, exists := TI84.Glyph("“"); !exists || !reflect.DeepEqual(TI84Extended.Charmap["“"], got) {
+		t.Errorf("Expected “ from TI84Extended, but got %v %v", got, exists)
+	}
+	if got, exists := TI84.Glyph("Ё"); !exists || !reflect.DeepEqual(TI84.Charmap["E"], got) {
+		t.Errorf("Expected Ё to fall back to Е, but got %v %v", got, exists)
+	}
+
+	// 3 dots tall with 1 below the baseline, TI84 letters have to be moved up a row and cut off to fit
+	short := Font{
+		Name:      "short",
+		Metadata:  MetadataType{MaxHeight: 3, Ascent: 2, Descent: 1},
+		Charmap:   CharmapType{"a": Letter{{1}, {1}, {1}}},
+		Fallbacks: []string{"looped"},
+	}
+	looped := Font{Name: "looped", Charmap: CharmapType{}, Fallbacks: []string{"short"}}
+	Register(&short)
+	Register(&looped)
+
+	// the fallbacks loop back around, nobody has ■
+	if got, exists := short.Glyph("■"); exists {
+		t.Errorf("Expected no ■, but got\n%s", got)
+	}
+
+	got, exists := short.Glyph("B")
+	expected := Letter{
+		TI84.Charmap["B"][3],
+		TI84.Charmap["B"][4],
+		TI84.Charmap["B"][5],
+	}
+	if !exists || !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected the bottom of TI84's B\n%s, but got\n%s", expected, got)
+	}
+}
+
+func TestReplacement(t *testing.T) {
+	defer SetReplacementGlyph(DefaultReplacementGlyph)
+
+	if got := TI84.Replacement(); !reflect.DeepEqual(TI84.Charmap["?"], got) {
+		t.Errorf("Expected the ? letter, but got\n%s", got)
+	}
+
+	SetReplacementGlyph("*")
+	if got := Render("🔥"); !reflect.DeepEqual([]Letter{TI84.Charmap["*"]}, got) {
+		t.Errorf("Expected the * letter, but got %v", got)
+	}
+
+	// the font doesn't have the replacement glyph, so it's a box sitting on the baseline
+	SetReplacementGlyph("🔥")
+	expected := Letter{
+		{1, 1, 1, 0},
+		{1, 0, 1, 0},
+		{1, 0, 1, 0},
+		{1, 0, 1, 0},
+		{1, 1, 1, 0},
+		{0, 0, 0, 0},
+		{0, 0, 0, 0},
+	}
+	if got := TI84.Replacement(); !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected\n%s, but got\n%s", expected, got)
+	}
+}
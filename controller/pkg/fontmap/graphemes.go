@@ -0,0 +1,71 @@
+package fontmap
+
+import (
+	"unicode"
+)
+
+const zeroWidthJoiner = '\u200d'
+
+// Graphemes splits msg into what people would call characters, so an accent, an emoji skin tone or the
+// two halves of a flag stay with the character they belong to. It's a simplified version of the
+// extended grapheme clusters from Unicode's UAX #29, it covers what shows up in slack messages.
+func Graphemes(msg string) []string {
+	var graphemes []string
+
+	start := 0
+	prev := rune(-1)
+	regionalIndicators := 0 // how many flag halves are in the current grapheme
+	for i, r := range msg {
+		if i > start && !continuesGrapheme(prev, r, regionalIndicators) {
+			graphemes = append(graphemes, msg[start:i])
+			start = i
+			regionalIndicators = 0
+		}
+
+		if isRegionalIndicator(r) {
+			regionalIndicators++
+		}
+		prev = r
+	}
+
+	if start < len(msg) {
+		graphemes = append(graphemes, msg[start:])
+	}
+	return graphemes
+}
+
+// continuesGrapheme is true when r belongs to the same character as prev
+func continuesGrapheme(prev, r rune, regionalIndicators int) bool {
+	switch {
+	case prev == '\r' && r == '\n':
+		return true
+	case prev == '\r' || prev == '\n' || r == '\r' || r == '\n':
+		return false
+	case r == zeroWidthJoiner || prev == zeroWidthJoiner: // 👩‍💻 is a woman, a joiner and a laptop
+		return true
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc, unicode.Variation_Selector):
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF: // skin tones
+		return true
+	case isRegionalIndicator(prev) && isRegionalIndicator(r): // flags are pairs of regional indicators
+		return regionalIndicators%2 == 1
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// IsNewline is true for the graphemes that start a new line
+func IsNewline(char string) bool {
+	return char == "\n" || char == "\r\n" || char == "\r"
+}
+
+// IsSpace is true for graphemes that are whitespace, but not new lines
+func IsSpace(char string) bool {
+	for _, r := range char {
+		return unicode.IsSpace(r) && !IsNewline(char)
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package fontmap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGraphemes(t *testing.T) {
+	tests := []struct {
+		msg      string
+		expected []string
+	}{
+		{msg: "", expected: nil},
+		{msg: "hi", expected: []string{"h", "i"}},
+		{msg: "José", expected: []string{"J", "o", "s", "é"}},
+		{msg: "José!", expected: []string{"J", "o", "s", "é", "!"}},
+		{msg: "a\r\nb\n", expected: []string{"a", "\r\n", "b", "\n"}},
+		{msg: "👍🏽👍", expected: []string{"👍🏽", "👍"}},
+		{msg: "👩‍💻.", expected: []string{"👩‍💻", "."}},
+		{msg: "❤️x", expected: []string{"❤️", "x"}},
+		{msg: "🇨🇦🇺🇸🇫", expected: []string{"🇨🇦", "🇺🇸", "🇫"}},
+		{msg: "it’s", expected: []string{"i", "t", "’", "s"}},
+	}
+
+	for _, testCase := range tests {
+		got := Graphemes(testCase.msg)
+		if !reflect.DeepEqual(testCase.expected, got) {
+			t.Errorf("%q: Expected %q, but got %q", testCase.msg, testCase.expected, got)
+		}
+	}
+}
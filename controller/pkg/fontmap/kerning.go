@@ -0,0 +1,80 @@
+package fontmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseKerning reads a kerning table, one pair per line: the left letter, the right letter, and how many
+// columns to move the right letter, e.g. "A V -1". Blank lines and lines starting with # are skipped.
+func ParseKerning(r io.Reader) (map[string]int, error) {
+	kerning := map[string]int{}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("kerning line %d: expected \"<left> <right> <amount>\", got %q", lineNumber, line)
+		}
+
+		amount, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("kerning line %d: %s isn't a number", lineNumber, fields[2])
+		}
+
+		kerning[fields[0]+fields[1]] = amount
+	}
+
+	return kerning, scanner.Err()
+}
+
+// LoadKerning reads a kerning table from a file
+func LoadKerning(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	kerning, err := ParseKerning(f)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load %s: %s", path, err)
+	}
+	return kerning, nil
+}
+
+// WriteKerning saves a kerning table in the format ParseKerning reads, sorted so it diffs nicely.
+// Pairs that aren't two letters can't be split back apart, and spaces can't be written, they're skipped.
+func WriteKerning(w io.Writer, kerning map[string]int) error {
+	var pairs []string
+	for pair := range kerning {
+		chars := Graphemes(pair)
+		if len(chars) == 2 && strings.IndexFunc(pair, unicode.IsSpace) < 0 && chars[0] != "#" {
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.Strings(pairs)
+
+	var b strings.Builder
+	b.WriteString("# left right amount\n")
+	for _, pair := range pairs {
+		chars := Graphemes(pair)
+		fmt.Fprintf(&b, "%s %s %d\n", chars[0], chars[1], kerning[pair])
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
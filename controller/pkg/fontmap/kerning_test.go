@@ -0,0 +1,50 @@
+package fontmap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKerning(t *testing.T) {
+	kerning, err := ParseKerning(strings.NewReader(`
+# tuck the diagonals in
+A V -1
+V A -1
+
+T o -2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{"AV": -1, "VA": -1, "To": -2}
+	if !reflect.DeepEqual(expected, kerning) {
+		t.Errorf("Expected %v, but got %v", expected, kerning)
+	}
+
+	for _, bad := range []string{"A V", "A V x", "A V -1 2"} {
+		if _, err := ParseKerning(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q should be an error", bad)
+		}
+	}
+}
+
+func TestWriteKerning(t *testing.T) {
+	kerning := map[string]int{"AV": -1, "To": -2, "A ": 1}
+
+	var saved strings.Builder
+	if err := WriteKerning(&saved, kerning); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ParseKerning(strings.NewReader(saved.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{"AV": -1, "To": -2} // spaces can't be written
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
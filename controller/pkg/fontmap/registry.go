@@ -0,0 +1,172 @@
+package fontmap
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultFontName is the font used when a message doesn't ask for one
+const DefaultFontName = "TI84"
+
+// registry has the fonts that were registered in code, and the ones LoadDir loaded from files.
+// Loaded fonts win when they have the same name, and they're all replaced every time LoadDir runs.
+var registry = struct {
+	sync.RWMutex
+	fonts  map[string]*Font
+	loaded map[string]*Font
+}{fonts: map[string]*Font{}, loaded: map[string]*Font{}}
+
+func init() {
+	Register(&TI84)
+	Register(&TI84Extended)
+}
+
+// Register makes the font available by name, replacing any font with the same name
+func Register(font *Font) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.fonts[strings.ToLower(font.Name)] = font
+}
+
+// Get finds a registered font, names aren't case sensitive
+func Get(name string) (*Font, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	if font, exists := registry.loaded[strings.ToLower(name)]; exists {
+		return font, true
+	}
+	font, exists := registry.fonts[strings.ToLower(name)]
+	return font, exists
+}
+
+// Names returns the names of all the registered fonts, sorted
+func Names() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	fonts := map[string]*Font{}
+	for key, font := range registry.fonts {
+		fonts[key] = font
+	}
+	for key, font := range registry.loaded {
+		fonts[key] = font
+	}
+
+	var names []string
+	for _, font := range fonts {
+		names = append(names, font.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadDir registers every .bdf font in dir, with the .kern kerning table and .fallbacks fallback fonts
+// of the same name if there are any. They replace the fonts it loaded before, so fonts that were removed
+// from dir go away. When dir can't be read the fonts from before are kept.
+// Fonts that can't be loaded are logged and skipped.
+func LoadDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.New("couldn't read fonts dir: " + err.Error())
+	}
+
+	loaded := map[string]*Font{}
+
+	for _, file := range files {
+		if file.IsDir() || strings.ToLower(filepath.Ext(file.Name())) != ".bdf" {
+			continue
+		}
+
+		font, err := LoadBDF(filepath.Join(dir, file.Name()))
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		// fonts/5x7.bdf can have its kerning table next to it in fonts/5x7.kern
+		kerningPath := filepath.Join(dir, font.Name+".kern")
+		if _, err := os.Stat(kerningPath); err == nil {
+			font.Kerning, err = LoadKerning(kerningPath)
+			if err != nil {
+				log.Error(err)
+			}
+		}
+
+		// and its fallback fonts in fonts/5x7.fallbacks
+		fallbacksPath := filepath.Join(dir, font.Name+".fallbacks")
+		if _, err := os.Stat(fallbacksPath); err == nil {
+			font.Fallbacks, err = LoadFallbacks(fallbacksPath)
+			if err != nil {
+				log.Error(err)
+			}
+		}
+
+		log.Infof("loaded font %s, %d characters, %d dots tall", font.Name, len(font.Charmap), font.Metadata.MaxHeight)
+		loaded[strings.ToLower(font.Name)] = &font
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	registry.loaded = loaded
+	return nil
+}
+
+// UnloadDir removes the fonts LoadDir loaded, the ones registered in code stay
+func UnloadDir() {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.loaded = map[string]*Font{}
+}
+
+// LoadFallbacks reads the names of a font's fallback fonts, they're separated by spaces or new lines.
+// Lines starting with # are skipped.
+func LoadFallbacks(path string) ([]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(raw), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		names = append(names, strings.Fields(line)...)
+	}
+	return names, nil
+}
+
+// fallbackChain is the font, then its fallbacks and their fallbacks, then the default font and its fallbacks.
+// Every font is only in it once, and fallbacks that aren't registered are skipped.
+func (font *Font) fallbackChain() []*Font {
+	var chain []*Font
+	seen := map[*Font]bool{}
+
+	var add func(f *Font)
+	add = func(f *Font) {
+		if f == nil || seen[f] {
+			return
+		}
+		seen[f] = true
+		chain = append(chain, f)
+
+		for _, name := range f.Fallbacks {
+			if fallback, exists := Get(name); exists {
+				add(fallback)
+			}
+		}
+	}
+
+	add(font)
+	if defaultFont, exists := Get(DefaultFontName); exists {
+		add(defaultFont)
+	}
+	return chain
+}
@@ -0,0 +1,228 @@
+package fontmap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// sheet colors, a dot is black, no dot is white, and the grid between the cells is a light grey
+var (
+	sheetDot    = color.Gray{Y: 0}
+	sheetNoDot  = color.Gray{Y: 255}
+	sheetGutter = color.Gray{Y: 200}
+)
+
+// SheetMetrics says where every glyph is in a glyph sheet, it's saved as json next to the png.
+// The glyphs go left to right, top to bottom, one per cell, and the cells have a 1 pixel grid between them.
+type SheetMetrics struct {
+	Name    string `json:"name"`
+	Ascent  int    `json:"ascent"`
+	Descent int    `json:"descent"`
+
+	CellWidth  int `json:"cellWidth"`  // in dots
+	CellHeight int `json:"cellHeight"` // in dots, the height of the font
+	Columns    int `json:"columns"`
+	Scale      int `json:"scale"` // how many pixels wide and tall a dot is
+
+	Glyphs  []SheetGlyph   `json:"glyphs"`
+	Kerning map[string]int `json:"kerning,omitempty"`
+}
+
+// SheetGlyph is a letter in the sheet, Width is how many columns of its cell it uses
+type SheetGlyph struct {
+	Char  string `json:"char"`
+	Width int    `json:"width"`
+}
+
+// ExportSheet draws every letter of the font into a grid, columns cells wide, with every dot scale x scale pixels
+func ExportSheet(font *Font, columns, scale int) (*image.Gray, SheetMetrics) {
+	if columns < 1 {
+		columns = 16
+	}
+	if scale < 1 {
+		scale = 1
+	}
+
+	metrics := SheetMetrics{
+		Name:       font.Name,
+		Ascent:     font.Metadata.Ascent,
+		Descent:    font.Metadata.Descent,
+		CellHeight: font.Metadata.MaxHeight,
+		Columns:    columns,
+		Scale:      scale,
+		Kerning:    font.Kerning,
+	}
+
+	var chars []string
+	for char, letter := range font.Charmap {
+		chars = append(chars, char)
+		if letter.Width() > metrics.CellWidth {
+			metrics.CellWidth = letter.Width()
+		}
+		if len(letter) > metrics.CellHeight {
+			metrics.CellHeight = len(letter)
+		}
+	}
+	sort.Strings(chars)
+
+	for _, char := range chars {
+		metrics.Glyphs = append(metrics.Glyphs, SheetGlyph{Char: char, Width: font.Charmap[char].Width()})
+	}
+
+	width, height := metrics.size()
+	sheet := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sheet.SetGray(x, y, sheetGutter)
+		}
+	}
+
+	for i, glyph := range metrics.Glyphs {
+		letter := font.Charmap[glyph.Char]
+		cellX, cellY := metrics.cell(i)
+		for y := 0; y < metrics.CellHeight; y++ {
+			for x := 0; x < metrics.CellWidth; x++ {
+				c := sheetNoDot
+				if y < len(letter) && x < len(letter[y]) && letter[y][x] != 0 {
+					c = sheetDot
+				}
+				metrics.fillDot(sheet, cellX, cellY, x, y, c)
+			}
+		}
+	}
+
+	return sheet, metrics
+}
+
+// ImportSheet reads the letters back out of a glyph sheet, a pixel that's more dark than light is a dot.
+// Only the first Width columns of every cell are used, widen a glyph by changing its Width in the metrics.
+func ImportSheet(sheet image.Image, metrics SheetMetrics) (Font, error) {
+	font := Font{
+		Name:    metrics.Name,
+		Charmap: CharmapType{},
+		Kerning: metrics.Kerning,
+		Metadata: MetadataType{
+			MaxHeight: metrics.CellHeight,
+			Ascent:    metrics.Ascent,
+			Descent:   metrics.Descent,
+		},
+	}
+
+	if metrics.CellWidth < 1 || metrics.CellHeight < 1 || metrics.Columns < 1 || metrics.Scale < 1 {
+		return font, errors.New("sheet metrics need a cellWidth, cellHeight, columns and scale of at least 1")
+	}
+
+	width, height := metrics.size()
+	if sheet.Bounds().Dx() < width || sheet.Bounds().Dy() < height {
+		return font, fmt.Errorf("sheet is %dx%d, the metrics need it to be at least %dx%d",
+			sheet.Bounds().Dx(), sheet.Bounds().Dy(), width, height)
+	}
+
+	var totalHeight, totalWidth int
+	for i, glyph := range metrics.Glyphs {
+		if glyph.Width < 0 || glyph.Width > metrics.CellWidth {
+			return font, fmt.Errorf("glyph %q is %d wide, it has to fit in its %d wide cell", glyph.Char, glyph.Width, metrics.CellWidth)
+		}
+		if _, exists := font.Charmap[glyph.Char]; exists {
+			return font, fmt.Errorf("glyph %q is in the sheet twice", glyph.Char)
+		}
+
+		cellX, cellY := metrics.cell(i)
+		letter := GenerateSpace(glyph.Width, metrics.CellHeight, 0)
+		top, bottom := metrics.CellHeight, 0
+		for y := range letter {
+			for x := range letter[y] {
+				if metrics.isDot(sheet, cellX, cellY, x, y) {
+					letter[y][x] = 1
+					if y < top {
+						top = y
+					}
+					bottom = y + 1
+				}
+			}
+		}
+		font.Charmap[glyph.Char] = letter
+
+		if bottom > top {
+			totalHeight += bottom - top
+		}
+		totalWidth += glyph.Width
+	}
+
+	if len(font.Charmap) > 0 {
+		font.Metadata.AverageHeight = totalHeight / len(font.Charmap)
+		font.Metadata.AverageWidth = totalWidth / len(font.Charmap)
+	}
+
+	// fonts from before there were baselines sit everything on the bottom row
+	if font.Metadata.Ascent+font.Metadata.Descent != font.Metadata.MaxHeight {
+		font.Metadata.Ascent, font.Metadata.Descent = font.Metadata.MaxHeight, 0
+	}
+
+	return font, nil
+}
+
+// WriteSheetMetrics saves the metrics as indented json, so they're easy to edit by hand
+func WriteSheetMetrics(w io.Writer, metrics SheetMetrics) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(metrics)
+}
+
+// ReadSheetMetrics reads the json from WriteSheetMetrics
+func ReadSheetMetrics(r io.Reader) (SheetMetrics, error) {
+	var metrics SheetMetrics
+	if err := json.NewDecoder(r).Decode(&metrics); err != nil {
+		return metrics, errors.New("couldn't read sheet metrics: " + err.Error())
+	}
+
+	for _, glyph := range metrics.Glyphs {
+		if glyph.Char == "" || !utf8.ValidString(glyph.Char) {
+			return metrics, fmt.Errorf("sheet metrics have a glyph without a char: %+v", glyph)
+		}
+	}
+	return metrics, nil
+}
+
+// size is how big the whole sheet is in pixels, with the grid around every cell
+func (metrics SheetMetrics) size() (width, height int) {
+	rows := (len(metrics.Glyphs) + metrics.Columns - 1) / metrics.Columns
+	if rows < 1 {
+		rows = 1
+	}
+	width = metrics.Columns*(metrics.CellWidth*metrics.Scale+1) + 1
+	height = rows*(metrics.CellHeight*metrics.Scale+1) + 1
+	return width, height
+}
+
+// cell is the top left pixel of glyph i's cell
+func (metrics SheetMetrics) cell(i int) (x, y int) {
+	x = (i%metrics.Columns)*(metrics.CellWidth*metrics.Scale+1) + 1
+	y = (i/metrics.Columns)*(metrics.CellHeight*metrics.Scale+1) + 1
+	return x, y
+}
+
+func (metrics SheetMetrics) fillDot(sheet *image.Gray, cellX, cellY, x, y int, c color.Gray) {
+	for py := 0; py < metrics.Scale; py++ {
+		for px := 0; px < metrics.Scale; px++ {
+			sheet.SetGray(cellX+x*metrics.Scale+px, cellY+y*metrics.Scale+py, c)
+		}
+	}
+}
+
+// isDot looks at the middle of the dot, so a stray pixel on the edge of a dot when it's drawn by hand doesn't matter
+func (metrics SheetMetrics) isDot(sheet image.Image, cellX, cellY, x, y int) bool {
+	b := sheet.Bounds()
+	px := b.Min.X + cellX + x*metrics.Scale + metrics.Scale/2
+	py := b.Min.Y + cellY + y*metrics.Scale + metrics.Scale/2
+
+	gray := color.GrayModel.Convert(sheet.At(px, py)).(color.Gray)
+	_, _, _, alpha := sheet.At(px, py).RGBA()
+	return alpha > 0x7fff && gray.Y < 128
+}
@@ -0,0 +1,89 @@
+package fontmap
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestSheetRoundTrip(t *testing.T) {
+	sheet, metrics := ExportSheet(&TI84, 10, 3)
+
+	var saved bytes.Buffer
+	if err := WriteSheetMetrics(&saved, metrics); err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := ReadSheetMetrics(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	font, err := ImportSheet(sheet, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if font.Name != TI84.Name || font.Metadata.Ascent != TI84.Metadata.Ascent || font.Metadata.MaxHeight != TI84.Metadata.MaxHeight {
+		t.Errorf("Expected %s %+v, got %s %+v", TI84.Name, TI84.Metadata, font.Name, font.Metadata)
+	}
+	if !reflect.DeepEqual(TI84.Charmap, font.Charmap) {
+		t.Error("the letters should be the same after exporting and importing")
+	}
+}
+
+func TestImportSheet(t *testing.T) {
+	metrics := SheetMetrics{
+		Name:       "drawn",
+		Ascent:     2,
+		CellWidth:  3,
+		CellHeight: 2,
+		Columns:    1,
+		Scale:      2,
+		Glyphs:     []SheetGlyph{{Char: "a", Width: 2}},
+	}
+
+	// a 3x2 cell of 2x2 pixel dots, with a 1 pixel grid around it
+	sheet := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			sheet.Set(x, y, color.White)
+		}
+	}
+	dot := func(x, y int, c color.Color) {
+		for py := 0; py < 2; py++ {
+			for px := 0; px < 2; px++ {
+				sheet.Set(1+x*2+px, 1+y*2+py, c)
+			}
+		}
+	}
+	dot(0, 0, color.Black)
+	dot(1, 1, color.RGBA{R: 40, G: 40, B: 90, A: 255}) // dark enough to be a dot
+	dot(2, 1, color.Black)                             // past the glyph's width
+
+	font, err := ImportSheet(sheet, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Letter{
+		Row{1, 0},
+		Row{0, 1},
+	}
+	if !reflect.DeepEqual(expected, font.Charmap["a"]) {
+		t.Errorf("Expected\n%s", expected)
+		t.Errorf("Got\n%s", font.Charmap["a"])
+	}
+
+	metrics.Glyphs[0].Width = 4
+	if _, err := ImportSheet(sheet, metrics); err == nil {
+		t.Error("a glyph that's wider than its cell should be an error")
+	}
+
+	metrics.Glyphs = append(metrics.Glyphs, SheetGlyph{Char: "b", Width: 1})
+	metrics.Glyphs[0].Width = 2
+	if _, err := ImportSheet(sheet, metrics); err == nil {
+		t.Error("a sheet that's too small for the glyphs should be an error")
+	}
+}
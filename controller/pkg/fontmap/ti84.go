@@ -7,15 +7,10 @@ var TI84 Font = Font{
 		AverageHeight: 5,
 		AverageWidth:  4,
 		MaxHeight:     7,
-		TallerCharacters: map[string]int{
-			"Q": 6,
-			"g": 6,
-			"j": 6,
-			"p": 6,
-			"q": 6,
-			"y": 6,
-		},
+		Ascent:        5,
+		Descent:       2, // Q, g, j, p, q and y have tails
 	},
+	Fallbacks: []string{"TI84Extended"},
 	Charmap: CharmapType{
 		"A": Letter{
 			Row{1, 1, 1, 0},
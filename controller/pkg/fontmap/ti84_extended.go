@@ -0,0 +1,222 @@
+package fontmap
+
+// TI84Extended is the characters that aren't in TI84, it's TI84's fallback font. It has the punctuation
+// slack likes to use, like curly quotes and em dashes, currency, arrows, box drawing, Greek and Cyrillic.
+// Letters that look the same as a latin letter, like Greek Α or Cyrillic С, are TI84's letter.
+// Accented letters like Ё or ά fall back to the letter without the accent, so they aren't here.
+var TI84Extended = Font{
+	Name:     "TI84Extended",
+	Metadata: TI84.Metadata,
+	Charmap: CharmapType{
+		// punctuation
+		"‘": drawn(".#.", "##."),
+		"’": TI84.Charmap["'"],
+		"‚": TI84.Charmap[","],
+		"‛": drawn("##.", "#.."),
+		"“": drawn(".#..#.", "##.##."),
+		"”": drawn("##.##.", ".#..#."),
+		"„": drawn("......", "......", "......", "......", ".#..#.", ".#..#.", "#..#.."),
+		"‹": drawn("...", ".#.", "#..", ".#."),
+		"›": drawn("...", "#..", ".#.", "#.."),
+		"«": drawn(".....", ".#.#.", "#.#..", ".#.#."),
+		"»": drawn(".....", "#.#..", ".#.#.", "#.#.."),
+		"‐": TI84.Charmap["-"],
+		"‑": TI84.Charmap["-"],
+		"−": TI84.Charmap["-"],
+		"–": drawn(".....", ".....", "####."),
+		"—": drawn("......", "......", "######"),
+		"…": drawn("......", "......", "......", "......", "#.#.#."),
+		"•": drawn("...", "...", "##.", "##."),
+		"·": drawn("..", "..", "#."),
+		"¡": drawn(".#.", "...", ".#.", ".#.", ".#."),
+		"¿": drawn(".#..", "....", ".#..", "#...", ".##."),
+		"°": drawn(".#..", "#.#.", ".#.."),
+		"±": drawn(".#..", "###.", ".#..", "....", "###."),
+		"×": drawn("....", "#.#.", ".#..", "#.#."),
+		"÷": drawn(".#..", "....", "###.", "....", ".#.."),
+
+		// currency
+		"€": drawn(".##.", "#...", "###.", "#...", ".##."),
+		"£": drawn("..##.", ".#...", "###..", ".#...", "####."),
+		"¥": drawn("#.#.", "#.#.", ".#..", "###.", ".#.."),
+		"¢": drawn(".#..", "###.", "#...", "###.", ".#.."),
+
+		// arrows
+		"←": drawn("..#...", ".#....", "#####.", ".#....", "..#..."),
+		"→": drawn("..#...", "...#..", "#####.", "...#..", "..#..."),
+		"↑": drawn("..#...", ".###..", "#.#.#.", "..#...", "..#..."),
+		"↓": drawn("..#...", "..#...", "#.#.#.", ".###..", "..#..."),
+		"↔": drawn("......", ".#.#..", "#####.", ".#.#.."),
+		"↕": drawn(".#..", "###.", ".#..", ".#..", "###.", ".#.."),
+		"↖": drawn("###...", "##....", "#.#...", "...#..", "....#."),
+		"↗": drawn("..###.", "...##.", "..#.#.", ".#....", "#....."),
+		"↘": drawn("#.....", ".#....", "..#.#.", "...##.", "..###."),
+		"↙": drawn("....#.", "...#..", "#.#...", "##....", "###..."),
+		"⇐": drawn("..#...", ".####.", "#.....", ".####.", "..#..."),
+		"⇒": drawn("..#...", "####..", "....#.", "####..", "..#..."),
+
+		// box drawing, these fill the whole letter so they join up with the letters next to them
+		"─": drawn(".....", ".....", ".....", "#####", ".....", ".....", "....."),
+		"│": drawn("..#..", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."),
+		"┌": drawn(".....", ".....", ".....", "..###", "..#..", "..#..", "..#.."),
+		"┐": drawn(".....", ".....", ".....", "###..", "..#..", "..#..", "..#.."),
+		"└": drawn("..#..", "..#..", "..#..", "..###", ".....", ".....", "....."),
+		"┘": drawn("..#..", "..#..", "..#..", "###..", ".....", ".....", "....."),
+		"├": drawn("..#..", "..#..", "..#..", "..###", "..#..", "..#..", "..#.."),
+		"┤": drawn("..#..", "..#..", "..#..", "###..", "..#..", "..#..", "..#.."),
+		"┬": drawn(".....", ".....", ".....", "#####", "..#..", "..#..", "..#.."),
+		"┴": drawn("..#..", "..#..", "..#..", "#####", ".....", ".....", "....."),
+		"┼": drawn("..#..", "..#..", "..#..", "#####", "..#..", "..#..", "..#.."),
+		"═": drawn(".....", ".....", "#####", ".....", "#####", ".....", "....."),
+		"║": drawn(".#.#.", ".#.#.", ".#.#.", ".#.#.", ".#.#.", ".#.#.", ".#.#."),
+		"╔": drawn(".....", ".....", ".####", ".#...", ".#.##", ".#.#.", ".#.#."),
+		"╗": drawn(".....", ".....", "####.", "...#.", "##.#.", ".#.#.", ".#.#."),
+		"╚": drawn(".#.#.", ".#.#.", ".#.##", ".#...", ".####", ".....", "....."),
+		"╝": drawn(".#.#.", ".#.#.", "##.#.", "...#.", "####.", ".....", "....."),
+		"╠": drawn(".#.#.", ".#.#.", ".#.##", ".#...", ".#.##", ".#.#.", ".#.#."),
+		"╣": drawn(".#.#.", ".#.#.", "##.#.", "...#.", "##.#.", ".#.#.", ".#.#."),
+		"╦": drawn(".....", ".....", "#####", ".....", "##.##", ".#.#.", ".#.#."),
+		"╩": drawn(".#.#.", ".#.#.", "##.##", ".....", "#####", ".....", "....."),
+		"╬": drawn(".#.#.", ".#.#.", "##.##", ".....", "##.##", ".#.#.", ".#.#."),
+		"█": drawn("#####", "#####", "#####", "#####", "#####", "#####", "#####"),
+		"▀": drawn("#####", "#####", "#####", "#####", ".....", ".....", "....."),
+		"▄": drawn(".....", ".....", ".....", ".....", "#####", "#####", "#####"),
+		"░": drawn("#.#.#", ".#.#.", "#.#.#", ".#.#.", "#.#.#", ".#.#.", "#.#.#"),
+
+		// Greek
+		"Α": TI84.Charmap["A"],
+		"Β": TI84.Charmap["B"],
+		"Γ": drawn("###.", "#...", "#...", "#...", "#..."),
+		"Δ": drawn("..#...", ".#.#..", ".#.#..", "#...#.", "#####."),
+		"Ε": TI84.Charmap["E"],
+		"Ζ": TI84.Charmap["Z"],
+		"Η": TI84.Charmap["H"],
+		"Θ": drawn(".###..", "#...#.", "#####.", "#...#.", ".###.."),
+		"Ι": TI84.Charmap["I"],
+		"Κ": TI84.Charmap["K"],
+		"Λ": drawn("..#...", ".#.#..", ".#.#..", "#...#.", "#...#."),
+		"Μ": TI84.Charmap["M"],
+		"Ν": TI84.Charmap["N"],
+		"Ξ": drawn("###.", "....", ".#..", "....", "###."),
+		"Ο": TI84.Charmap["O"],
+		"Π": drawn("####.", "#..#.", "#..#.", "#..#.", "#..#."),
+		"Ρ": TI84.Charmap["P"],
+		"Σ": drawn("####.", ".#...", "..#..", ".#...", "####."),
+		"Τ": TI84.Charmap["T"],
+		"Υ": TI84.Charmap["Y"],
+		"Φ": drawn("..#...", ".###..", "#.#.#.", ".###..", "..#..."),
+		"Χ": TI84.Charmap["X"],
+		"Ψ": drawn("#.#.#.", "#.#.#.", ".###..", "..#...", "..#..."),
+		"Ω": drawn(".###..", "#...#.", "#...#.", ".#.#..", "##.##."),
+		"α": drawn(".....", ".##.#", "#..#.", "#..#.", ".##.#"),
+		"β": drawn("##..", "#.#.", "##..", "#.#.", "##..", "#..."),
+		"γ": drawn("....", "#.#.", "#.#.", ".#..", ".#..", ".#.."),
+		"δ": drawn(".##.", "#...", ".#..", "#.#.", ".#.."),
+		"ε": drawn("....", ".##.", "##..", "#...", ".##."),
+		"ζ": drawn("###.", ".#..", "#...", "#...", ".##.", "..#."),
+		"η": drawn("....", "##..", "#.#.", "#.#.", "#.#.", "..#.", "..#."),
+		"θ": drawn(".#..", "#.#.", "###.", "#.#.", ".#.."),
+		"ι": drawn("...", "#..", "#..", "#..", ".#."),
+		"κ": drawn("....", "#.#.", "##..", "##..", "#.#."),
+		"λ": drawn("#...", "#...", ".#..", "#.#.", "#.#."),
+		"μ": drawn("....", "#.#.", "#.#.", "#.#.", "###.", "#...", "#..."),
+		"ν": drawn(".....", "#..#.", "#..#.", ".#.#.", "..#.."),
+		"ξ": drawn("###.", "#...", "##..", "#...", ".##.", "..#."),
+		"ο": TI84.Charmap["o"],
+		"π": drawn(".....", "####.", ".#.#.", ".#.#.", ".#.#."),
+		"ρ": drawn("....", ".#..", "#.#.", "#.#.", "##..", "#...", "#..."),
+		"σ": drawn(".....", ".###.", "#.#..", "#.#..", ".#..."),
+		"ς": drawn("....", ".##.", "#...", ".#..", "..#.", ".#.."),
+		"τ": drawn("....", "###.", ".#..", ".#..", "..#."),
+		"υ": drawn("....", "#.#.", "#.#.", "#.#.", ".#.."),
+		"φ": drawn("......", "..#...", "#.#.#.", "#.#.#.", ".###..", "..#..."),
+		"χ": drawn("....", "#.#.", "#.#.", ".#..", "#.#.", "#.#."),
+		"ψ": drawn("......", "#.#.#.", "#.#.#.", "#.#.#.", ".###..", "..#..."),
+		"ω": drawn("......", "#...#.", "#.#.#.", "#.#.#.", ".#.#.."),
+
+		// Cyrillic
+		"А": TI84.Charmap["A"],
+		"Б": drawn("###.", "#...", "###.", "#.#.", "###."),
+		"В": TI84.Charmap["B"],
+		"Г": drawn("###.", "#...", "#...", "#...", "#..."),
+		"Д": drawn(".###..", ".#.#..", ".#.#..", "#####.", "#...#."),
+		"Е": TI84.Charmap["E"],
+		"Ж": drawn("#.#.#.", "#.#.#.", ".###..", "#.#.#.", "#.#.#."),
+		"З": drawn("###.", "..#.", ".##.", "..#.", "###."),
+		"И": drawn("#..#.", "#..#.", "#.##.", "##.#.", "#..#."),
+		"К": TI84.Charmap["K"],
+		"Л": drawn(".###.", ".#.#.", ".#.#.", ".#.#.", "#..#."),
+		"М": TI84.Charmap["M"],
+		"Н": TI84.Charmap["H"],
+		"О": TI84.Charmap["O"],
+		"П": drawn("####.", "#..#.", "#..#.", "#..#.", "#..#."),
+		"Р": TI84.Charmap["P"],
+		"С": TI84.Charmap["C"],
+		"Т": TI84.Charmap["T"],
+		"У": drawn("#.#.", "#.#.", ".##.", "..#.", "##.."),
+		"Ф": drawn("..#...", ".###..", "#.#.#.", ".###..", "..#..."),
+		"Х": TI84.Charmap["X"],
+		"Ц": drawn("#.#..", "#.#..", "#.#..", "#.#..", "####.", "...#."),
+		"Ч": drawn("#.#.", "#.#.", "###.", "..#.", "..#."),
+		"Ш": drawn("#.#.#.", "#.#.#.", "#.#.#.", "#.#.#.", "#####."),
+		"Щ": drawn("#.#.#..", "#.#.#..", "#.#.#..", "#.#.#..", "######.", ".....#."),
+		"Ъ": drawn("##....", ".#....", ".###..", ".#..#.", ".###.."),
+		"Ы": drawn("#...#.", "#...#.", "###.#.", "#.#.#.", "###.#."),
+		"Ь": drawn("#...", "#...", "###.", "#.#.", "###."),
+		"Э": drawn(".##..", "...#.", ".###.", "...#.", ".##.."),
+		"Ю": drawn("#..#..", "#.#.#.", "###.#.", "#.#.#.", "#..#.."),
+		"Я": drawn(".###.", "#..#.", ".###.", ".#.#.", "#..#."),
+		"а": TI84.Charmap["a"],
+		"б": drawn(".##.", "#...", "###.", "#.#.", "###."),
+		"в": drawn("....", "##..", "##..", "#.#.", "##.."),
+		"г": drawn("....", "###.", "#...", "#...", "#..."),
+		"д": drawn(".....", ".##..", ".#.#.", "####.", "#..#."),
+		"е": TI84.Charmap["e"],
+		"ж": drawn("......", "#.#.#.", ".###..", ".###..", "#.#.#."),
+		"з": drawn("....", "###.", ".##.", "..#.", "###."),
+		"и": drawn(".....", "#..#.", "#.##.", "##.#.", "#..#."),
+		"к": drawn("....", "#.#.", "##..", "#.#.", "#.#."),
+		"л": drawn(".....", ".###.", ".#.#.", ".#.#.", "#..#."),
+		"м": drawn("......", "#...#.", "##.##.", "#.#.#.", "#...#."),
+		"н": drawn("....", "#.#.", "###.", "#.#.", "#.#."),
+		"о": TI84.Charmap["o"],
+		"п": drawn("....", "###.", "#.#.", "#.#.", "#.#."),
+		"р": TI84.Charmap["p"],
+		"с": TI84.Charmap["c"],
+		"т": drawn("....", "###.", ".#..", ".#..", ".#.."),
+		"у": TI84.Charmap["y"],
+		"ф": drawn("......", "..#...", "#.#.#.", "#.#.#.", ".###..", "..#..."),
+		"х": TI84.Charmap["x"],
+		"ц": drawn(".....", "#.#..", "#.#..", "#.#..", "####.", "...#."),
+		"ч": drawn("....", "#.#.", "#.#.", "###.", "..#."),
+		"ш": drawn("......", "#.#.#.", "#.#.#.", "#.#.#.", "#####."),
+		"щ": drawn(".......", "#.#.#..", "#.#.#..", "#.#.#..", "######.", ".....#."),
+		"ъ": drawn(".....", "##...", ".##..", ".#.#.", ".##.."),
+		"ы": drawn("......", "#...#.", "##..#.", "#.#.#.", "##..#."),
+		"ь": drawn("....", "#...", "##..", "#.#.", "##.."),
+		"э": drawn("....", "##..", ".##.", "..#.", "##.."),
+		"ю": drawn("......", "#..#..", "###.#.", "#.#.#.", "#..#.."),
+		"я": drawn(".....", ".###.", "#..#.", ".###.", "#..#."),
+	},
+}
+
+// drawn turns rows like "#.#." into a letter the height of TI84, a # is a dot. Rows that
+// aren't given are blank, so only the rows down to the baseline or the end of the tail are needed.
+func drawn(rows ...string) Letter {
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	letter := GenerateSpace(width, TI84.Metadata.MaxHeight, 0)
+	for y, row := range rows {
+		for x, dot := range row {
+			if dot == '#' {
+				letter[y][x] = 1
+			}
+		}
+	}
+	return letter
+}
@@ -0,0 +1,269 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"time"
+)
+
+// an animated png is a png with extra chunks, acTL says it's animated, every frame has an fcTL with its size and
+// timing, and the frames after the first keep their pixels in fdAT chunks instead of IDAT.
+// See https://wiki.mozilla.org/APNG_Specification
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// dispose ops, what happens to the frame's region before the next frame is drawn
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1 // cleared to transparent
+	apngDisposePrevious   = 2 // put back to how it was before the frame
+)
+
+// blend ops, how the frame is drawn onto what's already there
+const (
+	apngBlendSource = 0 // replaces it, transparency and all
+	apngBlendOver   = 1
+)
+
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// apngFrame is an fcTL and the image data that goes with it
+type apngFrame struct {
+	width, height, x, y int
+	delay               time.Duration
+	dispose, blend      byte
+	data                []byte // zlib stream, the IDAT or fdAT data stuck together
+}
+
+func readPngChunks(raw []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(raw, pngSignature) {
+		return nil, errors.New("not a png")
+	}
+
+	var chunks []pngChunk
+	for rest := raw[len(pngSignature):]; len(rest) > 0; {
+		if len(rest) < 12 {
+			return nil, errors.New("png chunk is cut off")
+		}
+		length := binary.BigEndian.Uint32(rest[:4])
+		if uint64(length) > uint64(len(rest)-12) {
+			return nil, errors.New("png chunk is cut off")
+		}
+
+		chunk := pngChunk{kind: string(rest[4:8]), data: rest[8 : 8+length]}
+		chunks = append(chunks, chunk)
+		rest = rest[12+length:]
+		if chunk.kind == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// isApng is true for pngs that are animated, they have an acTL before their image data
+func isApng(raw []byte) bool {
+	chunks, err := readPngChunks(raw)
+	if err != nil {
+		return false
+	}
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+	}
+	return false
+}
+
+// decodeApng draws every frame of an animated png onto the canvas, the frames are whole images ready to be shown
+// one after another. loopCount is like a gif's, 0 loops forever, -1 plays once.
+func decodeApng(raw []byte) (frames []image.Image, delays []time.Duration, loopCount int, err error) {
+	chunks, err := readPngChunks(raw)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if len(chunks) == 0 || chunks[0].kind != "IHDR" || len(chunks[0].data) != 13 {
+		return nil, nil, 0, errors.New("png doesn't start with an IHDR")
+	}
+	ihdr := chunks[0].data
+	canvasWidth, canvasHeight := int(binary.BigEndian.Uint32(ihdr[0:4])), int(binary.BigEndian.Uint32(ihdr[4:8]))
+
+	var apngFrames []apngFrame
+	var shared []pngChunk // PLTE, tRNS and friends, every frame needs them to be decoded
+	seenImageData := false
+	plays := uint32(0)
+	for _, chunk := range chunks[1:] {
+		switch chunk.kind {
+		case "acTL":
+			if len(chunk.data) != 8 {
+				return nil, nil, 0, errors.New("acTL is the wrong size")
+			}
+			plays = binary.BigEndian.Uint32(chunk.data[4:8])
+
+		case "fcTL":
+			frame, err := parseFcTL(chunk.data, canvasWidth, canvasHeight)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			apngFrames = append(apngFrames, frame)
+
+		case "IDAT":
+			seenImageData = true
+			// the IDAT is only the first frame when its fcTL comes first, otherwise it's a still for viewers without apng
+			if len(apngFrames) == 1 {
+				apngFrames[0].data = append(apngFrames[0].data, chunk.data...)
+			}
+
+		case "fdAT":
+			if len(chunk.data) < 4 {
+				return nil, nil, 0, errors.New("fdAT is the wrong size")
+			}
+			if len(apngFrames) == 0 {
+				return nil, nil, 0, errors.New("fdAT before any fcTL")
+			}
+			last := &apngFrames[len(apngFrames)-1]
+			last.data = append(last.data, chunk.data[4:]...) // the first 4 bytes are the sequence number
+
+		case "IEND":
+
+		default:
+			if !seenImageData {
+				shared = append(shared, chunk)
+			}
+		}
+	}
+	if len(apngFrames) == 0 {
+		return nil, nil, 0, errors.New("animated png has no frames")
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, canvasWidth, canvasHeight))
+	for i, frame := range apngFrames {
+		img, err := decodeApngFrame(ihdr, shared, frame)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("couldn't decode frame %d: %s", i, err)
+		}
+
+		dispose := frame.dispose
+		if i == 0 && dispose == apngDisposePrevious {
+			dispose = apngDisposeBackground // there's nothing before the first frame to go back to
+		}
+		var previous *image.RGBA
+		if dispose == apngDisposePrevious {
+			previous = image.NewRGBA(canvas.Bounds())
+			draw.Draw(previous, previous.Bounds(), canvas, image.ZP, draw.Src)
+		}
+
+		region := image.Rect(frame.x, frame.y, frame.x+frame.width, frame.y+frame.height)
+		op := draw.Over
+		if frame.blend == apngBlendSource {
+			op = draw.Src
+		}
+		draw.Draw(canvas, region, img, img.Bounds().Min, op)
+
+		shown := image.NewRGBA(canvas.Bounds())
+		draw.Draw(shown, shown.Bounds(), canvas, image.ZP, draw.Src)
+		frames = append(frames, shown)
+		delays = append(delays, frame.delay)
+
+		switch dispose {
+		case apngDisposeBackground:
+			draw.Draw(canvas, region, image.Transparent, image.ZP, draw.Src)
+		case apngDisposePrevious:
+			canvas = previous
+		}
+	}
+
+	// num_plays is how many times it plays, 0 is forever
+	switch {
+	case plays == 0:
+		loopCount = 0
+	case plays == 1:
+		loopCount = -1
+	default:
+		loopCount = int(plays) - 1
+	}
+	return frames, delays, loopCount, nil
+}
+
+func parseFcTL(data []byte, canvasWidth, canvasHeight int) (apngFrame, error) {
+	if len(data) != 26 {
+		return apngFrame{}, errors.New("fcTL is the wrong size")
+	}
+
+	// checked before they're ints, on 32 bit arm a big uint32 turns negative
+	width := binary.BigEndian.Uint32(data[4:8])
+	height := binary.BigEndian.Uint32(data[8:12])
+	x := binary.BigEndian.Uint32(data[12:16])
+	y := binary.BigEndian.Uint32(data[16:20])
+	if width == 0 || height == 0 || uint64(width) > uint64(canvasWidth) || uint64(height) > uint64(canvasHeight) ||
+		uint64(x)+uint64(width) > uint64(canvasWidth) || uint64(y)+uint64(height) > uint64(canvasHeight) {
+		return apngFrame{}, errors.New("fcTL frame doesn't fit in the png")
+	}
+
+	return apngFrame{
+		width:   int(width),
+		height:  int(height),
+		x:       int(x),
+		y:       int(y),
+		delay:   apngDelay(binary.BigEndian.Uint16(data[20:22]), binary.BigEndian.Uint16(data[22:24])),
+		dispose: data[24],
+		blend:   data[25],
+	}, nil
+}
+
+// apngDelay is delayNum/delayDen seconds, a delayDen of 0 means 100ths of a second. Like gifs, delays that are
+// too short to be real are played at 100ms.
+func apngDelay(delayNum, delayDen uint16) time.Duration {
+	if delayDen == 0 {
+		delayDen = 100
+	}
+	delay := time.Second * time.Duration(delayNum) / time.Duration(delayDen)
+	if delay < GifDelay(2) {
+		return GifDelay(0)
+	}
+	return delay
+}
+
+// decodeApngFrame turns a frame into a png of its own, with the frame's size, and decodes it
+func decodeApngFrame(ihdr []byte, shared []pngChunk, frame apngFrame) (image.Image, error) {
+	header := append([]byte{}, ihdr...)
+	binary.BigEndian.PutUint32(header[0:4], uint32(frame.width))
+	binary.BigEndian.PutUint32(header[4:8], uint32(frame.height))
+
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	writePngChunk(&buf, "IHDR", header)
+	for _, chunk := range shared {
+		writePngChunk(&buf, chunk.kind, chunk.data)
+	}
+	writePngChunk(&buf, "IDAT", frame.data)
+	writePngChunk(&buf, "IEND", nil)
+
+	return png.Decode(&buf)
+}
+
+func writePngChunk(buf *bytes.Buffer, kind string, data []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	buf.Write(length[:])
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	buf.WriteString(kind)
+	buf.Write(data)
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	buf.Write(sum[:])
+}
@@ -0,0 +1,228 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+)
+
+type testApngFrame struct {
+	img            *image.Paletted
+	x, y           int
+	delayNum       uint16
+	delayDen       uint16
+	dispose, blend byte
+}
+
+var testApngPalette = color.Palette{color.Transparent, color.White, color.Black}
+
+func testApngFill(width, height int, c uint8) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, width, height), testApngPalette)
+	for i := range img.Pix {
+		img.Pix[i] = c
+	}
+	return img
+}
+
+// encodeTestApng builds an animated png out of pngs made by image/png, every frame needs the same palette
+func encodeTestApng(t *testing.T, width, height int, plays uint32, frames []testApngFrame) []byte {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+
+	u32 := func(v uint32) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		return b
+	}
+	u16 := func(v uint16) []byte {
+		b := make([]byte, 2)
+		binary.BigEndian.PutUint16(b, v)
+		return b
+	}
+
+	seq := uint32(0)
+	for i, frame := range frames {
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, frame.img); err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := readPngChunks(encoded.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var data []byte
+		for _, chunk := range chunks {
+			switch chunk.kind {
+			case "IHDR":
+				if i == 0 {
+					ihdr := append(u32(uint32(width)), u32(uint32(height))...)
+					writePngChunk(&buf, "IHDR", append(ihdr, chunk.data[8:]...))
+					writePngChunk(&buf, "acTL", append(u32(uint32(len(frames))), u32(plays)...))
+				}
+			case "PLTE", "tRNS":
+				if i == 0 {
+					writePngChunk(&buf, chunk.kind, chunk.data)
+				}
+			case "IDAT":
+				data = append(data, chunk.data...)
+			}
+		}
+
+		b := frame.img.Bounds()
+		fcTL := u32(seq)
+		fcTL = append(fcTL, u32(uint32(b.Dx()))...)
+		fcTL = append(fcTL, u32(uint32(b.Dy()))...)
+		fcTL = append(fcTL, u32(uint32(frame.x))...)
+		fcTL = append(fcTL, u32(uint32(frame.y))...)
+		fcTL = append(fcTL, u16(frame.delayNum)...)
+		fcTL = append(fcTL, u16(frame.delayDen)...)
+		fcTL = append(fcTL, frame.dispose, frame.blend)
+		writePngChunk(&buf, "fcTL", fcTL)
+		seq++
+
+		if i == 0 {
+			writePngChunk(&buf, "IDAT", data)
+		} else {
+			writePngChunk(&buf, "fdAT", append(u32(seq), data...))
+			seq++
+		}
+	}
+	writePngChunk(&buf, "IEND", nil)
+	return buf.Bytes()
+}
+
+func TestDecodeApng(t *testing.T) {
+	const transparent, white, black = 0, 1, 2
+
+	raw := encodeTestApng(t, 4, 2, 3, []testApngFrame{
+		// all white
+		{img: testApngFill(4, 2, white), delayNum: 10, delayDen: 100, blend: apngBlendSource},
+		// the right half goes black, then back to white after it's shown
+		{img: testApngFill(2, 2, black), x: 2, delayNum: 1, delayDen: 2, dispose: apngDisposePrevious, blend: apngBlendOver},
+		// the top left goes black, then it's cleared after it's shown
+		{img: testApngFill(1, 1, black), delayNum: 0, dispose: apngDisposeBackground, blend: apngBlendOver},
+		// blending a transparent pixel over doesn't change anything, with source it's cut out
+		{img: testApngFill(1, 1, transparent), x: 3, y: 1, delayNum: 3, delayDen: 0, blend: apngBlendSource},
+	})
+
+	if !isApng(raw) {
+		t.Fatal("Expected it to be an animated png")
+	}
+
+	frames, delays, loopCount, err := decodeApng(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"WWWW" + "WWWW",
+		"WWBB" + "WWBB",
+		"BWWW" + "WWWW",
+		".WWW" + "WWW.",
+	}
+	if len(frames) != len(expected) {
+		t.Fatalf("Expected %d frames, got %d", len(expected), len(frames))
+	}
+	for i, frame := range frames {
+		got := ""
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 4; x++ {
+				r, _, _, a := frame.At(x, y).RGBA()
+				switch {
+				case a == 0:
+					got += "."
+				case r == 0:
+					got += "B"
+				default:
+					got += "W"
+				}
+			}
+		}
+		if got != expected[i] {
+			t.Errorf("Expected frame %d to be %s, got %s", i, expected[i], got)
+		}
+	}
+
+	expectedDelays := []time.Duration{100 * time.Millisecond, 500 * time.Millisecond, 100 * time.Millisecond, 30 * time.Millisecond}
+	for i, delay := range delays {
+		if delay != expectedDelays[i] {
+			t.Errorf("Expected frame %d to be shown for %s, got %s", i, expectedDelays[i], delay)
+		}
+	}
+
+	if loopCount != 2 {
+		t.Errorf("Expected 3 plays to be a loop count of 2, got %d", loopCount)
+	}
+}
+
+func TestParseFcTL(t *testing.T) {
+	tests := map[string]struct {
+		width, height, x, y uint32
+
+		fits bool
+	}{
+		"the whole canvas":           {width: 4, height: 2, fits: true},
+		"in the corner":              {width: 1, height: 1, x: 3, y: 1, fits: true},
+		"no width":                   {width: 0, height: 2},
+		"wider than the canvas":      {width: 5, height: 2},
+		"taller than the canvas":     {width: 4, height: 3},
+		"off the edge":               {width: 2, height: 2, x: 3},
+		"x wraps around":             {width: 2, height: 1, x: 0xffffffff},
+		"y wraps around":             {width: 1, height: 2, y: 0xfffffffe},
+		"width is negative as int32": {width: 0x80000000, height: 1},
+	}
+
+	for name, test := range tests {
+		data := make([]byte, 26)
+		binary.BigEndian.PutUint32(data[4:8], test.width)
+		binary.BigEndian.PutUint32(data[8:12], test.height)
+		binary.BigEndian.PutUint32(data[12:16], test.x)
+		binary.BigEndian.PutUint32(data[16:20], test.y)
+
+		frame, err := parseFcTL(data, 4, 2)
+		if test.fits && err != nil {
+			t.Errorf("%s: Expected the frame to fit, got %s", name, err)
+		}
+		if !test.fits && err == nil {
+			t.Errorf("%s: Expected the frame not to fit, got %+v", name, frame)
+		}
+	}
+}
+
+func TestConvertToFrames(t *testing.T) {
+	var still bytes.Buffer
+	if err := png.Encode(&still, testApngFill(4, 2, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if isApng(still.Bytes()) {
+		t.Error("Expected a png without an acTL to be a still")
+	}
+
+	stillFrames, err := convertToFrames(still.Bytes(), 4, 2, false, 140, DitherThreshold, ContainFit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stillFrames.Flipboards) != 1 || stillFrames.LoopCount != -1 {
+		t.Errorf("Expected a still to be a single frame that plays once, got %d frames and a loop count of %d", len(stillFrames.Flipboards), stillFrames.LoopCount)
+	}
+
+	animated := encodeTestApng(t, 4, 2, 0, []testApngFrame{
+		{img: testApngFill(4, 2, 1), delayNum: 1, delayDen: 10},
+		{img: testApngFill(4, 2, 2), delayNum: 1, delayDen: 10},
+	})
+	animatedFrames, err := convertToFrames(animated, 4, 2, false, 140, DitherThreshold, ContainFit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(animatedFrames.Flipboards) != 2 || animatedFrames.LoopCount != 0 {
+		t.Errorf("Expected 2 frames that loop forever, got %d frames and a loop count of %d", len(animatedFrames.Flipboards), animatedFrames.LoopCount)
+	}
+	if (*animatedFrames.Flipboards[0])[0][0] != 0 || (*animatedFrames.Flipboards[1])[0][0] != 1 {
+		t.Error("Expected the white frame to be blank and the black frame to be dots")
+	}
+}
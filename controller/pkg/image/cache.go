@@ -0,0 +1,98 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/armory/flipdisks/pkg/cache"
+	log "github.com/sirupsen/logrus"
+)
+
+// the kinds of entries we keep in the cache
+const (
+	cacheDownloads = "download" // the image as it was downloaded
+	cacheFrames    = "frames"   // a FlipboardGif, rendered with the options in its key
+)
+
+var mediaCache = struct {
+	sync.RWMutex
+	cache *cache.Cache
+}{}
+
+// SetCache keeps downloads and the frames rendered from them in c, so they start instantly the next time and still
+// work when the network doesn't. nil turns the cache off.
+func SetCache(c *cache.Cache) {
+	mediaCache.Lock()
+	defer mediaCache.Unlock()
+	mediaCache.cache = c
+}
+
+func getCache() *cache.Cache {
+	mediaCache.RLock()
+	defer mediaCache.RUnlock()
+	return mediaCache.cache
+}
+
+// download gets the url, from the cache when it's been downloaded before. kind is for the metrics, e.g. gif.
+// Whether it's from the cache or not, it has to fit in the FetchLimits. Pages we know the media url for,
+// like giphy's, are downloaded from there.
+func download(url, kind string) ([]byte, error) {
+	f := getFetcher()
+	c := getCache()
+
+	raw, cached := c.Get(cacheDownloads, url)
+	if !cached {
+		var err error
+		if raw, err = f.get(mediaUrl(url)); err != nil {
+			downloadFailures.Inc(kind)
+			return nil, err
+		}
+	}
+
+	if err := f.checkLimits(raw); err != nil {
+		downloadFailures.Inc(kind)
+		return nil, &FetchError{URL: url, Err: err}
+	}
+
+	if !cached {
+		if err := c.Put(cacheDownloads, url, raw); err != nil {
+			log.Warn(err)
+		}
+	}
+	return raw, nil
+}
+
+// renderKey is everything that changes how a url is turned into frames
+func renderKey(url string, maxWidth, maxHeight uint, invertImage bool, bwThreshold int, ditherAlgorithm string, fit Fit) string {
+	return fmt.Sprintf("%s %dx%d inverted=%t bwThreshold=%d dither=%s fit=%+v",
+		url, maxWidth, maxHeight, invertImage, bwThreshold, ditherAlgorithm, fit)
+}
+
+// renderCached returns the frames from the cache when they've been rendered with the same key before,
+// otherwise it renders them and saves them for next time
+func renderCached(key string, render func() (*FlipboardGif, error)) (*FlipboardGif, error) {
+	c := getCache()
+	if raw, ok := c.Get(cacheFrames, key); ok {
+		var frames FlipboardGif
+		if err := json.Unmarshal(raw, &frames); err == nil {
+			return &frames, nil
+		}
+		log.Warn("couldn't read cached frames, rendering them again")
+	}
+
+	frames, err := render()
+	if err != nil || c == nil {
+		return frames, err
+	}
+
+	raw, err := json.Marshal(frames)
+	if err != nil {
+		log.Warn("couldn't cache frames: " + err.Error())
+		return frames, nil
+	}
+	if err := c.Put(cacheFrames, key, raw); err != nil {
+		log.Warn(err)
+	}
+	return frames, nil
+}
@@ -0,0 +1,72 @@
+package image
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/armory/flipdisks/pkg/cache"
+)
+
+func TestConvertUrlToFramesIsCached(t *testing.T) {
+	requests := 0
+	files := http.FileServer(http.Dir("test_fixtures"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	defer allowTestServers()()
+
+	dir, err := ioutil.TempDir("", "flipdisk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := cache.New(dir, 10*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCache(c)
+	defer SetCache(nil)
+
+	first, err := ConvertUrlToFrames(server.URL+"/fast_parrot.gif", 20, 20, false, 90, DitherThreshold, ContainFit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ConvertUrlToFrames(server.URL+"/fast_parrot.gif", 20, 20, false, 90, DitherThreshold, ContainFit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected the second time to come from the cache, got %d requests", requests)
+	}
+	if len(again.Flipboards) != len(first.Flipboards) || again.Flipboards[3].String() != first.Flipboards[3].String() ||
+		again.Delay[3] != first.Delay[3] || again.LoopCount != first.LoopCount {
+		t.Error("Expected the cached frames to be the same as the rendered ones")
+	}
+
+	// other options are rendered again, but from the cached download
+	inverted, err := ConvertUrlToFrames(server.URL+"/fast_parrot.gif", 20, 20, true, 90, DitherThreshold, ContainFit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected the download to be cached, got %d requests", requests)
+	}
+	if inverted.Flipboards[3].String() == first.Flipboards[3].String() {
+		t.Error("Expected the inverted frames to be rendered again")
+	}
+
+	// errors aren't cached
+	for i := 0; i < 2; i++ {
+		if _, err := ConvertUrlToFrames(server.URL+"/missing.png", 20, 20, false, 90, DitherThreshold, ContainFit); err == nil {
+			t.Error("Expected an error for a missing image")
+		}
+	}
+	if requests != 3 {
+		t.Errorf("Expected a missing image to be asked for every time, got %d requests", requests)
+	}
+}
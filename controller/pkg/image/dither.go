@@ -0,0 +1,161 @@
+package image
+
+import (
+	"image"
+	"math/rand"
+)
+
+// The dither option, how an image's greys are turned into dots. Threshold is what you get when it's empty.
+const (
+	DitherThreshold      = "threshold"
+	DitherFloydSteinberg = "floyd-steinberg"
+	DitherAtkinson       = "atkinson"
+	DitherBayer2         = "bayer2"
+	DitherBayer4         = "bayer4"
+	DitherBayer8         = "bayer8"
+	DitherRandom         = "random"
+)
+
+// DitherAlgorithms are all the values the dither option can have
+var DitherAlgorithms = []string{DitherThreshold, DitherFloydSteinberg, DitherAtkinson, DitherBayer2, DitherBayer4, DitherBayer8, DitherRandom}
+
+// IsDitherAlgorithm is true for the algorithms we know, and for empty, which is a threshold
+func IsDitherAlgorithm(name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, algorithm := range DitherAlgorithms {
+		if name == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// errorDiffusion is where the error from a dot goes, relative to the dot, and the fraction of it that goes there
+type errorDiffusion struct {
+	dx, dy int
+	weight float64
+}
+
+var (
+	floydSteinberg = []errorDiffusion{{1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16}}
+
+	// atkinson only passes on 3/4 of the error, it keeps more contrast which suits a board with so few dots
+	atkinson = []errorDiffusion{{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8}, {-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8}, {0, 2, 1.0 / 8}}
+)
+
+// dither decides which pixels are dots. lum is the brightness of every pixel from 0 to 255, indexed [y][x],
+// and a pixel that's darker than bwThreshold is a dot. Unknown algorithms are a threshold.
+func dither(lum [][]float64, algorithm string, bwThreshold int) [][]bool {
+	threshold := float64(bwThreshold)
+
+	dots := make([][]bool, len(lum))
+	for y := range lum {
+		dots[y] = make([]bool, len(lum[y]))
+	}
+
+	switch algorithm {
+	case DitherFloydSteinberg:
+		diffuseError(lum, dots, threshold, floydSteinberg)
+
+	case DitherAtkinson:
+		diffuseError(lum, dots, threshold, atkinson)
+
+	case DitherBayer2, DitherBayer4, DitherBayer8:
+		matrix := bayerMatrix(map[string]int{DitherBayer2: 2, DitherBayer4: 4, DitherBayer8: 8}[algorithm])
+		n := len(matrix)
+		for y, row := range lum {
+			for x, l := range row {
+				// spread the threshold over the whole range, so every grey gets its own pattern
+				offset := (float64(matrix[y%n][x%n])+0.5)/float64(n*n) - 0.5
+				dots[y][x] = l < threshold+offset*256
+			}
+		}
+
+	case DitherRandom:
+		// the same noise every time, so the frames of a gif don't shimmer
+		noise := rand.New(rand.NewSource(1))
+		for y, row := range lum {
+			for x, l := range row {
+				dots[y][x] = l < threshold+(noise.Float64()-0.5)*256
+			}
+		}
+
+	default:
+		for y, row := range lum {
+			for x, l := range row {
+				dots[y][x] = l < threshold
+			}
+		}
+	}
+
+	return dots
+}
+
+// diffuseError spreads the difference between a pixel and the dot it became onto the pixels that haven't been done yet
+func diffuseError(lum [][]float64, dots [][]bool, threshold float64, diffusion []errorDiffusion) {
+	// don't change the caller's pixels
+	values := make([][]float64, len(lum))
+	for y := range lum {
+		values[y] = append([]float64{}, lum[y]...)
+	}
+
+	for y, row := range values {
+		for x, value := range row {
+			dots[y][x] = value < threshold
+
+			target := 255.0
+			if dots[y][x] {
+				target = 0
+			}
+			err := value - target
+
+			for _, d := range diffusion {
+				nx, ny := x+d.dx, y+d.dy
+				if ny < len(values) && nx >= 0 && nx < len(values[ny]) {
+					values[ny][nx] += err * d.weight
+				}
+			}
+		}
+	}
+}
+
+// bayerMatrix is the n x n ordered dithering matrix, n is a power of 2
+func bayerMatrix(n int) [][]int {
+	matrix := [][]int{{0}}
+	for size := 1; size < n; size *= 2 {
+		next := make([][]int, size*2)
+		for y := range next {
+			next[y] = make([]int, size*2)
+		}
+
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				v := matrix[y][x] * 4
+				next[y][x] = v
+				next[y][x+size] = v + 2
+				next[y+size][x] = v + 3
+				next[y+size][x+size] = v + 1
+			}
+		}
+		matrix = next
+	}
+	return matrix
+}
+
+// luminance is the brightness of every pixel in bounds from 0 to 255, indexed [y][x]
+func luminance(m image.Image, bounds image.Rectangle) [][]float64 {
+	var lum [][]float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		var row []float64
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := m.At(x, y).RGBA()
+			// to get luminosity, we're going to use magic values from
+			// https://stackoverflow.com/questions/596216/formula-to-determine-brightness-of-rgb-color
+			row = append(row, (0.299*float64(r)+0.587*float64(g)+0.114*float64(b))/256)
+		}
+		lum = append(lum, row)
+	}
+	return lum
+}
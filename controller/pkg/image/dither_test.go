@@ -0,0 +1,76 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBayerMatrix(t *testing.T) {
+	expected := [][]int{
+		{0, 8, 2, 10},
+		{12, 4, 14, 6},
+		{3, 11, 1, 9},
+		{15, 7, 13, 5},
+	}
+	if got := bayerMatrix(4); !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestDither(t *testing.T) {
+	// a dark grey, 3/4 of it should be dots
+	grey := make([][]float64, 8)
+	for y := range grey {
+		grey[y] = []float64{64, 64, 64, 64, 64, 64, 64, 64}
+	}
+
+	tests := map[string]struct {
+		minDots, maxDots int
+	}{
+		"":                   {64, 64}, // a threshold can only do all or nothing
+		DitherThreshold:      {64, 64},
+		DitherFloydSteinberg: {44, 52},
+		DitherAtkinson:       {44, 56},
+		DitherBayer2:         {48, 48},
+		DitherBayer4:         {48, 48},
+		DitherBayer8:         {48, 48},
+		DitherRandom:         {36, 60},
+	}
+
+	for algorithm, test := range tests {
+		t.Run(algorithm, func(t *testing.T) {
+			dots := dither(grey, algorithm, 128)
+
+			count := 0
+			for _, row := range dots {
+				for _, isDot := range row {
+					if isDot {
+						count++
+					}
+				}
+			}
+			if count < test.minDots || count > test.maxDots {
+				t.Errorf("Expected between %d and %d dots, got %d", test.minDots, test.maxDots, count)
+			}
+
+			if !reflect.DeepEqual(dots, dither(grey, algorithm, 128)) {
+				t.Error("dithering the same image twice should give the same dots")
+			}
+		})
+	}
+
+	if grey[0][0] != 64 {
+		t.Error("dithering shouldn't change the image")
+	}
+}
+
+func TestIsDitherAlgorithm(t *testing.T) {
+	for _, algorithm := range append(DitherAlgorithms, "") {
+		if !IsDitherAlgorithm(algorithm) {
+			t.Errorf("Expected %q to be a dither algorithm", algorithm)
+		}
+	}
+	if IsDitherAlgorithm("sierra") {
+		t.Error("Expected sierra not to be a dither algorithm")
+	}
+}
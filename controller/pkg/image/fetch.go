@@ -0,0 +1,362 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Why a download was refused, a *FetchError wraps one of these so errors.Is works on it
+var (
+	ErrBlockedAddress = errors.New("it's on a private network")
+	ErrTimeout        = errors.New("it took too long to download")
+	ErrTooLarge       = errors.New("it's too big to download")
+	ErrTooManyPixels  = errors.New("it has too many pixels")
+	ErrTooManyFrames  = errors.New("it has too many frames")
+)
+
+// FetchError is why a url couldn't be downloaded
+type FetchError struct {
+	URL string
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return "couldn't download " + e.URL + ": " + e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// FetchLimits keep the urls anyone in slack can send from hurting the board, or making it reach things it shouldn't.
+// A limit of 0 is no limit.
+type FetchLimits struct {
+	ConnectTimeout time.Duration
+	Timeout        time.Duration // for the whole download, from connecting to the last byte
+	MaxBytes       int64
+	MaxPixels      int // width x height, added up over every frame, that's about how much memory decoding takes
+	MaxFrames      int
+
+	// AllowedHosts can be downloaded from even though they're loopback, private or link-local addresses.
+	// They're host names, IPs or CIDRs like 10.0.0.0/8.
+	AllowedHosts []string
+}
+
+// DefaultFetchLimits are enough for any emoji, gif or photo people send
+func DefaultFetchLimits() FetchLimits {
+	return FetchLimits{
+		ConnectTimeout: 5 * time.Second,
+		Timeout:        30 * time.Second,
+		MaxBytes:       20 * 1024 * 1024,
+		MaxPixels:      25000000,
+		MaxFrames:      1000,
+	}
+}
+
+// blockedNetworks can't be downloaded from unless they're allowed: the board itself, the office network,
+// cloud metadata services, and multicast and broadcast, which reach everything on the network
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",          // this host
+	"10.0.0.0/8",         // private
+	"100.64.0.0/10",      // carrier-grade NAT
+	"127.0.0.0/8",        // loopback
+	"169.254.0.0/16",     // link-local
+	"172.16.0.0/12",      // private
+	"192.168.0.0/16",     // private
+	"224.0.0.0/4",        // multicast
+	"255.255.255.255/32", // broadcast
+	"::/128",             // unspecified
+	"::1/128",            // loopback
+	"fc00::/7",           // unique local
+	"fe80::/10",          // link-local
+	"ff00::/8",           // multicast
+)
+
+// IPv6 addresses in these networks reach an IPv4 address, it's in the last 4 bytes for NAT64 and in bytes 2 to 6
+// for 6to4. They're checked as the IPv4 address they reach too. IPv4-mapped addresses, ::ffff:a.b.c.d,
+// are already IPv4 to net.IP.
+var (
+	nat64Networks = mustParseCIDRs("64:ff9b::/96", "64:ff9b:1::/48")
+	sixToFour     = mustParseCIDRs("2002::/16")[0]
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+type fetcher struct {
+	limits FetchLimits
+	client *http.Client
+
+	allowedNames    map[string]bool
+	allowedNetworks []*net.IPNet
+}
+
+var currentFetcher = struct {
+	sync.RWMutex
+	fetcher *fetcher
+}{fetcher: newFetcher(DefaultFetchLimits())}
+
+// SetFetchLimits changes the limits for every download from now on
+func SetFetchLimits(limits FetchLimits) {
+	f := newFetcher(limits)
+
+	currentFetcher.Lock()
+	old := currentFetcher.fetcher
+	currentFetcher.fetcher = f
+	currentFetcher.Unlock()
+
+	old.client.CloseIdleConnections()
+}
+
+func getFetcher() *fetcher {
+	currentFetcher.RLock()
+	defer currentFetcher.RUnlock()
+	return currentFetcher.fetcher
+}
+
+func newFetcher(limits FetchLimits) *fetcher {
+	f := fetcher{limits: limits, allowedNames: map[string]bool{}}
+	for _, host := range limits.AllowedHosts {
+		switch {
+		case strings.Contains(host, "/"):
+			_, network, err := net.ParseCIDR(host)
+			if err != nil {
+				log.Warn("allowed host " + host + " isn't a valid CIDR: " + err.Error())
+				continue
+			}
+			f.allowedNetworks = append(f.allowedNetworks, network)
+		case net.ParseIP(host) != nil:
+			ip := net.ParseIP(host)
+			f.allowedNetworks = append(f.allowedNetworks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		default:
+			f.allowedNames[strings.ToLower(host)] = true
+		}
+	}
+
+	// the address is checked when connecting, after the host name is resolved, so a name can't resolve to a
+	// public address when it's looked up and a private one when it's used
+	guarded := &net.Dialer{
+		Timeout: limits.ConnectTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || f.blocked(ip) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+	open := &net.Dialer{Timeout: limits.ConnectTimeout}
+
+	f.client = &http.Client{
+		Timeout: limits.Timeout,
+		Transport: &http.Transport{
+			// no proxy, it'd be the proxy's address that's checked instead of the url's
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				if host, _, err := net.SplitHostPort(address); err == nil && f.allowedNames[strings.ToLower(host)] {
+					return open.DialContext(ctx, network, address)
+				}
+				return guarded.DialContext(ctx, network, address)
+			},
+			TLSHandshakeTimeout: limits.ConnectTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+	return &f
+}
+
+// blocked is true for loopback, private and link-local addresses that aren't allowed
+func (f *fetcher) blocked(ip net.IP) bool {
+	if embedded := embeddedIPv4(ip); embedded != nil && f.blocked(embedded) {
+		return true
+	}
+
+	for _, network := range f.allowedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedIPv4 is the IPv4 address an IPv6 address reaches through NAT64 or 6to4, or nil
+func embeddedIPv4(ip net.IP) net.IP {
+	if ip.To4() != nil || len(ip) != net.IPv6len {
+		return nil
+	}
+	for _, network := range nat64Networks {
+		if network.Contains(ip) {
+			return net.IP(ip[12:16])
+		}
+	}
+	if sixToFour.Contains(ip) {
+		return net.IP(ip[2:6])
+	}
+	return nil
+}
+
+// get downloads the url, it's never more than MaxBytes
+func (f *fetcher) get(url string) ([]byte, error) {
+	r, err := f.client.Get(url)
+	if err != nil {
+		return nil, &FetchError{URL: url, Err: fetchFailure(err)}
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return nil, &FetchError{URL: url, Err: errors.New(r.Status)}
+	}
+
+	if f.limits.MaxBytes > 0 && r.ContentLength > f.limits.MaxBytes {
+		return nil, &FetchError{URL: url, Err: f.tooLarge()}
+	}
+
+	body := io.Reader(r.Body)
+	if f.limits.MaxBytes > 0 {
+		body = io.LimitReader(r.Body, f.limits.MaxBytes+1) // one more byte to know that it's too big
+	}
+	raw, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, &FetchError{URL: url, Err: fetchFailure(err)}
+	}
+	if f.limits.MaxBytes > 0 && int64(len(raw)) > f.limits.MaxBytes {
+		return nil, &FetchError{URL: url, Err: f.tooLarge()}
+	}
+	return raw, nil
+}
+
+func (f *fetcher) tooLarge() error {
+	if f.limits.MaxBytes < 1024*1024 {
+		return fmt.Errorf("%w, the limit is %d bytes", ErrTooLarge, f.limits.MaxBytes)
+	}
+	return fmt.Errorf("%w, the limit is %dMB", ErrTooLarge, f.limits.MaxBytes/1024/1024)
+}
+
+// fetchFailure turns the errors we caused into the errors for them
+func fetchFailure(err error) error {
+	if errors.Is(err, ErrBlockedAddress) {
+		return ErrBlockedAddress
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTimeout
+	}
+	return err
+}
+
+// checkLimits looks at the headers of an image to see if it's too big to decode, without decoding it.
+// Images we don't know how to read are left for the decoder to complain about.
+func (f *fetcher) checkLimits(raw []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+
+	frames := 1
+	switch {
+	case bytes.HasPrefix(raw, []byte("GIF8")):
+		frames = gifFrameCount(raw)
+	case isApng(raw):
+		frames = apngFrameCount(raw)
+	}
+
+	if f.limits.MaxFrames > 0 && frames > f.limits.MaxFrames {
+		return fmt.Errorf("%w, %d of them and the limit is %d", ErrTooManyFrames, frames, f.limits.MaxFrames)
+	}
+	// frames are drawn onto a canvas the size of the whole image, so they all count as that big
+	if pixels := int64(config.Width) * int64(config.Height) * int64(frames); f.limits.MaxPixels > 0 && pixels > int64(f.limits.MaxPixels) {
+		return fmt.Errorf("%w, %dx%d with %d frames and the limit is %d pixels", ErrTooManyPixels, config.Width, config.Height, frames, f.limits.MaxPixels)
+	}
+	return nil
+}
+
+// gifFrameCount counts the image descriptors in a gif without decoding any of them. A gif that's cut off or broken
+// is counted up to where it breaks, the decoder will complain about it.
+// See https://www.w3.org/Graphics/GIF/spec-gif89a.txt
+func gifFrameCount(raw []byte) int {
+	if len(raw) < 13 {
+		return 0
+	}
+	pos := 13 // the header and the logical screen descriptor
+	if flags := raw[10]; flags&0x80 != 0 {
+		pos += 3 << (uint(flags&7) + 1) // the global color table
+	}
+
+	frames := 0
+	for pos < len(raw) {
+		switch raw[pos] {
+		case 0x21: // extension, its label and then data sub-blocks
+			pos = skipGifSubBlocks(raw, pos+2)
+		case 0x2c: // image descriptor, maybe a local color table, the LZW code size and then data sub-blocks
+			frames++
+			if pos+10 > len(raw) {
+				return frames
+			}
+			flags := raw[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (uint(flags&7) + 1)
+			}
+			pos = skipGifSubBlocks(raw, pos+1)
+		default: // the trailer, or something broken
+			return frames
+		}
+	}
+	return frames
+}
+
+func skipGifSubBlocks(raw []byte, pos int) int {
+	for pos < len(raw) {
+		size := int(raw[pos])
+		pos += 1 + size
+		if size == 0 {
+			break
+		}
+	}
+	return pos
+}
+
+// apngFrameCount counts the fcTLs, acTL says how many frames there are too but it's the fcTLs that get decoded
+func apngFrameCount(raw []byte) int {
+	chunks, err := readPngChunks(raw)
+	if err != nil {
+		return 0
+	}
+	frames := 0
+	for _, chunk := range chunks {
+		if chunk.kind == "fcTL" {
+			frames++
+		}
+	}
+	return frames
+}
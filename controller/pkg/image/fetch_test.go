@@ -0,0 +1,211 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image/gif"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/armory/flipdisks/pkg/cache"
+)
+
+// allowTestServers lets downloads reach httptest servers, they're on loopback.
+// Call the func it returns to put the limits back.
+func allowTestServers() func() {
+	limits := DefaultFetchLimits()
+	limits.AllowedHosts = []string{"127.0.0.1"}
+	SetFetchLimits(limits)
+	return func() { SetFetchLimits(DefaultFetchLimits()) }
+}
+
+func TestDownloadLimits(t *testing.T) {
+	files := http.FileServer(http.Dir("test_fixtures"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow.gif" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	defer SetFetchLimits(DefaultFetchLimits())
+
+	allowed := func(change func(*FetchLimits)) FetchLimits {
+		limits := DefaultFetchLimits()
+		limits.AllowedHosts = []string{"127.0.0.0/8"}
+		change(&limits)
+		return limits
+	}
+
+	tests := map[string]struct {
+		limits   FetchLimits
+		path     string
+		expected error
+	}{
+		"loopback is blocked": {
+			limits:   DefaultFetchLimits(),
+			path:     "/fast_parrot.gif",
+			expected: ErrBlockedAddress,
+		},
+		"allowed network": {
+			limits: allowed(func(*FetchLimits) {}),
+			path:   "/fast_parrot.gif",
+		},
+		"allowed ip": {
+			limits: func() FetchLimits {
+				limits := DefaultFetchLimits()
+				limits.AllowedHosts = []string{"127.0.0.1"}
+				return limits
+			}(),
+			path: "/fast_parrot.gif",
+		},
+		"too many bytes": {
+			limits:   allowed(func(l *FetchLimits) { l.MaxBytes = 1000 }),
+			path:     "/fast_parrot.gif",
+			expected: ErrTooLarge,
+		},
+		"too many frames": {
+			limits:   allowed(func(l *FetchLimits) { l.MaxFrames = 3 }),
+			path:     "/fast_parrot.gif",
+			expected: ErrTooManyFrames,
+		},
+		"too many pixels": {
+			limits:   allowed(func(l *FetchLimits) { l.MaxPixels = 100 }),
+			path:     "/armory.jpg",
+			expected: ErrTooManyPixels,
+		},
+		"too slow": {
+			limits:   allowed(func(l *FetchLimits) { l.Timeout = 50 * time.Millisecond }),
+			path:     "/slow.gif",
+			expected: ErrTimeout,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			SetFetchLimits(test.limits)
+
+			raw, err := download(server.URL+test.path, "gif")
+			if test.expected == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(raw) == 0 {
+					t.Error("Expected it to be downloaded")
+				}
+				return
+			}
+
+			if !errors.Is(err, test.expected) {
+				t.Fatalf("Expected %q, got %v", test.expected, err)
+			}
+			var fetchErr *FetchError
+			if !errors.As(err, &fetchErr) || fetchErr.URL != server.URL+test.path {
+				t.Errorf("Expected a FetchError for the url, got %#v", err)
+			}
+		})
+	}
+}
+
+func TestBlocked(t *testing.T) {
+	f := newFetcher(FetchLimits{AllowedHosts: []string{"10.1.0.0/16", "192.168.1.20", "fd00::1", "printer.local"}})
+
+	for ip, expected := range map[string]bool{
+		"8.8.8.8":            false,
+		"127.0.0.1":          true,
+		"::ffff:127.0.0.1":   true,
+		"10.0.0.1":           true,
+		"10.1.2.3":           false,
+		"172.20.0.1":         true,
+		"192.168.1.20":       false,
+		"192.168.1.21":       true,
+		"169.254.169.254":    true,
+		"0.0.0.0":            true,
+		"::1":                true,
+		"fe80::1":            true,
+		"fd00::1":            false,
+		"fd00::2":            true,
+		"2001:4860::8888":    false,
+		"224.0.0.251":        true,
+		"239.255.255.250":    true,
+		"255.255.255.255":    true,
+		"ff02::1":            true,
+		"64:ff9b::a00:1":     true,  // NAT64 to 10.0.0.1
+		"64:ff9b::7f00:1":    true,  // NAT64 to 127.0.0.1
+		"64:ff9b::a9fe:a9fe": true,  // NAT64 to 169.254.169.254
+		"64:ff9b::808:808":   false, // NAT64 to 8.8.8.8
+		"64:ff9b::a01:203":   false, // NAT64 to 10.1.2.3, it's allowed
+		"2002:c0a8:115::1":   true,  // 6to4 to 192.168.1.21
+		"2002:808:808::1":    false, // 6to4 to 8.8.8.8
+	} {
+		if got := f.blocked(net.ParseIP(ip)); got != expected {
+			t.Errorf("Expected blocked(%s) to be %t, got %t", ip, expected, got)
+		}
+	}
+
+	if !f.allowedNames["printer.local"] {
+		t.Error("Expected host names to be allowed by name")
+	}
+}
+
+func TestFrameCount(t *testing.T) {
+	raw, err := ioutil.ReadFile("test_fixtures/fast_parrot.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := gif.DecodeAll(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gifFrameCount(raw); got != len(decoded.Image) {
+		t.Errorf("Expected the gif to have %d frames, got %d", len(decoded.Image), got)
+	}
+	if got := gifFrameCount(raw[:len(raw)/2]); got <= 0 || got >= len(decoded.Image) {
+		t.Errorf("Expected a gif that's cut off to count the frames before the cut, got %d", got)
+	}
+
+	apng := encodeTestApng(t, 4, 2, 0, []testApngFrame{
+		{img: testApngFill(4, 2, 1), delayNum: 1, delayDen: 10},
+		{img: testApngFill(4, 2, 2), delayNum: 1, delayDen: 10},
+		{img: testApngFill(2, 2, 1), delayNum: 1, delayDen: 10},
+	})
+	if got := apngFrameCount(apng); got != 3 {
+		t.Errorf("Expected the animated png to have 3 frames, got %d", got)
+	}
+}
+
+func TestCachedDownloadsAreLimited(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flipdisk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.FileServer(http.Dir("test_fixtures")))
+	defer server.Close()
+	defer allowTestServers()()
+
+	c, err := cache.New(dir, 10*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCache(c)
+	defer SetCache(nil)
+
+	if _, err := download(server.URL+"/fast_parrot.gif", "gif"); err != nil {
+		t.Fatal(err)
+	}
+
+	limits := DefaultFetchLimits()
+	limits.AllowedHosts = []string{"127.0.0.1"}
+	limits.MaxFrames = 3
+	SetFetchLimits(limits)
+	if _, err := download(server.URL+"/fast_parrot.gif", "gif"); !errors.Is(err, ErrTooManyFrames) {
+		t.Errorf("Expected the cached gif to have too many frames now, got %v", err)
+	}
+}
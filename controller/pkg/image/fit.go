@@ -0,0 +1,211 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+// The fit option for images, how an image is scaled into the board. Contain is what you get when it's empty.
+const (
+	FitContain = "contain" // as big as it can be while all of it shows
+	FitCover   = "cover"   // fills the board, the parts that don't fit are cropped off around the focus
+	FitStretch = "stretch" // fills the board, squashed or stretched
+	FitNone    = "none"    // not scaled, cropped around the focus if it's too big
+)
+
+// FitModes are all the values the fit option can have for an image
+var FitModes = []string{FitContain, FitCover, FitStretch, FitNone}
+
+// Fit is how an image is cropped and scaled into the space it has
+type Fit struct {
+	Mode string
+
+	// FocusX and FocusY are the part of the image to keep when it's cropped, from 0 to 1. 0.5, 0.5 is the middle.
+	FocusX, FocusY float64
+
+	// Crop is the part of the image to use, in the image's pixels. It's cropped before it's fit, empty is all of it.
+	Crop image.Rectangle
+}
+
+// ContainFit shows all of the image, it's the default
+var ContainFit = Fit{Mode: FitContain, FocusX: 0.5, FocusY: 0.5}
+
+// NewFit parses the fit, focus and crop options. The focus is "top", "bottom left", "30% 20%" or "0.3 0.2",
+// and the crop is "x y width height" in the image's pixels, e.g. "0 0 200 100".
+func NewFit(mode, focus, crop string) (Fit, error) {
+	fit := ContainFit
+
+	switch mode {
+	case "", "auto": // auto is for text, images are always fit
+	case FitContain, FitCover, FitStretch, FitNone:
+		fit.Mode = mode
+	default:
+		return fit, fmt.Errorf("fit %q is unknown, try %s", mode, strings.Join(FitModes, ", "))
+	}
+
+	var err error
+	if fit.FocusX, fit.FocusY, err = parseFocus(focus); err != nil {
+		return fit, err
+	}
+	if fit.Crop, err = parseCrop(crop); err != nil {
+		return fit, err
+	}
+	return fit, nil
+}
+
+func parseFocus(focus string) (x, y float64, err error) {
+	x, y = 0.5, 0.5
+
+	fields := strings.FieldsFunc(focus, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(fields) > 2 {
+		return x, y, fmt.Errorf("focus %q should be like \"top left\" or \"30%% 20%%\"", focus)
+	}
+
+	// numbers are x then y
+	if len(fields) == 2 {
+		if fx, errX := parseFraction(fields[0]); errX == nil {
+			fy, errY := parseFraction(fields[1])
+			if errY != nil {
+				return x, y, fmt.Errorf("focus %q should be like \"top left\" or \"30%% 20%%\"", focus)
+			}
+			return fx, fy, nil
+		}
+	}
+
+	// words can go in any order, "left top" is the same as "top left"
+	for _, field := range fields {
+		switch strings.ToLower(field) {
+		case "left":
+			x = 0
+		case "right":
+			x = 1
+		case "top":
+			y = 0
+		case "bottom":
+			y = 1
+		case "center", "middle":
+		default:
+			return x, y, fmt.Errorf("focus %q should be like \"top left\" or \"30%% 20%%\"", focus)
+		}
+	}
+	return x, y, nil
+}
+
+// parseFraction reads "30%" or "0.3"
+func parseFraction(s string) (float64, error) {
+	percent := strings.HasSuffix(s, "%")
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if percent {
+		f /= 100
+	}
+	if f < 0 || f > 1 {
+		return 0, errors.New(s + " should be between 0 and 1, or 0% and 100%")
+	}
+	return f, nil
+}
+
+func parseCrop(crop string) (image.Rectangle, error) {
+	if strings.TrimSpace(crop) == "" {
+		return image.Rectangle{}, nil
+	}
+
+	fields := strings.FieldsFunc(crop, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(fields) != 4 {
+		return image.Rectangle{}, fmt.Errorf("crop %q should be \"x y width height\"", crop)
+	}
+
+	var v [4]int
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return image.Rectangle{}, fmt.Errorf("crop %q should be \"x y width height\" in pixels", crop)
+		}
+		v[i] = n
+	}
+	if v[2] == 0 || v[3] == 0 {
+		return image.Rectangle{}, fmt.Errorf("crop %q needs a width and a height", crop)
+	}
+	return image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), nil
+}
+
+// Apply crops and scales the image to fit in width x height dots. Contain can be smaller than that,
+// everything else is exactly that big, unless the image is smaller than the board with FitNone.
+func (fit Fit) Apply(img image.Image, width, height uint) image.Image {
+	if !fit.Crop.Empty() {
+		crop := fit.Crop.Add(img.Bounds().Min).Intersect(img.Bounds())
+		if !crop.Empty() {
+			img = cropImage(img, crop)
+		}
+	}
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w == 0 || h == 0 || width == 0 || height == 0 {
+		return img
+	}
+	boxW, boxH := float64(width), float64(height)
+	widthScale, heightScale := boxW/float64(w), boxH/float64(h)
+
+	switch fit.Mode {
+	case FitStretch:
+		return resize.Resize(width, height, img, resize.Lanczos3)
+
+	case FitCover:
+		scale := widthScale
+		if heightScale > scale {
+			scale = heightScale
+		}
+		img = resize.Resize(scaled(w, scale), scaled(h, scale), img, resize.Lanczos3)
+		return fit.cropAroundFocus(img, width, height)
+
+	case FitNone:
+		return fit.cropAroundFocus(img, width, height)
+
+	default:
+		scale := widthScale
+		if heightScale < scale {
+			scale = heightScale
+		}
+		return resize.Resize(scaled(w, scale), scaled(h, scale), img, resize.Lanczos3)
+	}
+}
+
+// scaled is size * scale rounded, an image is never scaled down to nothing
+func scaled(size int, scale float64) uint {
+	s := uint(float64(size)*scale + 0.5)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+// cropAroundFocus cuts a width x height piece out of the image, it's placed so the focus stays in the same spot
+func (fit Fit) cropAroundFocus(img image.Image, width, height uint) image.Image {
+	b := img.Bounds()
+	w, h := int(width), int(height)
+	if w > b.Dx() {
+		w = b.Dx()
+	}
+	if h > b.Dy() {
+		h = b.Dy()
+	}
+
+	x := b.Min.X + int(float64(b.Dx()-w)*fit.FocusX+0.5)
+	y := b.Min.Y + int(float64(b.Dy()-h)*fit.FocusY+0.5)
+	return cropImage(img, image.Rect(x, y, x+w, y+h))
+}
+
+// cropImage copies the part of the image in r into a new image that starts at 0, 0
+func cropImage(img image.Image, r image.Rectangle) image.Image {
+	cropped := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, r.Min, draw.Src)
+	return cropped
+}
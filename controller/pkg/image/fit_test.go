@@ -0,0 +1,98 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestNewFit(t *testing.T) {
+	tests := map[string]struct {
+		mode, focus, crop string
+
+		expected Fit
+		wantErr  bool
+	}{
+		"defaults":          {expected: ContainFit},
+		"auto is for text":  {mode: "auto", expected: ContainFit},
+		"cover":             {mode: FitCover, expected: Fit{Mode: FitCover, FocusX: 0.5, FocusY: 0.5}},
+		"words":             {mode: FitCover, focus: "top left", expected: Fit{Mode: FitCover, FocusX: 0, FocusY: 0}},
+		"words any order":   {mode: FitCover, focus: "Right Bottom", expected: Fit{Mode: FitCover, FocusX: 1, FocusY: 1}},
+		"one word":          {mode: FitNone, focus: "top", expected: Fit{Mode: FitNone, FocusX: 0.5, FocusY: 0}},
+		"percentages":       {mode: FitCover, focus: "30% 20%", expected: Fit{Mode: FitCover, FocusX: 0.3, FocusY: 0.2}},
+		"fractions":         {mode: FitCover, focus: "0.25,1", expected: Fit{Mode: FitCover, FocusX: 0.25, FocusY: 1}},
+		"crop":              {crop: "10 20 30 40", expected: Fit{Mode: FitContain, FocusX: 0.5, FocusY: 0.5, Crop: image.Rect(10, 20, 40, 60)}},
+		"unknown mode":      {mode: "zoom", wantErr: true},
+		"unknown focus":     {focus: "somewhere", wantErr: true},
+		"focus out of 100%": {focus: "150% 20%", wantErr: true},
+		"too many focus":    {focus: "top left right", wantErr: true},
+		"crop too short":    {crop: "10 20 30", wantErr: true},
+		"crop not numbers":  {crop: "a b c d", wantErr: true},
+		"crop with no size": {crop: "10 20 0 40", wantErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NewFit(test.mode, test.focus, test.crop)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.expected {
+				t.Errorf("Expected %+v, got %+v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestFitApply(t *testing.T) {
+	// 40x20, the left half is black and the right half is white
+	img := image.NewGray(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if x >= 20 {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+
+	tests := map[string]struct {
+		fit           Fit
+		width, height uint
+
+		expectedWidth, expectedHeight int
+		expectedLeftIsBlack           bool
+	}{
+		"contain":             {ContainFit, 10, 10, 10, 5, true},
+		"contain scales up":   {ContainFit, 80, 80, 80, 40, true},
+		"stretch":             {Fit{Mode: FitStretch}, 10, 10, 10, 10, true},
+		"cover":               {Fit{Mode: FitCover, FocusX: 0.5, FocusY: 0.5}, 10, 10, 10, 10, true},
+		"cover on the right":  {Fit{Mode: FitCover, FocusX: 1, FocusY: 0.5}, 10, 10, 10, 10, false},
+		"none":                {Fit{Mode: FitNone, FocusX: 0, FocusY: 0}, 10, 10, 10, 10, true},
+		"none on the right":   {Fit{Mode: FitNone, FocusX: 1, FocusY: 0}, 10, 10, 10, 10, false},
+		"none smaller":        {Fit{Mode: FitNone}, 80, 80, 40, 20, true},
+		"crop":                {Fit{Mode: FitContain, Crop: image.Rect(20, 0, 40, 20)}, 10, 10, 10, 10, false},
+		"crop past the edges": {Fit{Mode: FitNone, Crop: image.Rect(30, 0, 100, 100)}, 50, 50, 10, 20, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := test.fit.Apply(img, test.width, test.height)
+
+			b := got.Bounds()
+			if b.Dx() != test.expectedWidth || b.Dy() != test.expectedHeight {
+				t.Errorf("Expected %dx%d, got %dx%d", test.expectedWidth, test.expectedHeight, b.Dx(), b.Dy())
+			}
+
+			r, _, _, _ := got.At(b.Min.X, b.Min.Y+b.Dy()/2).RGBA()
+			if isBlack := r < 0x8000; isBlack != test.expectedLeftIsBlack {
+				t.Errorf("Expected the left edge to be black: %t, got %t", test.expectedLeftIsBlack, isBlack)
+			}
+		})
+	}
+}
@@ -3,65 +3,38 @@ package image
 import (
 	"bytes"
 	"errors"
-	"fmt"
 	"image"
-	"image/color"
-	"image/color/palette"
 	"image/draw"
 	"image/gif"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
-	"io/ioutil"
-	"net/http"
-	"regexp"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/armory/flipdisks/pkg/fontmap"
+	"github.com/armory/flipdisks/pkg/metrics"
 	"github.com/armory/flipdisks/pkg/virtualboard"
-	"github.com/nfnt/resize"
-	log "github.com/sirupsen/logrus"
 )
 
-func ConvertImageUrlToVirtualBoard(maxWidth, maxHeight uint, imgUrl string, invertImage bool, bwThreshold int) *virtualboard.VirtualBoard {
-	resp, err := http.Get(imgUrl)
-	if err != nil {
-		log.Errorf("couldn't download an image %v", err)
-		return nil
-	}
+var downloadFailures = metrics.NewCounter("flipdisk_image_download_failures_total", "Images and gifs that couldn't be downloaded.", "type")
 
-	img, _, err := image.Decode(resp.Body)
-	if err != nil {
-		log.Errorf("couldn't decode image %v", err)
-		return nil
+func convertImgToVirtualBoard(m image.Image, bounds image.Rectangle, invertImage bool, bwThreshold int, ditherAlgorithm string) *virtualboard.VirtualBoard {
+	lum := luminance(m, bounds)
+	if bwThreshold == AutoThreshold {
+		bwThreshold = OtsuThreshold(lumHistogram(lum))
 	}
-	defer resp.Body.Close()
-
-	img = resize.Thumbnail(maxWidth, maxHeight, img, resize.Lanczos3)
-	bounds := img.Bounds()
-	fmt.Printf("%#v \n", bounds)
-
-	return convertImgToVirtualBoard(img, bounds, invertImage, bwThreshold)
+	return lumToVirtualBoard(lum, invertImage, bwThreshold, ditherAlgorithm)
 }
 
-func convertImgToVirtualBoard(m image.Image, bounds image.Rectangle, invertImage bool, bwThreshold int) *virtualboard.VirtualBoard {
+// lumToVirtualBoard dithers the brightness of every pixel into dots
+func lumToVirtualBoard(lum [][]float64, invertImage bool, bwThreshold int, ditherAlgorithm string) *virtualboard.VirtualBoard {
 	var board []fontmap.Row
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+	for _, dotsRow := range dither(lum, ditherAlgorithm, bwThreshold) {
 		row := fontmap.Row{}
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, _ := m.At(x, y).RGBA()
-			// to get luminosity, we're going to use magic values from
-			// https://stackoverflow.com/questions/596216/formula-to-determine-brightness-of-rgb-color
-			lum := 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
-
-			pixel := color.Gray{Y: uint8(lum / 256)} // determine 8 bit gray scale
-
-			flipdotPixelValue := invertImage
-			if pixel.Y < uint8(bwThreshold) {
-				flipdotPixelValue = !invertImage
-			}
-
-			if flipdotPixelValue {
+		for _, isDot := range dotsRow {
+			if isDot != invertImage {
 				row = append(row, 1)
 			} else {
 				row = append(row, 0)
@@ -77,17 +50,28 @@ func convertImgToVirtualBoard(m image.Image, bounds image.Rectangle, invertImage
 type FlipboardGif struct {
 	Flipboards []*virtualboard.VirtualBoard
 	Delay      []time.Duration
+
+	// BWThreshold is the threshold that was used, with AutoThreshold it's picked once for all the frames so they don't flicker
+	BWThreshold int
+
+	// LoopCount is the gif's own loop count, like image/gif: 0 loops forever, -1 plays once, otherwise it plays LoopCount+1 times
+	LoopCount int
 }
 
-func convertGifToVirtualBoard(raw []byte, maxWidth, maxHeight uint, invertImage bool, bwThreshold int) (*FlipboardGif, error) {
-	flipboardGif := FlipboardGif{
-		Flipboards: []*virtualboard.VirtualBoard{},
-		Delay:      []time.Duration{},
+// GifDelay turns a gif frame delay, in 100ths of a second, into a time.Duration. Like browsers do, a delay of 0 or 1
+// is treated as 10, a lot of gifs have them and they expect to be played at that speed.
+func GifDelay(centiseconds int) time.Duration {
+	if centiseconds <= 1 {
+		centiseconds = 10
 	}
+	return time.Duration(centiseconds) * 10 * time.Millisecond
+}
 
+func convertGifToVirtualBoard(raw []byte, maxWidth, maxHeight uint, invertImage bool, bwThreshold int, ditherAlgorithm string, fit Fit) (*FlipboardGif, error) {
 	g, err := gif.DecodeAll(bytes.NewBuffer(raw))
 	if err != nil {
-		return &flipboardGif, errors.New("couldn't decode gif: " + err.Error())
+		return &FlipboardGif{Flipboards: []*virtualboard.VirtualBoard{}, Delay: []time.Duration{}, BWThreshold: bwThreshold},
+			errors.New("couldn't decode gif: " + err.Error())
 	}
 
 	// Create a new RGBA image to hold the incremental frames.
@@ -100,12 +84,12 @@ func convertGifToVirtualBoard(raw []byte, maxWidth, maxHeight uint, invertImage
 	//fmt.Println("----------------")
 	//return &FlipboardGif{}, nil
 
-	// Resize each f.
+	var frames []image.Image
+	var delays []time.Duration
 	lastFrameThatWasntSetToDisposalPrev := 0
 	for frameIndex := range g.Image {
 		bounds := g.Image[frameIndex].Bounds()
 		img := image.NewRGBA(b)
-		var newGifFrame *image.Paletted
 
 		//fmt.Println("frameNumber", frameIndex, bounds)
 
@@ -138,78 +122,110 @@ func convertGifToVirtualBoard(raw []byte, maxWidth, maxHeight uint, invertImage
 			}
 		}
 
-		newGifFrame = imgToPaletted(resizeImage(maxWidth, maxHeight, img))
-		vBoard := convertImgToVirtualBoard(newGifFrame, newGifFrame.Bounds(), invertImage, bwThreshold)
-		flipboardGif.Flipboards = append(flipboardGif.Flipboards, vBoard)
-
-		// gif time duration is 100th of a second, instead, lets convert it to a time.Duration so it's easier to understand
-		flipboardGif.Delay = append(flipboardGif.Delay, time.Duration(g.Delay[frameIndex]/100)*time.Second)
+		frames = append(frames, img)
+		delays = append(delays, GifDelay(g.Delay[frameIndex]))
 
 		//fmt.Println("summary:")
 		//fmt.Println(g.Image[frameIndex].Bounds())
-		fmt.Println(vBoard)
 
 		//return &FlipboardGif{}, nil
 		//time.Sleep(time.Millisecond * 500)
 	}
 
-	return &flipboardGif, nil
-}
-
-func resizeImage(width, height uint, img image.Image) image.Image {
-	return resize.Resize(width, height, img, resize.Lanczos3)
+	return framesToFlipboardGif(frames, delays, g.LoopCount, maxWidth, maxHeight, invertImage, bwThreshold, ditherAlgorithm, fit), nil
 }
 
-func imgToPaletted(img image.Image) *image.Paletted {
-	b := img.Bounds()
-	pm := image.NewPaletted(b, palette.Plan9)
-	draw.FloydSteinberg.Draw(pm, b, img, image.ZP)
-	return pm
+// convertApngToVirtualBoard is convertGifToVirtualBoard for animated pngs
+func convertApngToVirtualBoard(raw []byte, maxWidth, maxHeight uint, invertImage bool, bwThreshold int, ditherAlgorithm string, fit Fit) (*FlipboardGif, error) {
+	frames, delays, loopCount, err := decodeApng(raw)
+	if err != nil {
+		return &FlipboardGif{Flipboards: []*virtualboard.VirtualBoard{}, Delay: []time.Duration{}, BWThreshold: bwThreshold},
+			errors.New("couldn't decode animated png: " + err.Error())
+	}
+	return framesToFlipboardGif(frames, delays, loopCount, maxWidth, maxHeight, invertImage, bwThreshold, ditherAlgorithm, fit), nil
 }
 
-func ConvertGifFromURLToVirtualBoard(gifUrl string, maxWidth, maxHeight uint, invertImage bool, bwThreshold int) (*FlipboardGif, error) {
-	// download the image http.Get
-	r, err := http.Get(gifUrl)
-	if err != nil {
-		return &FlipboardGif{}, errors.New("couldn't download gif: " + err.Error())
+// framesToFlipboardGif fits every frame of an animation into the board and turns them into dots
+func framesToFlipboardGif(frames []image.Image, delays []time.Duration, loopCount int, maxWidth, maxHeight uint, invertImage bool, bwThreshold int, ditherAlgorithm string, fit Fit) *FlipboardGif {
+	flipboardGif := FlipboardGif{
+		Flipboards:  []*virtualboard.VirtualBoard{},
+		Delay:       delays,
+		BWThreshold: bwThreshold,
+		LoopCount:   loopCount,
 	}
 
-	raw, err := ioutil.ReadAll(r.Body)
-	defer r.Body.Close()
-	if err != nil {
-		return &FlipboardGif{}, errors.New("couldn't get raw gif data: " + err.Error())
+	var frameLums [][][]float64
+	var histogram [256]int
+	for _, frame := range frames {
+		fitted := fit.Apply(frame, maxWidth, maxHeight)
+		lum := luminance(fitted, fitted.Bounds())
+		frameLums = append(frameLums, lum)
+		for i, count := range lumHistogram(lum) {
+			histogram[i] += count
+		}
 	}
 
-	//fmt.Println("asdfasdf")
+	// the whole gif gets the same threshold, otherwise frames that are a bit darker would jump around
+	if flipboardGif.BWThreshold == AutoThreshold {
+		flipboardGif.BWThreshold = OtsuThreshold(histogram)
+	}
+	for _, lum := range frameLums {
+		vBoard := lumToVirtualBoard(lum, invertImage, flipboardGif.BWThreshold, ditherAlgorithm)
+		flipboardGif.Flipboards = append(flipboardGif.Flipboards, vBoard)
+	}
 
-	return convertGifToVirtualBoard(raw, maxWidth, maxHeight, invertImage, bwThreshold)
+	return &flipboardGif
 }
 
-// GetGifUrl given a message, it'll return an array of gif string urls
-func GetGifUrl(url string) []string {
-	matched := regexp.MustCompile(`https?://.*\.gif(?:` + `(?:\?(?:\w|\d|&|=|-)+)` + `|` + `(?:\#(?:\w|-)+)` + `)*`).FindStringSubmatch(url)
+func ConvertGifFromURLToVirtualBoard(gifUrl string, maxWidth, maxHeight uint, invertImage bool, bwThreshold int, ditherAlgorithm string, fit Fit) (*FlipboardGif, error) {
+	key := renderKey(gifUrl, maxWidth, maxHeight, invertImage, bwThreshold, ditherAlgorithm, fit)
+	return renderCached(key, func() (*FlipboardGif, error) {
+		raw, err := download(gifUrl, "gif")
+		if err != nil {
+			return &FlipboardGif{}, err
+		}
+		return convertGifToVirtualBoard(raw, maxWidth, maxHeight, invertImage, bwThreshold, ditherAlgorithm, fit)
+	})
+}
 
-	// we really don't care about the empty ones
-	urls := matched[:0]
-	for _, x := range matched {
-		if x != "" {
-			urls = append(urls, x)
+// ConvertUrlToFrames downloads an image, a gif or an animated png and turns it into dots. What it is comes from the
+// file, not the url, so an animated png is animated. A still image is a gif with a single frame.
+func ConvertUrlToFrames(imgUrl string, maxWidth, maxHeight uint, invertImage bool, bwThreshold int, ditherAlgorithm string, fit Fit) (*FlipboardGif, error) {
+	key := renderKey(imgUrl, maxWidth, maxHeight, invertImage, bwThreshold, ditherAlgorithm, fit)
+	return renderCached(key, func() (*FlipboardGif, error) {
+		raw, err := download(imgUrl, "image")
+		if err != nil {
+			return &FlipboardGif{}, err
 		}
+		return convertToFrames(raw, maxWidth, maxHeight, invertImage, bwThreshold, ditherAlgorithm, fit)
+	})
+}
+
+func convertToFrames(raw []byte, maxWidth, maxHeight uint, invertImage bool, bwThreshold int, ditherAlgorithm string, fit Fit) (*FlipboardGif, error) {
+	switch {
+	case bytes.HasPrefix(raw, []byte("GIF8")):
+		return convertGifToVirtualBoard(raw, maxWidth, maxHeight, invertImage, bwThreshold, ditherAlgorithm, fit)
+	case isApng(raw):
+		return convertApngToVirtualBoard(raw, maxWidth, maxHeight, invertImage, bwThreshold, ditherAlgorithm, fit)
 	}
 
-	return urls
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return &FlipboardGif{}, errors.New("couldn't decode image: " + err.Error())
+	}
+	return framesToFlipboardGif([]image.Image{img}, []time.Duration{0}, -1, maxWidth, maxHeight, invertImage, bwThreshold, ditherAlgorithm, fit), nil
 }
 
-func GetPlainImageUrl(url string) []string {
-	matchImageUrls := regexp.MustCompile(`https?://.*\.(?:png|jpeg|jpg)(?:` + `(?:\?(?:\w|\d|&|=|-)+)` + `|` + `(?:\#(?:\w|-)+)` + `)*`).FindStringSubmatch(url)
+// ConvertUrlToInlineFrames downloads an image or an animation to go in the middle of text, it's scaled to be height
+// dots tall and keeps its shape.
+func ConvertUrlToInlineFrames(imgUrl string, height uint, bwThreshold int, ditherAlgorithm string) (*FlipboardGif, error) {
+	// emojis are square, but let's not let a panorama take up the whole line
+	return ConvertUrlToFrames(imgUrl, height*4, height, false, bwThreshold, ditherAlgorithm, ContainFit)
+}
 
-	// we really don't care about the empty ones
-	urls := matchImageUrls[:0]
-	for _, x := range matchImageUrls {
-		if x != "" {
-			urls = append(urls, x)
-		}
+func imageExtension(url string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
 	}
-
-	return urls
+	return strings.ToLower(path.Ext(url))
 }
@@ -3,11 +3,13 @@ package image
 import (
 	"image"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/armory/flipdisks/pkg/virtualboard"
-	"github.com/go-test/deep"
 )
 
 func TestConvert(t *testing.T) {
@@ -22,7 +24,7 @@ func TestConvert(t *testing.T) {
 	}
 	bounds := img.Bounds()
 
-	v := convertImgToVirtualBoard(img, bounds, false, 140)
+	v := convertImgToVirtualBoard(img, bounds, false, 140, DitherThreshold)
 
 	expected, err := ioutil.ReadFile("test_fixtures/armory_virtualboard.txt")
 	if err != nil {
@@ -36,172 +38,6 @@ func TestConvert(t *testing.T) {
 	}
 }
 
-func TestGetPlainImageUrl(t *testing.T) {
-	tests := map[string]struct {
-		url string
-
-		plainUrls []string
-	}{
-		".png": {
-			url:       "http://www.blah.com/doge.png",
-			plainUrls: []string{"http://www.blah.com/doge.png"},
-		},
-		"https .png": {
-			url:       "https://www.blah.com/cats.png",
-			plainUrls: []string{"https://www.blah.com/cats.png"},
-		},
-		"png in url path should not match, only if it's a file extension": {
-			url:       "https://www.blah.com/cats/png",
-			plainUrls: nil,
-		},
-		"should be able to handle anchors for .png": {
-			url:       "https://www.blah.com/cats.png#blah",
-			plainUrls: []string{"https://www.blah.com/cats.png#blah"},
-		},
-		"should be able to handle query params for .png": {
-			url:       "https://www.blah.com/cats.png?one=1",
-			plainUrls: []string{"https://www.blah.com/cats.png?one=1"},
-		},
-		".jpg": {
-			url:       "https://www.blah.com/doge.jpg",
-			plainUrls: []string{"https://www.blah.com/doge.jpg"},
-		},
-		"https .jpg": {
-			url:       "https://www.blah.com/cats.jpg",
-			plainUrls: []string{"https://www.blah.com/cats.jpg"},
-		},
-		"jpg in url path should not match, only if it's a file extension": {
-			url:       "https://www.blah.com/cats/jpg",
-			plainUrls: nil,
-		},
-		"should be able to handle anchors for .jpg": {
-			url:       "https://www.blah.com/cats.jpg#blah",
-			plainUrls: []string{"https://www.blah.com/cats.jpg#blah"},
-		},
-		"should be able to handle query params for .jpg": {
-			url:       "https://www.blah.com/cats.jpg?one=1",
-			plainUrls: []string{"https://www.blah.com/cats.jpg?one=1"},
-		},
-		".jpeg": {
-			url:       "https://www.blah.com/doge.jpeg",
-			plainUrls: []string{"https://www.blah.com/doge.jpeg"},
-		},
-		"https .jpeg": {
-			url:       "https://www.blah.com/cats.jpeg",
-			plainUrls: []string{"https://www.blah.com/cats.jpeg"},
-		},
-		"jpeg in url path should not match, only if it's a file extension": {
-			url:       "https://www.blah.com/cats/jpeg",
-			plainUrls: nil,
-		},
-		"should be able to handle anchors with .jpeg": {
-			url:       "https://www.blah.com/cats.jpeg#blah",
-			plainUrls: []string{"https://www.blah.com/cats.jpeg#blah"},
-		},
-		"should be able to handle query params with .jpeg": {
-			url:       "https://www.blah.com/cats.jpeg?one=1",
-			plainUrls: []string{"https://www.blah.com/cats.jpeg?one=1"},
-		},
-		".txt": {
-			url:       "https://www.blah.com/names.txt",
-			plainUrls: nil,
-		},
-		"no extension": {
-			url:       "http://www.blah.com",
-			plainUrls: nil,
-		},
-	}
-	for name, test := range tests {
-		t.Run(name, func(t *testing.T) {
-			plainUrls := GetPlainImageUrl(test.url)
-			diffs := deep.Equal(plainUrls, test.plainUrls)
-
-			for _, diff := range diffs {
-				t.Errorf(`Test "%s" failed with: %s`, name, diff)
-			}
-		})
-	}
-}
-
-func TestIsGifUrl(t *testing.T) {
-	tests := map[string]struct {
-		url string
-
-		gifUrls []string
-	}{
-		".gif": {
-			url:     "please display this: http://www.blah.com/doge.gif",
-			gifUrls: []string{"http://www.blah.com/doge.gif"},
-		},
-		"https .gif": {
-			url:     "https://www.blah.com/cats.gif",
-			gifUrls: []string{"https://www.blah.com/cats.gif"},
-		},
-		"gif in url path should not match, only if it's a file extension": {
-			url:     "https://www.blah.com/cats/gif",
-			gifUrls: nil,
-		},
-		"should be able to handle anchors": {
-			url:     "https://www.blah.com/cats.gif#blah",
-			gifUrls: []string{"https://www.blah.com/cats.gif#blah"},
-		},
-		"should be able to handle query params": {
-			url:     "https://www.blah.com/cats.gif?one=1",
-			gifUrls: []string{"https://www.blah.com/cats.gif?one=1"},
-		},
-		".png": {
-			url:     "http://www.blah.com/ballon.png",
-			gifUrls: nil,
-		},
-		".jpg": {
-			url:     "https://www.blah.com/doge.jpg",
-			gifUrls: nil,
-		},
-		".jpeg": {
-			url:     "https://www.blah.com/doge.jpeg",
-			gifUrls: nil,
-		},
-		".txt": {
-			url:     "https://www.blah.com/names.txt",
-			gifUrls: nil,
-		},
-		"no extension": {
-			url:     "http://www.blah.com",
-			gifUrls: nil,
-		},
-		"slack: simple url": {
-			url:     "<https://www.blah.com/cats.gif>",
-			gifUrls: []string{"https://www.blah.com/cats.gif"},
-		},
-		"slack: should be able to handle query params": {
-			url:     "<https://www.blah.com/cats.gif?one=1>",
-			gifUrls: []string{"https://www.blah.com/cats.gif?one=1"},
-		},
-		"slack: should be able to handle query params with dashes": {
-			url:     "<https://www.blah.com/cats.gif?one=1&hello=you-animal>",
-			gifUrls: []string{"https://www.blah.com/cats.gif?one=1&hello=you-animal"},
-		},
-		"slack: simple url with anchor": {
-			url:     "<https://www.blah.com/cats.gif#mooo>",
-			gifUrls: []string{"https://www.blah.com/cats.gif#mooo"},
-		},
-		"slack: simple url with anchor dash and number": {
-			url:     "<https://www.blah.com/cats.gif#mooo-12323-abc>",
-			gifUrls: []string{"https://www.blah.com/cats.gif#mooo-12323-abc"},
-		},
-	}
-	for name, test := range tests {
-		t.Run(name, func(t *testing.T) {
-			gifUrls := GetGifUrl(test.url)
-			diffs := deep.Equal(gifUrls, test.gifUrls)
-
-			for _, diff := range diffs {
-				t.Errorf(`Test "%s" failed with: %s`, name, diff)
-			}
-		})
-	}
-}
-
 func TestConvertGifFromURLToVirtualBoard(t *testing.T) {
 	gifBytes, err := ioutil.ReadFile("test_fixtures/fast_parrot.gif")
 	if err != nil {
@@ -213,7 +49,7 @@ func TestConvertGifFromURLToVirtualBoard(t *testing.T) {
 		t.Error(err)
 	}
 
-	gotGif, err := convertGifToVirtualBoard(gifBytes, 50, 50, false, 90)
+	gotGif, err := convertGifToVirtualBoard(gifBytes, 50, 50, false, 90, DitherThreshold, Fit{Mode: FitStretch})
 	if err != nil {
 		t.Error(err)
 	}
@@ -233,3 +69,50 @@ func TestConvertGifFromURLToVirtualBoard(t *testing.T) {
 		t.Errorf("Got\n%s", gotGifFramesTxt)
 	}
 }
+
+func TestConvertUrlToInlineFrames(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("test_fixtures")))
+	defer server.Close()
+	defer allowTestServers()()
+
+	gif, err := ConvertUrlToInlineFrames(server.URL+"/fast_parrot.gif", 7, 90, DitherThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gif.Flipboards) < 2 || len(gif.Flipboards) != len(gif.Delay) {
+		t.Errorf("Expected an animation with a delay for every frame, got %d frames and %d delays", len(gif.Flipboards), len(gif.Delay))
+	}
+	for _, frame := range gif.Flipboards {
+		if len(*frame) != 7 {
+			t.Errorf("Expected frames to be 7 dots tall, got %d", len(*frame))
+		}
+	}
+
+	jpg, err := ConvertUrlToInlineFrames(server.URL+"/armory.jpg", 7, 140, DitherAtkinson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jpg.Flipboards) != 1 || len(*jpg.Flipboards[0]) > 7 {
+		t.Errorf("Expected a single frame that's at most 7 dots tall, got %d frames", len(jpg.Flipboards))
+	}
+
+	if _, err := ConvertUrlToInlineFrames(server.URL+"/missing.png", 7, 140, DitherThreshold); err == nil {
+		t.Error("Expected an error for an image that doesn't exist")
+	}
+}
+
+func TestGifDelay(t *testing.T) {
+	tests := map[int]time.Duration{
+		0:   100 * time.Millisecond, // like browsers, 0 and 1 are too fast to be real
+		1:   100 * time.Millisecond,
+		2:   20 * time.Millisecond,
+		7:   70 * time.Millisecond,
+		150: 1500 * time.Millisecond,
+	}
+
+	for centiseconds, expected := range tests {
+		if got := GifDelay(centiseconds); got != expected {
+			t.Errorf("Expected %d centiseconds to be %s, got %s", centiseconds, expected, got)
+		}
+	}
+}
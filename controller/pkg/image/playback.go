@@ -0,0 +1,70 @@
+package image
+
+import (
+	"math"
+	"time"
+)
+
+// The playback option, which way a gif's frames go. Forward is what you get when it's empty.
+const (
+	PlaybackForward  = "forward"
+	PlaybackReverse  = "reverse"
+	PlaybackPingpong = "pingpong" // forward then back again, without showing the first and last frames twice
+)
+
+// Playbacks are all the values the playback option can have
+var Playbacks = []string{PlaybackForward, PlaybackReverse, PlaybackPingpong}
+
+// IsPlayback is true for the playbacks we know, and for empty, which is forward
+func IsPlayback(name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, playback := range Playbacks {
+		if name == playback {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSpeed is true for speeds a gif can play at, 0 is the gif's own speed. Negative speeds, infinity and
+// speeds that aren't a number can't divide the frame delays.
+func IsSpeed(speed float64) bool {
+	return speed >= 0 && !math.IsInf(speed, 1)
+}
+
+// Loop is one time through the gif, frames are indexes into Flipboards and delays is how long each of them is shown.
+// A speed of 2 plays it twice as fast, 0 is the gif's own speed.
+func (g *FlipboardGif) Loop(playback string, speed float64) (frames []int, delays []time.Duration) {
+	count := len(g.Flipboards)
+	if len(g.Delay) < count {
+		count = len(g.Delay)
+	}
+
+	switch playback {
+	case PlaybackReverse:
+		for i := count - 1; i >= 0; i-- {
+			frames = append(frames, i)
+		}
+	case PlaybackPingpong:
+		for i := 0; i < count; i++ {
+			frames = append(frames, i)
+		}
+		for i := count - 2; i > 0; i-- {
+			frames = append(frames, i)
+		}
+	default:
+		for i := 0; i < count; i++ {
+			frames = append(frames, i)
+		}
+	}
+
+	if speed <= 0 || !IsSpeed(speed) {
+		speed = 1
+	}
+	for _, frame := range frames {
+		delays = append(delays, time.Duration(float64(g.Delay[frame])/speed))
+	}
+	return frames, delays
+}
@@ -0,0 +1,80 @@
+package image
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/armory/flipdisks/pkg/virtualboard"
+)
+
+func TestLoop(t *testing.T) {
+	ms := time.Millisecond
+	gif := FlipboardGif{
+		Flipboards: make([]*virtualboard.VirtualBoard, 4),
+		Delay:      []time.Duration{100 * ms, 200 * ms, 300 * ms, 400 * ms},
+	}
+
+	tests := map[string]struct {
+		playback string
+		speed    float64
+
+		expectedFrames []int
+		expectedDelays []time.Duration
+	}{
+		"forward": {
+			expectedFrames: []int{0, 1, 2, 3},
+			expectedDelays: []time.Duration{100 * ms, 200 * ms, 300 * ms, 400 * ms},
+		},
+		"reverse": {
+			playback:       PlaybackReverse,
+			expectedFrames: []int{3, 2, 1, 0},
+			expectedDelays: []time.Duration{400 * ms, 300 * ms, 200 * ms, 100 * ms},
+		},
+		"pingpong": {
+			playback:       PlaybackPingpong,
+			expectedFrames: []int{0, 1, 2, 3, 2, 1},
+			expectedDelays: []time.Duration{100 * ms, 200 * ms, 300 * ms, 400 * ms, 300 * ms, 200 * ms},
+		},
+		"twice as fast": {
+			speed:          2,
+			expectedFrames: []int{0, 1, 2, 3},
+			expectedDelays: []time.Duration{50 * ms, 100 * ms, 150 * ms, 200 * ms},
+		},
+		"half speed": {
+			playback:       PlaybackReverse,
+			speed:          0.5,
+			expectedFrames: []int{3, 2, 1, 0},
+			expectedDelays: []time.Duration{800 * ms, 600 * ms, 400 * ms, 200 * ms},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			frames, delays := gif.Loop(test.playback, test.speed)
+			if !reflect.DeepEqual(test.expectedFrames, frames) {
+				t.Errorf("Expected frames %v, got %v", test.expectedFrames, frames)
+			}
+			if !reflect.DeepEqual(test.expectedDelays, delays) {
+				t.Errorf("Expected delays %v, got %v", test.expectedDelays, delays)
+			}
+		})
+	}
+}
+
+func TestIsSpeed(t *testing.T) {
+	for speed, expected := range map[float64]bool{
+		0:            true,
+		0.5:          true,
+		2:            true,
+		-1:           false,
+		math.Inf(1):  false,
+		math.Inf(-1): false,
+		math.NaN():   false,
+	} {
+		if got := IsSpeed(speed); got != expected {
+			t.Errorf("Expected IsSpeed(%v) to be %t, got %t", speed, expected, got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package image
+
+import "github.com/armory/flipdisks/pkg/options"
+
+// AutoThreshold is bwThreshold: auto, the threshold is picked for every image with OtsuThreshold
+const AutoThreshold = int(options.ThresholdAuto)
+
+// lumHistogram counts how many pixels there are of every brightness
+func lumHistogram(lum [][]float64) [256]int {
+	var histogram [256]int
+	for _, row := range lum {
+		for _, l := range row {
+			i := int(l)
+			if i < 0 {
+				i = 0
+			} else if i > 255 {
+				i = 255
+			}
+			histogram[i]++
+		}
+	}
+	return histogram
+}
+
+// OtsuThreshold picks the threshold that splits the pixels into a dark and a light group that are each as even
+// as they can be, see https://en.wikipedia.org/wiki/Otsu%27s_method. Pixels darker than it are dots.
+func OtsuThreshold(histogram [256]int) int {
+	total, sum := 0, 0.0
+	for i, count := range histogram {
+		total += count
+		sum += float64(i * count)
+	}
+	if total == 0 {
+		return 128
+	}
+
+	best, bestVariance := 0, -1.0
+	darkCount, darkSum := 0, 0.0
+	for i, count := range histogram {
+		darkCount += count
+		darkSum += float64(i * count)
+
+		lightCount := total - darkCount
+		if darkCount == 0 || lightCount == 0 {
+			continue
+		}
+
+		darkMean := darkSum / float64(darkCount)
+		lightMean := (sum - darkSum) / float64(lightCount)
+		variance := float64(darkCount) * float64(lightCount) * (darkMean - lightMean) * (darkMean - lightMean)
+		if variance > bestVariance {
+			best, bestVariance = i, variance
+		}
+	}
+
+	if bestVariance < 0 {
+		return 128 // every pixel is the same, there's nothing to split
+	}
+
+	// everything at i or darker is in the dark group
+	return best + 1
+}
@@ -0,0 +1,55 @@
+package image
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestOtsuThreshold(t *testing.T) {
+	var dark, bimodal, empty [256]int
+	dark[30] = 100
+	bimodal[20], bimodal[200] = 50, 50
+	bimodal[60], bimodal[170] = 10, 10
+
+	tests := map[string]struct {
+		histogram [256]int
+		expected  int
+	}{
+		"dark and light pixels are split in between": {histogram: bimodal, expected: 61},
+		"one color": {histogram: dark, expected: 128},
+		"no pixels": {histogram: empty, expected: 128},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := OtsuThreshold(test.histogram); got != test.expected {
+				t.Errorf("Expected %d, got %d", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestAutoThresholdGif(t *testing.T) {
+	gifBytes, err := ioutil.ReadFile("test_fixtures/fast_parrot.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gif, err := convertGifToVirtualBoard(gifBytes, 50, 50, false, AutoThreshold, DitherThreshold, Fit{Mode: FitStretch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gif.BWThreshold <= 0 || gif.BWThreshold > 256 {
+		t.Errorf("Expected a threshold to be picked for the whole gif, got %d", gif.BWThreshold)
+	}
+
+	pinned, err := convertGifToVirtualBoard(gifBytes, 50, 50, false, gif.BWThreshold, DitherThreshold, Fit{Mode: FitStretch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range gif.Flipboards {
+		if gif.Flipboards[i].String() != pinned.Flipboards[i].String() {
+			t.Errorf("frame %d should be the same as when the picked threshold is used", i)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What's at a url, it decides if a message is a gif, an image, or text with a link in it
+const (
+	KindGif   = "gif"
+	KindImage = "image" // a still image or an animated png
+	KindOther = "other" // a web page, or an image we can't decode
+)
+
+// sniffLength is how much of a url is downloaded to see what it is, it's what http.DetectContentType looks at
+const sniffLength = 512
+
+// maxUrlKinds is how many urls we remember the kind of, every message looks them up a few times while it's rendered
+const maxUrlKinds = 1000
+
+// failedKindTime is how long a url that couldn't be reached goes by its extension before it's asked again,
+// so a host that's down only costs one timeout per message instead of one per lookup
+const failedKindTime = time.Minute
+
+// urlKind is what's at a url, kinds that came from the extension because the url couldn't be reached expire
+type urlKind struct {
+	kind    string
+	expires time.Time
+}
+
+var urlKinds = struct {
+	sync.Mutex
+	kinds map[string]urlKind
+}{kinds: map[string]urlKind{}}
+
+// giphyMedia is where giphy keeps the gif for an id, a page like giphy.com/gifs/cat-abc123 is a web page
+var giphyMedia = "https://media.giphy.com/media/%s/giphy.gif"
+
+var giphyId = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// mediaUrl is the url of the gif or image a page is showing, for the sites we know how to find it on without
+// downloading the page. Everything else is given back as it is.
+func mediaUrl(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+
+	switch strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") {
+	case "giphy.com":
+		// giphy.com/gifs/<slug>-<id>, giphy.com/stickers/<slug>-<id>, or giphy.com/embed/<id>
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) != 2 || (parts[0] != "gifs" && parts[0] != "stickers" && parts[0] != "embed") {
+			return url
+		}
+		id := parts[1][strings.LastIndex(parts[1], "-")+1:]
+		if !giphyId.MatchString(id) {
+			return url
+		}
+		return fmt.Sprintf(giphyMedia, id)
+	}
+	return url
+}
+
+// FindUrls returns every http and https url in the message, in the order they're in
+func FindUrls(message string) []string {
+	var urls []string
+	for _, match := range FindUrlIndexes(message) {
+		urls = append(urls, message[match[0]:match[1]])
+	}
+	return urls
+}
+
+// FindUrlIndexes is FindUrls, but it returns where every url starts and ends, like regexp's FindAllStringIndex.
+// Urls end at whitespace, at the brackets and pipes slack wraps links in, like <https://a.com|a.com>, or where the
+// next url starts, emojis turn into urls that are right next to each other. Punctuation at the end is part of the
+// sentence, not the url, unless it's closing a bracket that's in the url.
+func FindUrlIndexes(message string) [][]int {
+	var matches [][]int
+	for offset := 0; offset < len(message); {
+		start := nextUrl(message[offset:])
+		if start < 0 {
+			break
+		}
+		start += offset
+
+		end := strings.IndexAny(message[start:], " \t\r\n<>|\"")
+		if end < 0 {
+			end = len(message)
+		} else {
+			end += start
+		}
+		if next := nextUrl(message[start+1 : end]); next >= 0 {
+			end = start + 1 + next
+		}
+
+		url := trimUrlPunctuation(message[start:end])
+		if !strings.HasSuffix(url, "://") {
+			matches = append(matches, []int{start, start + len(url)})
+		}
+		offset = start + len(url)
+	}
+	return matches
+}
+
+func nextUrl(s string) int {
+	httpStart := strings.Index(s, "http://")
+	httpsStart := strings.Index(s, "https://")
+	if httpStart < 0 || (httpsStart >= 0 && httpsStart < httpStart) {
+		return httpsStart
+	}
+	return httpStart
+}
+
+func trimUrlPunctuation(url string) string {
+	for len(url) > 0 {
+		last := url[len(url)-1]
+		switch {
+		case strings.IndexByte(`.,!?:;'"`, last) >= 0:
+		case last == ')' && strings.Count(url, "(") < strings.Count(url, ")"):
+		default:
+			return url
+		}
+		url = url[:len(url)-1]
+	}
+	return url
+}
+
+// UrlKind is what's at the url, it doesn't go by the extension, lots of image urls don't have one. It asks the server
+// for the content type with a HEAD request, and when the server won't say, it looks at the first bytes. Redirects
+// are followed, and pages we know the media url for, like giphy's, are the kind of their media.
+// When the url can't be reached it's all we have, so it goes by the extension for failedKindTime.
+func UrlKind(url string) string {
+	urlKinds.Lock()
+	known, ok := urlKinds.kinds[url]
+	urlKinds.Unlock()
+	if ok && (known.expires.IsZero() || time.Now().Before(known.expires)) {
+		return known.kind
+	}
+
+	var found urlKind
+	if raw, ok := getCache().Get(cacheDownloads, url); ok {
+		found.kind = sniffKind(raw)
+	} else {
+		var err error
+		if found.kind, err = getFetcher().kind(mediaUrl(url)); err != nil {
+			found = urlKind{kind: kindOfExtension(mediaUrl(url)), expires: time.Now().Add(failedKindTime)}
+		}
+	}
+
+	urlKinds.Lock()
+	if len(urlKinds.kinds) >= maxUrlKinds {
+		urlKinds.kinds = map[string]urlKind{}
+	}
+	urlKinds.kinds[url] = found
+	urlKinds.Unlock()
+	return found.kind
+}
+
+// kind asks the server what's at the url, then looks at the first bytes when the server's answer doesn't say.
+// When the server can't be reached, or says there's nothing there, it gives up right away.
+func (f *fetcher) kind(url string) (string, error) {
+	r, err := f.client.Head(url)
+	if err != nil {
+		return "", &FetchError{URL: url, Err: fetchFailure(err)}
+	}
+	r.Body.Close()
+	if r.StatusCode == http.StatusNotFound || r.StatusCode == http.StatusGone {
+		return "", &FetchError{URL: url, Err: errors.New(r.Status)}
+	}
+	if r.StatusCode == http.StatusOK {
+		if kind := kindOfContentType(r.Header.Get("Content-Type")); kind != "" {
+			return kind, nil
+		}
+	}
+
+	// some servers don't do HEAD, and a lot of them say everything is application/octet-stream
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Range", "bytes=0-"+strconv.Itoa(sniffLength-1))
+	r, err = f.client.Do(req)
+	if err != nil {
+		return "", &FetchError{URL: url, Err: fetchFailure(err)}
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK && r.StatusCode != http.StatusPartialContent {
+		return "", &FetchError{URL: url, Err: errors.New(r.Status)}
+	}
+
+	// the server might send all of it anyway
+	start, err := ioutil.ReadAll(io.LimitReader(r.Body, sniffLength))
+	if err != nil {
+		return "", &FetchError{URL: url, Err: fetchFailure(err)}
+	}
+	return sniffKind(start), nil
+}
+
+// sniffKind is the kind of the content from its first bytes
+func sniffKind(start []byte) string {
+	if kind := kindOfContentType(http.DetectContentType(start)); kind != "" {
+		return kind
+	}
+	return KindOther
+}
+
+// kindOfContentType is the kind for a content type, or "" when it doesn't say what the content really is
+func kindOfContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	switch mediaType {
+	case "image/gif":
+		return KindGif
+	case "image/png", "image/apng", "image/jpeg", "image/pjpeg":
+		return KindImage
+	case "application/octet-stream", "binary/octet-stream", "application/unknown":
+		return ""
+	}
+	return KindOther
+}
+
+func kindOfExtension(url string) string {
+	switch imageExtension(url) {
+	case ".gif":
+		return KindGif
+	case ".png", ".jpg", ".jpeg":
+		return KindImage
+	}
+	return KindOther
+}
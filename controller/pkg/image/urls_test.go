@@ -0,0 +1,206 @@
+package image
+
+import (
+	"bytes"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestFindUrls(t *testing.T) {
+	tests := map[string]struct {
+		message string
+
+		urls []string
+	}{
+		"a gif": {
+			message: "please display this: http://www.blah.com/doge.gif",
+			urls:    []string{"http://www.blah.com/doge.gif"},
+		},
+		"query params and anchors": {
+			message: "https://www.blah.com/cats.png?one=1&two=2#blah",
+			urls:    []string{"https://www.blah.com/cats.png?one=1&two=2#blah"},
+		},
+		"no extension": {
+			message: "https://images.example.com/abc123",
+			urls:    []string{"https://images.example.com/abc123"},
+		},
+		"every url, without the text around them": {
+			message: "first http://a.com/one.gif and then https://b.com/two.jpg, ok?",
+			urls:    []string{"http://a.com/one.gif", "https://b.com/two.jpg"},
+		},
+		"urls right next to each other": {
+			message: "yay https://a.com/tada.gif?v=1https://a.com/cake.png!",
+			urls:    []string{"https://a.com/tada.gif?v=1", "https://a.com/cake.png"},
+		},
+		"wrapped by slack": {
+			message: "look <https://giphy.com/gifs/cat-abc|giphy.com/gifs/cat-abc> and <http://a.com/b.png>",
+			urls:    []string{"https://giphy.com/gifs/cat-abc", "http://a.com/b.png"},
+		},
+		"in brackets": {
+			message: "(see https://en.wikipedia.org/wiki/Flip-disc_(display)).",
+			urls:    []string{"https://en.wikipedia.org/wiki/Flip-disc_(display)"},
+		},
+		"not a url": {
+			message: "http:// is how urls start, www.blah.com doesn't",
+			urls:    nil,
+		},
+		"no urls": {
+			message: "lunch",
+			urls:    nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, diff := range deep.Equal(FindUrls(test.message), test.urls) {
+				t.Errorf(`Test "%s" failed with: %s`, name, diff)
+			}
+		})
+	}
+}
+
+func TestUrlKind(t *testing.T) {
+	parrot, err := ioutil.ReadFile("test_fixtures/fast_parrot.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var still bytes.Buffer
+	if err := png.Encode(&still, testApngFill(4, 2, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/parrot", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(parrot)
+	})
+	mux.HandleFunc("/photo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg; charset=binary")
+	})
+	mux.HandleFunc("/page.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><body>not a png</body></html>"))
+	})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write(still.Bytes())
+	})
+	mux.Handle("/short", http.RedirectHandler("/parrot", http.StatusFound))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer allowTestServers()()
+
+	tests := map[string]string{
+		server.URL + "/parrot":   KindGif,   // the server doesn't say, so it's sniffed
+		server.URL + "/photo":    KindImage, // the server says
+		server.URL + "/page.png": KindOther, // the extension is wrong
+		server.URL + "/no-head":  KindImage,
+		server.URL + "/short":    KindGif,
+		server.URL + "/missing":  KindOther,
+
+		// when it can't be reached, all that's left is the extension
+		"http://flipdisk.invalid/cat.gif":  KindGif,
+		"http://flipdisk.invalid/cat.JPG":  KindImage,
+		"http://flipdisk.invalid/cat/page": KindOther,
+	}
+
+	for url, expected := range tests {
+		if got := UrlKind(url); got != expected {
+			t.Errorf("%s: Expected %s, but got %s", url, expected, got)
+		}
+	}
+}
+
+func TestUrlKindRemembersFailures(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	defer allowTestServers()()
+
+	// a message looks its urls up a few times while it's rendered
+	for i := 0; i < 3; i++ {
+		if got := UrlKind(server.URL + "/gone.gif"); got != KindGif {
+			t.Errorf("Expected %s from the extension, but got %s", KindGif, got)
+		}
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("Expected the server to be asked once, it was asked %d times", atomic.LoadInt32(&requests))
+	}
+
+	// it's asked again once the failure has expired
+	urlKinds.Lock()
+	failed := urlKinds.kinds[server.URL+"/gone.gif"]
+	failed.expires = time.Now().Add(-time.Second)
+	urlKinds.kinds[server.URL+"/gone.gif"] = failed
+	urlKinds.Unlock()
+	UrlKind(server.URL + "/gone.gif")
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("Expected the server to be asked again after the failure expired, it was asked %d times", atomic.LoadInt32(&requests))
+	}
+}
+
+func TestMediaUrl(t *testing.T) {
+	tests := map[string]string{
+		"https://giphy.com/gifs/cat-funny-JIX9t2j0ZTN9S":           "https://media.giphy.com/media/JIX9t2j0ZTN9S/giphy.gif",
+		"https://www.giphy.com/gifs/JIX9t2j0ZTN9S?utm_source=x":    "https://media.giphy.com/media/JIX9t2j0ZTN9S/giphy.gif",
+		"https://giphy.com/stickers/happy-dance-l0HlBO7eyXzSZkJri": "https://media.giphy.com/media/l0HlBO7eyXzSZkJri/giphy.gif",
+		"https://giphy.com/embed/l0HlBO7eyXzSZkJri":                "https://media.giphy.com/media/l0HlBO7eyXzSZkJri/giphy.gif",
+		"https://giphy.com/explore/cats":                           "https://giphy.com/explore/cats",
+		"https://giphy.com/gifs/":                                  "https://giphy.com/gifs/",
+		"https://a.com/gifs/cat-abc":                               "https://a.com/gifs/cat-abc",
+	}
+
+	for url, expected := range tests {
+		if got := mediaUrl(url); got != expected {
+			t.Errorf("%s: Expected %s, but got %s", url, expected, got)
+		}
+	}
+}
+
+func TestUrlKindOfGiphyPage(t *testing.T) {
+	parrot, err := ioutil.ReadFile("test_fixtures/fast_parrot.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/media/abc123/giphy.gif" {
+			// the page itself is html, it's never what's asked for
+			w.Header().Set("Content-Type", "text/html")
+			return
+		}
+		w.Header().Set("Content-Type", "image/gif")
+		w.Write(parrot)
+	}))
+	defer server.Close()
+	defer allowTestServers()()
+
+	defer func(media string) { giphyMedia = media }(giphyMedia)
+	giphyMedia = server.URL + "/media/%s/giphy.gif"
+
+	page := "https://giphy.com/gifs/party-parrot-abc123"
+	if got := UrlKind(page); got != KindGif {
+		t.Errorf("Expected the giphy page to be a %s, got %s", KindGif, got)
+	}
+
+	raw, err := download(page, "gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, parrot) {
+		t.Error("Expected the gif to be downloaded instead of the page")
+	}
+}
@@ -0,0 +1,253 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric is anything that can write itself out in the Prometheus text format
+type Metric interface {
+	Name() string
+	Write(w io.Writer)
+}
+
+var registry = struct {
+	sync.Mutex
+	metrics map[string]Metric
+}{metrics: map[string]Metric{}}
+
+// Register adds the metric to the /metrics output, a metric with the same name will be replaced
+func Register(m Metric) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.metrics[m.Name()] = m
+}
+
+// WriteAll writes every registered metric in the Prometheus text format, sorted by name
+func WriteAll(w io.Writer) {
+	registry.Lock()
+	var names []string
+	for name := range registry.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var all []Metric
+	for _, name := range names {
+		all = append(all, registry.metrics[name])
+	}
+	registry.Unlock()
+
+	for _, m := range all {
+		m.Write(w)
+	}
+}
+
+// Handler serves the registered metrics for Prometheus to scrape
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteAll(w)
+	})
+}
+
+// vec holds one value per combination of label values
+type vec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mutex  sync.Mutex
+	keys   []string
+	labels map[string][]string
+}
+
+func newVec(name, help string, labelNames []string) vec {
+	return vec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		labels:     map[string][]string{},
+	}
+}
+
+func (v *vec) Name() string {
+	return v.name
+}
+
+// key must be called with the mutex held
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %s wants %d labels, got %d", v.name, len(v.labelNames), len(labelValues)))
+	}
+
+	k := strings.Join(labelValues, "\xff")
+	if _, exists := v.labels[k]; !exists {
+		v.keys = append(v.keys, k)
+		sort.Strings(v.keys)
+		v.labels[k] = append([]string{}, labelValues...)
+	}
+	return k
+}
+
+func (v *vec) writeHeader(w io.Writer, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, metricType)
+}
+
+// formatLabels renders {a="1",b="2"}, extra is appended as already formatted pairs
+func (v *vec) formatLabels(labelValues []string, extra ...string) string {
+	var pairs []string
+	for i, name := range v.labelNames {
+		pairs = append(pairs, name+"="+quoteLabel(labelValues[i]))
+	}
+	pairs = append(pairs, extra...)
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// labelEscaper escapes what the exposition format needs escaped in a label value, everything else is left as is
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quoteLabel renders a label value in quotes, the way scrapers read it. It's not Go's strconv.Quote,
+// scrapers don't decode \u escapes.
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	vec
+	values map[string]float64
+}
+
+// NewCounter creates and registers a counter
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, labelNames), values: map[string]float64{}}
+	Register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(amount float64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values[c.key(labelValues)] += amount
+}
+
+// Get returns the current value for the labels, mostly useful for tests
+func (c *Counter) Get(labelValues ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.values[strings.Join(labelValues, "\xff")]
+}
+
+func (c *Counter) Write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writeHeader(w, "counter")
+	if len(c.labelNames) == 0 && len(c.keys) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name) // let prometheus know we exist before anything has happened
+	}
+	for _, k := range c.keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.formatLabels(c.labels[k]), formatValue(c.values[k]))
+	}
+}
+
+// GaugeFunc is a value that can go up and down, it's read when metrics are scraped
+type GaugeFunc struct {
+	vec
+	value func() float64
+}
+
+// NewGaugeFunc creates and registers a gauge that calls value on every scrape
+func NewGaugeFunc(name, help string, value func() float64) *GaugeFunc {
+	g := &GaugeFunc{vec: newVec(name, help, nil), value: value}
+	Register(g)
+	return g
+}
+
+func (g *GaugeFunc) Write(w io.Writer) {
+	g.writeHeader(w, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.value()))
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	vec
+	buckets []float64
+	counts  map[string][]uint64
+	sums    map[string]float64
+	totals  map[string]uint64
+}
+
+// DefaultSecondsBuckets is meant for timing things that take between a few ms and a minute
+var DefaultSecondsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// NewHistogram creates and registers a histogram, buckets are upper bounds and must be sorted
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	h := &Histogram{
+		vec:     newVec(name, help, labelNames),
+		buckets: buckets,
+		counts:  map[string][]uint64{},
+		sums:    map[string]float64{},
+		totals:  map[string]uint64{},
+	}
+	Register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	k := h.key(labelValues)
+	if h.counts[k] == nil {
+		h.counts[k] = make([]uint64, len(h.buckets))
+	}
+
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			h.counts[k][i]++
+		}
+	}
+	h.sums[k] += value
+	h.totals[k]++
+}
+
+func (h *Histogram) Write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w, "histogram")
+	for _, k := range h.keys {
+		labelValues := h.labels[k]
+		for i, upperBound := range h.buckets {
+			le := "le=" + quoteLabel(formatValue(upperBound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(labelValues, le), h.counts[k][i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(labelValues, `le="+Inf"`), h.totals[k])
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.formatLabels(labelValues), formatValue(h.sums[k]))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.formatLabels(labelValues), h.totals[k])
+	}
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
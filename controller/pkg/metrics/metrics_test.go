@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("test_messages_total", "Messages.", "source", "outcome")
+	c.Inc("slack", "displayed")
+	c.Inc("slack", "displayed")
+	c.Add(3, "countdown", "failed")
+
+	var out bytes.Buffer
+	c.Write(&out)
+
+	assert.Equal(t, `# HELP test_messages_total Messages.
+# TYPE test_messages_total counter
+test_messages_total{source="countdown",outcome="failed"} 3
+test_messages_total{source="slack",outcome="displayed"} 2
+`, out.String())
+	assert.Equal(t, float64(2), c.Get("slack", "displayed"))
+}
+
+func TestLabelValuesAreEscaped(t *testing.T) {
+	c := NewCounter("test_escaped_total", "Escaped.", "source")
+	c.Inc("café \"quoted\" back\\slash\nnew line\ttab")
+
+	var out bytes.Buffer
+	c.Write(&out)
+
+	// only backslashes, quotes and new lines are escaped, the rest is left for the scraper as is
+	assert.Equal(t, `# HELP test_escaped_total Escaped.
+# TYPE test_escaped_total counter
+test_escaped_total{source="café \"quoted\" back\\slash\nnew line`+"\t"+`tab"} 1
+`, out.String())
+}
+
+func TestGaugeFunc(t *testing.T) {
+	depth := 4
+	g := NewGaugeFunc("test_queue_depth", "Queue depth.", func() float64 { return float64(depth) })
+
+	var out bytes.Buffer
+	g.Write(&out)
+
+	assert.Equal(t, `# HELP test_queue_depth Queue depth.
+# TYPE test_queue_depth gauge
+test_queue_depth 4
+`, out.String())
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_render_seconds", "Render time.", []float64{.1, 1}, "type")
+	h.Observe(.05, "text")
+	h.Observe(.5, "text")
+	h.Observe(5, "text")
+
+	var out bytes.Buffer
+	h.Write(&out)
+
+	assert.Equal(t, `# HELP test_render_seconds Render time.
+# TYPE test_render_seconds histogram
+test_render_seconds_bucket{type="text",le="0.1"} 1
+test_render_seconds_bucket{type="text",le="1"} 2
+test_render_seconds_bucket{type="text",le="+Inf"} 3
+test_render_seconds_sum{type="text"} 5.55
+test_render_seconds_count{type="text"} 3
+`, out.String())
+}
+
+func TestWriteAllIsSortedByName(t *testing.T) {
+	NewCounter("test_b_total", "B.")
+	NewCounter("test_a_total", "A.")
+
+	var out bytes.Buffer
+	WriteAll(&out)
+
+	a := bytes.Index(out.Bytes(), []byte("test_a_total"))
+	b := bytes.Index(out.Bytes(), []byte("test_b_total"))
+	assert.True(t, a >= 0 && a < b, "metrics should be sorted by name")
+}
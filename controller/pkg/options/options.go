@@ -2,7 +2,10 @@ package options
 
 import (
 	"fmt"
+	"math"
 	"regexp"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/armory/flipdisks/pkg/virtualboard"
@@ -16,21 +19,135 @@ type FlipboardMessageOptions struct {
 	VirtualBoard *virtualboard.VirtualBoard
 
 	DisplayTime      int    `yaml:"displayTime"` // in ms
+	PageTime         int    `yaml:"page-time"`   // in ms, how long each page of long text is shown, 0 splits the DisplayTime
+	PageIndicator    bool   `yaml:"page-indicator"`
 	Append           bool   `yaml:"append"`
 	Align            string `yaml:"align"`
 	XAlign           string
 	YAlign           string
-	FontSize         int    `yaml:"font-size"`
-	Kerning          int    `yaml:"kerning"`
-	Inverted         bool   `yaml:"inverted"`
-	BWThreshold      int    `yaml:"bwThreshold"`
-	Fill             string `yaml:"fill"`
-	SendPanelByPanel bool   `yaml:"sendPanelByPanel"`
+	Font             string    `yaml:"font"`      // name of a registered font, empty for the default
+	FontSize         int       `yaml:"font-size"` // scales the font 2x, 3x, ...
+	Kerning          int       `yaml:"kerning"`
+	Fit              string    `yaml:"fit"`          // auto picks the biggest font and font-size that fits the board, images take image.FitModes
+	Focus            string    `yaml:"focus"`        // the part of an image that's kept when fit crops it, e.g. "top left" or "30% 20%"
+	Crop             string    `yaml:"crop"`         // "x y width height" of an image to show, in the image's pixels
+	TextAlign        string    `yaml:"text-align"`   // left, center, right or justify, empty follows align
+	LineSpacing      int       `yaml:"line-spacing"` // extra rows between lines of text
+	WordSpacing      int       `yaml:"word-spacing"` // extra columns after every space
+	Inverted         bool      `yaml:"inverted"`
+	BWThreshold      Threshold `yaml:"bwThreshold"`
+	Dither           string    `yaml:"dither"` // how images are turned into dots, see image.DitherAlgorithms, empty is a threshold
+	Fill             string    `yaml:"fill"`
+	Loops            int       `yaml:"loops"`    // how many times a gif plays, 0 follows the gif
+	Duration         string    `yaml:"duration"` // how long a gif loops for, e.g. 20s, it wins over loops
+	Playback         string    `yaml:"playback"` // which way a gif's frames go, see image.Playbacks, empty is forward
+	Speed            float64   `yaml:"speed"`    // 2 plays a gif twice as fast, 0 is the gif's own speed
+	SendPanelByPanel bool      `yaml:"sendPanelByPanel"`
+
+	// Source is where the message came from, e.g. slack or countdown
+	Source string `yaml:"-"`
+
+	// Reply, when it's set, sends a note back to whoever sent the message, e.g. the threshold bwThreshold: auto picked
+	Reply func(note string) `yaml:"-" json:"-"`
 }
 
-func GetDefaultOptions() FlipboardMessageOptions {
+// The biggest sizes a message can ask for, a font-size or a spacing that's much bigger makes boards millions of dots
+// wide and the Pi runs out of memory drawing them
+const (
+	MaxFontSize = 8
+	MinSpacing  = -4 // kerning, line-spacing and word-spacing, negative squeezes things together
+	MaxSpacing  = 16
+)
+
+// The longest a gif can keep the board, anything longer holds up every message behind it.
+// Speeds are limited too, a really slow gif never gets to its next frame.
+const (
+	MaxLoops    = 100
+	MaxDuration = 5 * time.Minute
+	MinSpeed    = 0.1
+	MaxSpeed    = 10
+)
+
+// Clamp keeps the font-size, spacings, and how long and fast a gif plays within their limits, it returns a note for everything it changed
+func (s *FlipboardMessageOptions) Clamp() []string {
+	var notes []string
+	clamp := func(name string, value *int, min, max int) {
+		was := *value
+		if *value < min {
+			*value = min
+		}
+		if *value > max {
+			*value = max
+		}
+		if *value != was {
+			notes = append(notes, fmt.Sprintf("%s: %d is too much, using %d", name, was, *value))
+		}
+	}
+
+	clamp("font-size", &s.FontSize, 0, MaxFontSize)
+	clamp("kerning", &s.Kerning, MinSpacing, MaxSpacing)
+	clamp("line-spacing", &s.LineSpacing, MinSpacing, MaxSpacing)
+	clamp("word-spacing", &s.WordSpacing, MinSpacing, MaxSpacing)
+
+	// negative loops and speeds, and speeds that aren't numbers, aren't clamped, they're mistakes and they're rejected
+	if s.Loops > MaxLoops {
+		notes = append(notes, fmt.Sprintf("loops: %d is too much, using %d", s.Loops, MaxLoops))
+		s.Loops = MaxLoops
+	}
+	if duration, err := time.ParseDuration(s.Duration); err == nil && duration > MaxDuration {
+		notes = append(notes, fmt.Sprintf("duration: %s is too long, using %s", s.Duration, MaxDuration))
+		s.Duration = MaxDuration.String()
+	}
+	if s.Speed > MaxSpeed && !math.IsInf(s.Speed, 1) {
+		notes = append(notes, fmt.Sprintf("speed: %g is too fast, using %g", s.Speed, float64(MaxSpeed)))
+		s.Speed = MaxSpeed
+	}
+	if s.Speed > 0 && s.Speed < MinSpeed {
+		notes = append(notes, fmt.Sprintf("speed: %g is too slow, using %g", s.Speed, MinSpeed))
+		s.Speed = MinSpeed
+	}
+	return notes
+}
+
+// Threshold is a bwThreshold from 0 to 256, or ThresholdAuto to pick one for every image
+type Threshold int
+
+// ThresholdAuto is bwThreshold: auto, the threshold is picked for every image
+const ThresholdAuto = Threshold(-1)
+
+func (t *Threshold) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var auto string
+	if err := unmarshal(&auto); err == nil && auto == "auto" {
+		*t = ThresholdAuto
+		return nil
+	}
+
+	var threshold int
+	if err := unmarshal(&threshold); err != nil {
+		return err
+	}
+	*t = Threshold(threshold)
+	return nil
+}
+
+func (t Threshold) MarshalYAML() (interface{}, error) {
+	if t == ThresholdAuto {
+		return "auto", nil
+	}
+	return int(t), nil
+}
+
+func (t Threshold) String() string {
+	if t == ThresholdAuto {
+		return "auto"
+	}
+	return strconv.Itoa(int(t))
+}
+
+// BuiltinDefaultOptions are the options used when nothing else has been configured
+func BuiltinDefaultOptions() FlipboardMessageOptions {
 	return FlipboardMessageOptions{
-		DisplayTime:      int(5 * (time.Second / time.Millisecond)),	// stored in ms
+		DisplayTime:      int(5 * (time.Second / time.Millisecond)), // stored in ms
 		Inverted:         false,
 		BWThreshold:      140, // magic
 		Fill:             "",
@@ -39,6 +156,36 @@ func GetDefaultOptions() FlipboardMessageOptions {
 	}
 }
 
+var defaultOptions = struct {
+	sync.RWMutex
+	opts FlipboardMessageOptions
+}{opts: BuiltinDefaultOptions()}
+
+// GetDefaultOptions returns the options every message starts with, before its own options are applied
+func GetDefaultOptions() FlipboardMessageOptions {
+	defaultOptions.RLock()
+	defer defaultOptions.RUnlock()
+	return defaultOptions.opts
+}
+
+// SetDefaultOptions changes the options every new message starts with
+func SetDefaultOptions(opts FlipboardMessageOptions) {
+	defaultOptions.Lock()
+	defer defaultOptions.Unlock()
+	defaultOptions.opts = opts
+}
+
+// UnmarshalDefaultOptions reads options on top of BuiltinDefaultOptions, instead of on top of the current defaults
+func UnmarshalDefaultOptions(unmarshal func(interface{}) error) (FlipboardMessageOptions, error) {
+	type nestedOptsDefaults FlipboardMessageOptions
+	raw := nestedOptsDefaults(BuiltinDefaultOptions())
+
+	if err := unmarshal(&raw); err != nil {
+		return FlipboardMessageOptions{}, err
+	}
+	return FlipboardMessageOptions(raw), nil
+}
+
 // SetDisplayTime is a helper given a time.Duration converting to the correct DisplayTime
 func (s *FlipboardMessageOptions) SetDisplayTime(duration time.Duration) {
 	s.DisplayTime = int(duration.Nanoseconds() / 1e6) // because ms is "Intentionally unimplemented" https://github.com/golang/go/issues/5491
@@ -32,6 +32,22 @@ func TestUnmarshleOptions(t *testing.T) {
 				return o
 			}(),
 		},
+		"automatic threshold": {
+			raw: "bwThreshold: auto",
+			Expected: func() FlipboardMessageOptions {
+				o := GetDefaultOptions()
+				o.BWThreshold = ThresholdAuto
+				return o
+			}(),
+		},
+		"threshold": {
+			raw: "bwThreshold: 90",
+			Expected: func() FlipboardMessageOptions {
+				o := GetDefaultOptions()
+				o.BWThreshold = 90
+				return o
+			}(),
+		},
 	}
 
 	for name, test := range tests {
@@ -43,3 +59,58 @@ func TestUnmarshleOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestClamp(t *testing.T) {
+	tests := map[string]struct {
+		opts FlipboardMessageOptions
+
+		Expected FlipboardMessageOptions
+		notes    int
+	}{
+		"within the limits": {
+			opts:     FlipboardMessageOptions{FontSize: 3, Kerning: -1, LineSpacing: 2, WordSpacing: 1},
+			Expected: FlipboardMessageOptions{FontSize: 3, Kerning: -1, LineSpacing: 2, WordSpacing: 1},
+		},
+		"huge font size": {
+			opts:     FlipboardMessageOptions{FontSize: 100000},
+			Expected: FlipboardMessageOptions{FontSize: MaxFontSize},
+			notes:    1,
+		},
+		"huge spacings": {
+			opts:     FlipboardMessageOptions{Kerning: 100000, LineSpacing: -100000, WordSpacing: 100000},
+			Expected: FlipboardMessageOptions{Kerning: MaxSpacing, LineSpacing: MinSpacing, WordSpacing: MaxSpacing},
+			notes:    3,
+		},
+		"a gif that plays forever": {
+			opts:     FlipboardMessageOptions{Loops: 1000000, Duration: "100h"},
+			Expected: FlipboardMessageOptions{Loops: MaxLoops, Duration: "5m0s"},
+			notes:    2,
+		},
+		"speeds": {
+			opts:     FlipboardMessageOptions{Speed: 1000},
+			Expected: FlipboardMessageOptions{Speed: MaxSpeed},
+			notes:    1,
+		},
+		"a slow speed": {
+			opts:     FlipboardMessageOptions{Speed: 0.0001},
+			Expected: FlipboardMessageOptions{Speed: MinSpeed},
+			notes:    1,
+		},
+		"mistakes are left to be rejected": {
+			opts:     FlipboardMessageOptions{Loops: -1, Duration: "forever", Speed: -2},
+			Expected: FlipboardMessageOptions{Loops: -1, Duration: "forever", Speed: -2},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			notes := test.opts.Clamp()
+			if diff := deep.Equal(test.opts, test.Expected); diff != nil {
+				t.Error(diff)
+			}
+			if len(notes) != test.notes {
+				t.Errorf("Expected %d notes, got %q", test.notes, notes)
+			}
+		})
+	}
+}
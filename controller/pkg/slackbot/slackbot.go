@@ -6,23 +6,35 @@ import (
 	"log"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/nlopes/slack"
 
 	"github.com/armory/flipdisks/pkg/flipboard"
+	"github.com/armory/flipdisks/pkg/fontmap"
 	"github.com/armory/flipdisks/pkg/github"
+	"github.com/armory/flipdisks/pkg/metrics"
 	"github.com/armory/flipdisks/pkg/options"
 
 	"github.com/armory/flipdisks/pkg/ngrok"
 )
 
+var slackReconnects = metrics.NewCounter("flipdisk_slack_reconnects_total", "Times the slack connection had to be reestablished.")
+
 type Slack struct {
 	token             string
 	githubEmojiLookup github.EmojiLookup
 	RTM               *slack.RTM
 	ngrok             *ngrok.Config
+
+	// Reload is called by "settings reload", it should re-read the config and apply it
+	Reload func() error
+
+	allowedUsersMutex sync.RWMutex
+	allowedUsers      []string
 }
 
 func NewSlack(token string, g github.EmojiLookup) *Slack {
@@ -45,6 +57,11 @@ func (s *Slack) StartSlackListener(board *flipboard.Flipboard) {
 		case *slack.MessageEvent:
 			go s.handleSlackMsg(event, board)
 
+		case *slack.ConnectedEvent:
+			if event.ConnectionCount > 1 {
+				slackReconnects.Inc()
+			}
+
 		case *slack.InvalidAuthEvent:
 			fmt.Printf("Invalid credentials")
 			return
@@ -61,10 +78,40 @@ func (s *Slack) StartSlackListener(board *flipboard.Flipboard) {
 	}
 }
 
+// SetAllowedUsers limits who can use the board to these slack user ids, empty allows everyone
+func (s *Slack) SetAllowedUsers(userIds []string) {
+	s.allowedUsersMutex.Lock()
+	defer s.allowedUsersMutex.Unlock()
+	s.allowedUsers = userIds
+}
+
+func (s *Slack) isAllowed(userId string) bool {
+	s.allowedUsersMutex.RLock()
+	defer s.allowedUsersMutex.RUnlock()
+
+	if len(s.allowedUsers) == 0 {
+		return true
+	}
+
+	for _, allowed := range s.allowedUsers {
+		if allowed == userId {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Slack) handleSlackMsg(slackEvent *slack.MessageEvent, board *flipboard.Flipboard) {
 	rawMsg := slackEvent.Msg.Text
+	userId := slackEvent.Msg.User
 	if slackEvent.SubMessage != nil {
 		rawMsg = slackEvent.SubMessage.Text
+		userId = slackEvent.SubMessage.User
+	}
+
+	if !s.isAllowed(userId) {
+		fmt.Printf("Ignoring message from %s, they're not in the allowed users\n", userId)
+		return
 	}
 
 	if strings.HasPrefix(rawMsg, s.getMyUserIdFormatted()) {
@@ -75,6 +122,11 @@ func (s *Slack) handleSlackMsg(slackEvent *slack.MessageEvent, board *flipboard.
 			return
 		}
 
+		if strings.ToLower(msg) == "fonts" {
+			s.RTM.SendMessage(s.RTM.NewOutgoingMessage("Fonts: `"+strings.Join(fontmap.Names(), "`, `")+"`", slackEvent.Msg.Channel))
+			return
+		}
+
 		if strings.HasPrefix(msg, "settings ") || strings.HasPrefix(msg, "set ") {
 			msg = strings.TrimSpace(strings.TrimPrefix(msg, "settings"))
 			msg = strings.TrimSpace(strings.TrimPrefix(msg, "set"))
@@ -88,6 +140,10 @@ func (s *Slack) handleSlackMsg(slackEvent *slack.MessageEvent, board *flipboard.
 				return // let's just ignore it if we don't have anything to display on the board
 			}
 
+			if s.handleHistoryCommand(msg, board, slackEvent.Msg.Channel) {
+				return
+			}
+
 			rawMsg = s.editSettings(msg, board, slackEvent)
 		} else {
 			rawMsg = fmt.Sprintf("@%s %s", s.RTM.GetInfo().User.Name, msg)
@@ -108,9 +164,21 @@ func (s *Slack) handleSlackMsg(slackEvent *slack.MessageEvent, board *flipboard.
 		}
 
 		msg.Message = s.renderSlackUsernames(msg.Message)
+		msg.Message = unwrapSlackLinks(msg.Message)
 		msg.Message = cleanupSlackEncodedCharacters(msg.Message)
 		msg.Message = s.renderSlackEmojis(msg.Message)
+		msg.Source = "slack"
+		channel := slackEvent.Msg.Channel
+		msg.Reply = func(note string) {
+			s.RTM.SendMessage(s.RTM.NewOutgoingMessage(note, channel))
+		}
+		for _, note := range msg.Clamp() {
+			msg.Reply(note)
+		}
 
+		if historyId := flipboard.RecordHistory(board, msg); historyId > 0 {
+			msg.Reply(fmt.Sprintf("Your message is `#%d`, play it again with `settings replay %d`", historyId, historyId))
+		}
 		board.Enqueue(&msg)
 	}
 }
@@ -140,6 +208,18 @@ func (s *Slack) editSettings(rawMsg string, board *flipboard.Flipboard, event *s
 			}
 			return "setting countdown to " + val
 		}
+	case "reload":
+		if s.Reload == nil {
+			return "error: reloading isn't supported"
+		}
+
+		if err := s.Reload(); err != nil {
+			s.RTM.SendMessage(s.RTM.NewOutgoingMessage("error: couldn't reload config, keeping the old one\n```"+err.Error()+"```", event.Msg.Channel))
+			return "config not reloaded"
+		}
+
+		s.RTM.SendMessage(s.RTM.NewOutgoingMessage("reloaded config", event.Msg.Channel))
+		return "reloaded config"
 	case "help":
 		s.respondWithSettingsHelpMessage(event.Msg.Channel)
 		return ""
@@ -149,6 +229,105 @@ func (s *Slack) editSettings(rawMsg string, board *flipboard.Flipboard, event *s
 	return "error: received an unknown setting: `" + settingName + "`"
 }
 
+// handleHistoryCommand will replay old messages and manage favorites, it returns false if msg isn't a history command
+func (s *Slack) handleHistoryCommand(msg string, board *flipboard.Flipboard, channelId string) bool {
+	fields := strings.Fields(msg)
+	if len(fields) == 0 {
+		return false
+	}
+
+	var reply string
+	switch strings.ToLower(fields[0]) {
+	case "replay":
+		historyId, err := parseHistoryId(fields[1:])
+		if err != nil {
+			reply = "error: " + err.Error()
+			break
+		}
+
+		replayed, err := flipboard.Replay(board, historyId)
+		if err != nil {
+			reply = "error: " + err.Error()
+			break
+		}
+		reply = fmt.Sprintf("replaying `%s`", replayed.Message)
+
+	case "history":
+		reply = "Recently played, replay them with `settings replay <id>`:\n"
+		for _, entry := range flipboard.GetHistory(board, 10) {
+			reply += fmt.Sprintf("`%d` %s\n", entry.Id, entry.Options.Message)
+		}
+
+	case "favorites":
+		favs := flipboard.ListFavorites(board)
+		if len(favs) == 0 {
+			reply = "there aren't any favorites yet, save one with `settings favorite save <name> [history id]`"
+			break
+		}
+		reply = "Favorites: `" + strings.Join(favs, "`, `") + "`"
+
+	case "favorite", "fav":
+		reply = s.handleFavoriteCommand(fields[1:], board)
+
+	default:
+		return false
+	}
+
+	s.RTM.SendMessage(s.RTM.NewOutgoingMessage(reply, channelId))
+	return true
+}
+
+func (s *Slack) handleFavoriteCommand(args []string, board *flipboard.Flipboard) string {
+	if len(args) == 0 {
+		return "error: try `settings favorite <name>`, `settings favorite save <name> [history id]` or `settings favorite delete <name>`"
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "save":
+		if len(args) < 2 {
+			return "error: favorites need a name, `settings favorite save <name> [history id]`"
+		}
+
+		historyId, err := parseHistoryId(args[2:])
+		if err != nil {
+			return "error: " + err.Error()
+		}
+
+		if err := flipboard.SaveFavorite(board, args[1], historyId); err != nil {
+			return "error: " + err.Error()
+		}
+		return "saved favorite `" + args[1] + "`"
+
+	case "delete":
+		if len(args) < 2 {
+			return "error: which favorite? `settings favorite delete <name>`"
+		}
+
+		if err := flipboard.DeleteFavorite(board, args[1]); err != nil {
+			return "error: " + err.Error()
+		}
+		return "deleted favorite `" + args[1] + "`"
+	}
+
+	if _, err := flipboard.PlayFavorite(board, args[0]); err != nil {
+		return "error: " + err.Error()
+	}
+	return "playing favorite `" + args[0] + "`"
+}
+
+// parseHistoryId reads the optional history id argument, no argument means the last message (0)
+func parseHistoryId(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+
+	historyId, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	if err != nil || historyId < 1 {
+		return 0, fmt.Errorf("`%s` is not a history id", args[0])
+	}
+	return historyId, nil
+}
+
 func (s *Slack) getMyUserIdFormatted() string {
 	return fmt.Sprintf("<@%s>", s.RTM.GetInfo().User.ID)
 }
@@ -157,9 +336,18 @@ func cleanupSlackEncodedCharacters(msg string) string {
 	// replace slack tokens that are rendered to characters
 	msg = strings.Replace(msg, "&lt;", "<", -1)
 	msg = strings.Replace(msg, "&gt;", ">", -1)
+	msg = strings.Replace(msg, "&amp;", "&", -1) // last, so "&amp;lt;" stays "&lt;"
 	return msg
 }
 
+var slackLink = regexp.MustCompile(`<(https?://[^|>]+)(?:\|[^>]*)?>`)
+
+// unwrapSlackLinks turns links, that slack sends like <https://a.com/cat.gif|a.com/cat.gif>, back into their url.
+// It has to happen before cleanupSlackEncodedCharacters, a < someone typed is still &lt; until then.
+func unwrapSlackLinks(msg string) string {
+	return slackLink.ReplaceAllString(msg, "$1")
+}
+
 func (s *Slack) renderSlackUsernames(msg string) string {
 	userIds := regexp.MustCompile("<@\\w+>").FindAllString(msg, -1)
 	for _, slackFmtMsgUserId := range userIds {
@@ -228,20 +416,45 @@ You can also supply options for the board by doing:
 
 	msg += "```"
 	msg += `
-Your Message, 🚀, or img_url goes here.
+Your Message, 🚀, or img_url goes here. Mix them too, e.g. Congrats :tada: Sam
+Make a word stand out with [inv]ON AIR[/inv], *bold* or [blink]blinking[/blink] text
 ---
 align:        # 10 5           // set position of media; horizontally or vertically
 align:        # center center  // (left,center,right)  (top,center,bottom)
 inverted:     # (true/false) invert the text or image
-bwThreshold:  # (0-256) set the threshold value for either "on" or "off"
+bwThreshold:  # (0-256, auto) set the threshold value for either "on" or "off", auto picks one for every image
+dither:       # (threshold,floyd-steinberg,atkinson,bayer2,bayer4,bayer8,random) how images are turned into dots, try atkinson for photos
 fill:         # ("", true/false) leave blank for autofill, or select your own fill
+font:         # name of the font, see "@{{.Username}} fonts"
+font-size:    # (1,2,3,4) make the letters 2x, 3x, 4x bigger, up to 8
+fit:          # (auto,contain,cover,stretch,none) auto picks the biggest font and font-size for text, the others are how an image fits the board, cover fills it and crops off the rest
+focus:        # (top left, 30% 20%) the part of an image that's kept when it's cropped
+crop:         # (x y width height) only show part of an image, in the image's pixels
+loops:        # (1,2,3) how many times a gif plays, it follows the gif by default and loops until the displayTime is up, up to 100
+duration:     # (20s, 1m) keep looping a gif for this long, up to 5m
+playback:     # (forward,reverse,pingpong) which way a gif's frames go
+speed:        # (0.5,1,2) play a gif slower or faster, from 0.1 to 10
+page-time:    # (ms) how long each page of long text is shown, the pages split the display time by default
+page-indicator: # (true/false) dots in the bottom right corner for the pages that have been shown
+kerning:      # (-2,-1,0,1,2) spacing between letters, negative squeezes them together
+text-align:   # (left,center,right,justify) how the lines line up with each other, defaults to align
+line-spacing: # (-1,0,1,2) extra rows between lines
+word-spacing: # (-1,0,1,2) extra spacing between words
 `
-	// we would like to add support for this in the future
-	//kerning: 0	         // spacing between letters
-	//font-size: 1           // ??
 
 	msg += "```\n\n"
 
+	msg += `You can play old messages again:
+` + "```" + `
+@{{.Username}} settings replay                    # replay the last message
+@{{.Username}} settings replay <id>               # replay a message from the history
+@{{.Username}} settings history                   # list the recent messages and their ids
+@{{.Username}} settings favorite save <name> [id] # save the last message, or a message from the history
+@{{.Username}} settings favorite <name>           # play a favorite
+@{{.Username}} settings favorite delete <name>    # delete a favorite
+@{{.Username}} settings favorites                 # list the favorites
+` + "```\n\n"
+
 	msg += "To display the help message for the settings, type in:   `@{{.Username}} settings help`"
 
 	t, _ := template.New("").Parse(msg)
@@ -260,6 +473,11 @@ help                   # show this help message
 countdown enable       # enable the countdown clock
 countdown disable      # disable the countdown clock
 countdown YYYY-MM-DD   # set a new countdown date and enable it
+reload                 # re-read the config file and apply it
+replay [id]            # replay the last message, or a message from the history
+history                # list the recent messages and their ids
+favorite <name>        # play a favorite, save it with favorite save <name> [id], or favorite delete <name>
+favorites              # list the favorites
 ` + "```")
 
 	var buff bytes.Buffer
@@ -22,6 +22,14 @@ func TestCleanupSlackEncodedCharacters(t *testing.T) {
 			msg:      "10 &gt; 1",
 			Expected: "10 > 1",
 		},
+		"& in a url": {
+			msg:      "https://a.com/cat.png?w=1&amp;h=2",
+			Expected: "https://a.com/cat.png?w=1&h=2",
+		},
+		"an escaped escape": {
+			msg:      "&amp;lt;",
+			Expected: "&lt;",
+		},
 	}
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -30,6 +38,36 @@ func TestCleanupSlackEncodedCharacters(t *testing.T) {
 	}
 }
 
+func TestUnwrapSlackLinks(t *testing.T) {
+	tests := map[string]struct {
+		msg string
+
+		Expected string
+	}{
+		"link with a label": {
+			msg:      "look <https://giphy.com/gifs/cat-abc|giphy.com/gifs/cat-abc>!",
+			Expected: "look https://giphy.com/gifs/cat-abc!",
+		},
+		"link without a label": {
+			msg:      "<http://a.com/cat.gif>",
+			Expected: "http://a.com/cat.gif",
+		},
+		"users and channels aren't links": {
+			msg:      "<@U123> in <#C123|general>",
+			Expected: "<@U123> in <#C123|general>",
+		},
+		"typed brackets": {
+			msg:      "&lt;https://a.com&gt;",
+			Expected: "&lt;https://a.com&gt;",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, unwrapSlackLinks(test.msg))
+		})
+	}
+}
+
 func TestSplitMessageAndOptions(t *testing.T) {
 	tests := map[string]struct {
 		msg string
@@ -102,3 +140,40 @@ func TestSplitMessageAndOptions(t *testing.T) {
 	}
 }
 
+func TestParseHistoryId(t *testing.T) {
+	tests := map[string]struct {
+		args []string
+
+		Expected    int
+		ExpectedErr bool
+	}{
+		"no id is the last message": {
+			args:     []string{},
+			Expected: 0,
+		},
+		"id": {
+			args:     []string{"12"},
+			Expected: 12,
+		},
+		"id with a hash": {
+			args:     []string{"#12"},
+			Expected: 12,
+		},
+		"not a number": {
+			args:        []string{"parrot"},
+			ExpectedErr: true,
+		},
+		"ids start at 1": {
+			args:        []string{"0"},
+			ExpectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseHistoryId(test.args)
+			assert.Equal(t, test.ExpectedErr, err != nil)
+			assert.Equal(t, test.Expected, got)
+		})
+	}
+}
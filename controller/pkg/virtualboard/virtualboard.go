@@ -19,3 +19,14 @@ func (board VirtualBoard) String() string {
 
 	return line
 }
+
+// Width is how wide the widest row is, rows can be different widths
+func (board VirtualBoard) Width() int {
+	width := 0
+	for _, row := range board {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	return width
+}